@@ -0,0 +1,122 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package defs
+
+import (
+	"encoding/json"
+
+	"github.com/npiganeau/yep/pool"
+	"github.com/npiganeau/yep/yep/models"
+)
+
+func initDefaultValues() {
+	models.NewModel("DefaultValue")
+	defaultValue := pool.DefaultValue()
+	defaultValue.AddCharField("ResModel", models.StringFieldParams{String: "Model", Required: true, Index: true})
+	defaultValue.AddCharField("FieldName", models.StringFieldParams{String: "Field", Required: true})
+	defaultValue.AddTextField("JSONValue", models.StringFieldParams{String: "Value",
+		Help: "Default value of the field, JSON encoded"})
+	defaultValue.AddMany2OneField("User", models.ForeignKeyFieldParams{RelationModel: "User",
+		Help: "If set, the default value only applies to this user"})
+	defaultValue.AddMany2OneField("Company", models.ForeignKeyFieldParams{RelationModel: "Company",
+		Help: "If set, the default value only applies to users of this company"})
+	defaultValue.AddCharField("Condition", models.StringFieldParams{
+		Help: "If set, the default value only applies when this condition is met"})
+
+	defaultValue.AddMethod("SetDefault",
+		`SetDefault saves the given value as default value of the given field of the
+		given model. If forAllUsers is false, the default only applies to the current
+		user. If companyID is true, the default only applies to the users of the
+		company of the current user, and if it is an id, to the users of this company.
+		Only administrators can set defaults for all users or for a company.`,
+		func(rs pool.DefaultValueSet, modelName, fieldName string, value interface{}, forAllUsers bool,
+			companyID interface{}, condition interface{}) {
+			jsonValue, err := json.Marshal(value)
+			if err != nil {
+				log.Panic("Unable to marshal default value", "model", modelName, "field", fieldName, "value", value)
+			}
+			user := pool.User().Search(rs.Env(), pool.User().ID().Equals(rs.Env().Uid()))
+			if (forAllUsers || companyID != nil && companyID != false) && !user.IsAdmin() {
+				log.Panic("Only administrators can set default values for all users or for a company",
+					"model", modelName, "field", fieldName, "uid", rs.Env().Uid())
+			}
+			cond := pool.DefaultValue().ResModel().Equals(modelName).And().FieldName().Equals(fieldName)
+			data := pool.DefaultValueData{
+				ResModel:  modelName,
+				FieldName: fieldName,
+				JSONValue: string(jsonValue),
+			}
+			if condStr, ok := condition.(string); ok {
+				data.Condition = condStr
+			}
+			cond = cond.And().Condition().Equals(data.Condition)
+			if forAllUsers {
+				cond = cond.And().User().IsNull()
+			} else {
+				data.User = user
+				cond = cond.And().UserFilteredOn(pool.User().ID().Equals(rs.Env().Uid()))
+			}
+			switch c := companyID.(type) {
+			case bool:
+				if c {
+					data.Company = user.Company()
+				}
+			case float64:
+				data.Company = pool.Company().Search(rs.Env(), pool.Company().ID().Equals(int64(c)))
+			case int64:
+				data.Company = pool.Company().Search(rs.Env(), pool.Company().ID().Equals(c))
+			}
+			if data.Company.IsEmpty() {
+				cond = cond.And().Company().IsNull()
+			} else {
+				cond = cond.And().CompanyFilteredOn(pool.Company().ID().Equals(data.Company.ID()))
+			}
+			if existing := rs.Search(cond); !existing.IsEmpty() {
+				existing.SetJSONValue(data.JSONValue)
+				return
+			}
+			rs.Create(&data)
+		})
+
+	defaultValue.AddMethod("GetDefaults",
+		`GetDefaults returns the saved default values of the fields of the given model
+		that apply to the current user, JSON decoded. If several defaults apply to the
+		same field, user specific defaults take precedence over company specific defaults,
+		which take precedence over defaults for all users. Defaults with a condition are
+		not returned.`,
+		func(rs pool.DefaultValueSet, modelName string) map[string]interface{} {
+			user := pool.User().Search(rs.Env(), pool.User().ID().Equals(rs.Env().Uid()))
+			res := make(map[string]interface{})
+			priorities := make(map[string]int)
+			for _, rec := range rs.Search(pool.DefaultValue().ResModel().Equals(modelName)).Records() {
+				if rec.Condition() != "" {
+					continue
+				}
+				var priority int
+				if !rec.User().IsEmpty() {
+					if rec.User().ID() != user.ID() {
+						continue
+					}
+					priority += 2
+				}
+				if !rec.Company().IsEmpty() {
+					if rec.Company().ID() != user.Company().ID() {
+						continue
+					}
+					priority++
+				}
+				if p, exists := priorities[rec.FieldName()]; exists && p >= priority {
+					continue
+				}
+				var value interface{}
+				if err := json.Unmarshal([]byte(rec.JSONValue()), &value); err != nil {
+					log.Warn("Invalid saved default value", "model", modelName, "field", rec.FieldName(), "error", err)
+					continue
+				}
+				res[rec.FieldName()] = value
+				priorities[rec.FieldName()] = priority
+			}
+			return res
+		})
+}
@@ -10,6 +10,10 @@ import (
 )
 
 func initGroups() {
+	// Groups used in the views of this module
+	security.Registry.NewGroup("base.group_no_one", "Technical Features")
+	security.Registry.NewGroup("base.group_light_multi_company", "Multi Companies")
+
 	models.NewModel("Group")
 	group := pool.Group()
 	group.AddCharField("GroupID", models.StringFieldParams{Required: true})
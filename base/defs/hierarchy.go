@@ -0,0 +1,111 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package defs
+
+import (
+	"fmt"
+
+	"github.com/npiganeau/yep/pool"
+	"github.com/npiganeau/yep/yep/models"
+)
+
+func initHierarchyMixin() {
+	models.NewMixinModel("HierarchyMixin")
+	hierarchyMixin := pool.HierarchyMixin()
+	hierarchyMixin.AddCharField("ParentPath", models.StringFieldParams{Index: true,
+		Help: "Materialized path of the record in the hierarchy, in the form /1/5/7/"})
+
+	hierarchyMixin.AddMethod("ParentFieldName",
+		`ParentFieldName returns the name of the many2one field pointing to the parent
+		record in the hierarchy. It defaults to 'Parent' and is meant to be overridden
+		by models which use another field.`,
+		func(rs pool.HierarchyMixinSet) string {
+			return "Parent"
+		})
+
+	hierarchyMixin.Methods().Create().Extend("",
+		func(rs pool.HierarchyMixinSet, data models.FieldMapper) pool.HierarchyMixinSet {
+			res := rs.Super().Create(data)
+			res.UpdateParentPath()
+			return res
+		})
+
+	hierarchyMixin.Methods().Write().Extend("",
+		func(rs pool.HierarchyMixinSet, data models.FieldMapper, fieldsToUnset ...models.FieldNamer) bool {
+			res := rs.Super().Write(data, fieldsToUnset...)
+			parentField := rs.ParentFieldName()
+			fMap := data.FieldMap()
+			_, ok1 := fMap[parentField]
+			_, ok2 := fMap[rs.Model().JSONizeFieldName(parentField)]
+			if ok1 || ok2 {
+				rs.CheckRecursion()
+				rs.UpdateParentPath()
+			}
+			return res
+		})
+
+	hierarchyMixin.AddMethod("CheckRecursion",
+		`CheckRecursion panics if one of the records of this RecordSet is its own
+		ancestor, i.e. if its parent field creates a loop in the hierarchy.`,
+		func(rs pool.HierarchyMixinSet) {
+			parentField := rs.ParentFieldName()
+			for _, rec := range rs.Env().Pool(rs.ModelName()).Search(rs.Model().Field("ID").In(rs.Ids())).Records() {
+				id := rec.Ids()[0]
+				seen := map[int64]bool{id: true}
+				parent := rec.Get(parentField).(models.RecordCollection)
+				for !parent.IsEmpty() {
+					parentID := parent.Ids()[0]
+					if seen[parentID] {
+						log.Panic("Recursion detected in hierarchy", "model", rs.ModelName(), "id", id)
+					}
+					seen[parentID] = true
+					parent = parent.Get(parentField).(models.RecordCollection)
+				}
+			}
+		})
+
+	hierarchyMixin.AddMethod("UpdateParentPath",
+		`UpdateParentPath computes the materialized parent path of the records of
+		this RecordSet from their parent's and updates the paths of all their
+		descendants accordingly.`,
+		func(rs pool.HierarchyMixinSet) {
+			parentField := rs.ParentFieldName()
+			rc := rs.Env().Pool(rs.ModelName())
+			for _, rec := range rc.Search(rs.Model().Field("ID").In(rs.Ids())).Records() {
+				path := "/"
+				if parent := rec.Get(parentField).(models.RecordCollection); !parent.IsEmpty() {
+					path = parent.Get("ParentPath").(string)
+				}
+				rec.Call("Write", models.FieldMap{"ParentPath": fmt.Sprintf("%s%d/", path, rec.Ids()[0])})
+				children := rc.Search(rs.Model().Field(parentField).Equals(rec.Ids()[0]))
+				if !children.IsEmpty() {
+					children.Call("UpdateParentPath")
+				}
+			}
+		})
+
+	hierarchyMixin.AddMethod("InitParentPaths",
+		`InitParentPaths computes the parent path of the records of the model that
+		have none, such as the records that existed before the model embedded the
+		HierarchyMixin. It is called for all models embedding the mixin at startup.`,
+		func(rs pool.HierarchyMixinSet) {
+			parentField := rs.ParentFieldName()
+			rc := rs.Env().Pool(rs.ModelName())
+			var ids []int64
+			missing := rs.Model().Field("ParentPath").IsNull().OrCond(rs.Model().Field("ParentPath").Equals(""))
+			for _, rec := range rc.Search(missing).Records() {
+				// Paths are computed from the topmost records without path,
+				// since UpdateParentPath also updates their descendants.
+				parent := rec.Get(parentField).(models.RecordCollection)
+				if parent.IsEmpty() || parent.Get("ParentPath").(string) != "" {
+					ids = append(ids, rec.Ids()[0])
+				}
+			}
+			if len(ids) == 0 {
+				return
+			}
+			log.Debug("Computing missing parent paths", "model", rs.ModelName(), "roots", len(ids))
+			rc.Search(rs.Model().Field("ID").In(ids)).Call("UpdateParentPath")
+		})
+}
@@ -9,11 +9,15 @@ var log *logging.Logger
 
 func init() {
 	log = logging.GetLogger("base")
+	initHierarchyMixin()
 	initGroups()
 	initPartner()
 	initCompany()
 	initUsers()
 	initFilters()
+	initDefaultValues()
 	initAttachment()
 	initCurrency()
+	initTranslations()
+	initViewCustomizations()
 }
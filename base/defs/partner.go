@@ -14,6 +14,7 @@ func initPartner() {
 	models.NewModel("Partner")
 
 	partner := pool.Partner()
+	partner.InheritModel(pool.HierarchyMixin())
 	partner.AddCharField("Name", models.StringFieldParams{})
 	partner.AddDateField("Date", models.SimpleFieldParams{})
 	//Title            *PartnerTitle
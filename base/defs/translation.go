@@ -0,0 +1,143 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package defs
+
+import (
+	"strings"
+
+	"github.com/npiganeau/yep-base/base/i18n"
+	"github.com/npiganeau/yep/pool"
+	"github.com/npiganeau/yep/yep/models"
+	"github.com/npiganeau/yep/yep/models/operator"
+	"github.com/npiganeau/yep/yep/models/types"
+)
+
+// checkTranslationsAccess panics if the current user is not an administrator.
+// Translations apply to all users, so that only administrators can modify them.
+func checkTranslationsAccess(rs pool.TranslationSet) {
+	user := pool.User().Search(rs.Env(), pool.User().ID().Equals(rs.Env().Uid()))
+	if user.IsEmpty() || !user.IsAdmin() {
+		log.Panic("Only administrators can modify translations", "uid", rs.Env().Uid())
+	}
+}
+
+func initTranslations() {
+	models.NewModel("Translation")
+	translation := pool.Translation()
+	translation.AddCharField("Lang", models.StringFieldParams{String: "Language", Required: true, Index: true})
+	translation.AddSelectionField("Type", models.SelectionFieldParams{Required: true, Index: true,
+		Selection: types.Selection{
+			i18n.TypeModel:     "Model Field",
+			i18n.TypeView:      "View",
+			i18n.TypeSelection: "Selection",
+			i18n.TypeCode:      "Code",
+		}})
+	translation.AddCharField("Name", models.StringFieldParams{String: "Translated Item",
+		Help: "'Model,Field' for model and selection translations, the view ID for view translations"})
+	translation.AddTextField("Source", models.StringFieldParams{Required: true})
+	translation.AddTextField("Value", models.StringFieldParams{String: "Translation Value"})
+
+	translation.Methods().Create().Extend("",
+		func(rs pool.TranslationSet, data models.FieldMapper) pool.TranslationSet {
+			checkTranslationsAccess(rs)
+			return rs.Super().Create(data)
+		})
+
+	translation.Methods().Write().Extend("",
+		func(rs pool.TranslationSet, data models.FieldMapper, fieldsToUnset ...models.FieldNamer) bool {
+			checkTranslationsAccess(rs)
+			return rs.Super().Write(data, fieldsToUnset...)
+		})
+
+	translation.Methods().Unlink().Extend("",
+		func(rs pool.TranslationSet) int64 {
+			checkTranslationsAccess(rs)
+			return rs.Super().Unlink()
+		})
+
+	translation.AddMethod("LoadPOFile",
+		`LoadPOFile loads the translations of the given .po file. Translations
+		that already exist for the same language, type, name and source are updated.
+		The TranslationLoad context key is set while the translations are written.`,
+		func(rs pool.TranslationSet, fileName string) {
+			poFile, err := i18n.ParseFile(fileName)
+			if err != nil {
+				log.Panic("Unable to load translation file", "file", fileName, "error", err)
+			}
+			type transKey struct {
+				ttype, name, source string
+			}
+			rs = rs.WithContext("TranslationLoad", true)
+			existing := make(map[transKey]pool.TranslationSet)
+			for _, rec := range rs.Search(pool.Translation().Lang().Equals(poFile.Lang)).Records() {
+				existing[transKey{ttype: rec.Type(), name: rec.Name(), source: rec.Source()}] = rec
+			}
+			for _, entry := range poFile.Entries {
+				for _, ref := range entry.References {
+					key := transKey{ttype: ref.Type, name: ref.Name, source: entry.Source}
+					if rec, ok := existing[key]; ok {
+						if rec.Value() != entry.Value {
+							rec.SetValue(entry.Value)
+						}
+						continue
+					}
+					existing[key] = rs.Create(&pool.TranslationData{
+						Lang:   poFile.Lang,
+						Type:   ref.Type,
+						Name:   ref.Name,
+						Source: entry.Source,
+						Value:  entry.Value,
+					})
+				}
+			}
+		})
+
+	translation.AddMethod("GetTranslations",
+		`GetTranslations returns the translations of the given type in the given language
+		as a map of translated values by source term. If name is not empty, only the
+		translations of this item are returned.`,
+		func(rs pool.TranslationSet, lang, ttype, name string) map[string]string {
+			cond := pool.Translation().Lang().Equals(lang).And().Type().Equals(ttype)
+			if name != "" {
+				cond = cond.And().Name().Equals(name)
+			}
+			res := make(map[string]string)
+			for _, rec := range rs.Search(cond).Records() {
+				res[rec.Source()] = rec.Value()
+			}
+			return res
+		})
+
+	translation.AddMethod("GetModelTranslations",
+		`GetModelTranslations returns the translations of the given type (model or
+		selection) of the fields of the given model in the given language, as a map
+		of translated values by source term for each field name.`,
+		func(rs pool.TranslationSet, lang, ttype, modelName string) map[string]map[string]string {
+			cond := pool.Translation().Lang().Equals(lang).And().Type().Equals(ttype).
+				AndCond(rs.Model().Field("Name").AddOperator(operator.Operator("=like"), modelName+",%"))
+			res := make(map[string]map[string]string)
+			for _, rec := range rs.Search(cond).Records() {
+				tokens := strings.SplitN(rec.Name(), ",", 2)
+				if len(tokens) != 2 || tokens[0] != modelName {
+					// Underscores of the pattern match any character
+					continue
+				}
+				if _, exists := res[tokens[1]]; !exists {
+					res[tokens[1]] = make(map[string]string)
+				}
+				res[tokens[1]][rec.Source()] = rec.Value()
+			}
+			return res
+		})
+
+	translation.AddMethod("Translate",
+		`Translate returns the translation of the given source term in the given
+		language for the given type and name, or source itself if there is none.`,
+		func(rs pool.TranslationSet, lang, ttype, name, source string) string {
+			if value, ok := rs.GetTranslations(lang, ttype, name)[source]; ok {
+				return value
+			}
+			return source
+		})
+}
@@ -79,6 +79,22 @@ func initUsers() {
 			return res
 		})
 
+	user.AddMethod("IsAdmin",
+		`IsAdmin returns true if this user is the superuser or a member of the
+		administrators group. This method must be called on a singleton.`,
+		func(rs pool.UserSet) bool {
+			rs.EnsureOne()
+			if rs.ID() == security.SuperUserID {
+				return true
+			}
+			for group := range security.Registry.UserGroups(rs.ID()) {
+				if group.ID == security.GroupAdminID {
+					return true
+				}
+			}
+			return false
+		})
+
 	user.AddMethod("Authenticate",
 		"Authenticate the user defined by login and secret",
 		func(rs pool.UserSet, login, secret string) (uid int64, err error) {
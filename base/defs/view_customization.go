@@ -0,0 +1,122 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package defs
+
+import (
+	"github.com/npiganeau/yep/pool"
+	"github.com/npiganeau/yep/yep/models"
+	"github.com/npiganeau/yep/yep/tools/etree"
+)
+
+// checkCustomizationsAccess panics if the current user is not an administrator
+// and one of the given customizations is not a customization of this user only.
+func checkCustomizationsAccess(rs pool.ViewCustomizationSet) {
+	user := pool.User().Search(rs.Env(), pool.User().ID().Equals(rs.Env().Uid()))
+	if user.IsAdmin() {
+		return
+	}
+	for _, custo := range rs.Records() {
+		if custo.User().IsEmpty() || custo.User().ID() != user.ID() || !custo.Company().IsEmpty() {
+			log.Panic("Only administrators can modify the view customizations of other users or of companies",
+				"customization", custo.ID(), "uid", rs.Env().Uid())
+		}
+	}
+}
+
+// checkCustomizationsArch panics if the patch of one of the given customizations
+// sets the groups attribute of an element. Customizations are applied before the
+// nodes restricted to other groups are removed, so such a patch would let users
+// see the nodes of the view restricted to groups they are not a member of.
+func checkCustomizationsArch(rs pool.ViewCustomizationSet) {
+	for _, custo := range rs.Records() {
+		doc := etree.NewDocument()
+		if err := doc.ReadFromString("<data>" + custo.Arch() + "</data>"); err != nil {
+			log.Panic("Unable to parse view customization", "customization", custo.ID(), "error", err)
+		}
+		if len(doc.FindElements("//attribute[@name='groups']")) > 0 {
+			log.Panic("View customizations cannot modify the groups of the view elements", "customization", custo.ID())
+		}
+	}
+}
+
+func initViewCustomizations() {
+	models.NewModel("ViewCustomization")
+	viewCustomization := pool.ViewCustomization()
+	viewCustomization.AddCharField("View", models.StringFieldParams{String: "Base View", Required: true, Index: true,
+		Help: "ID of the customized view"})
+	viewCustomization.AddCharField("Name", models.StringFieldParams{
+		Help: "Identifies the customization so that it can be updated"})
+	viewCustomization.AddMany2OneField("User", models.ForeignKeyFieldParams{RelationModel: "User",
+		Help: "If set, the customization only applies to this user"})
+	viewCustomization.AddMany2OneField("Company", models.ForeignKeyFieldParams{RelationModel: "Company",
+		Help: "If set, the customization only applies to users of this company"})
+	viewCustomization.AddTextField("Arch", models.StringFieldParams{String: "Patch", Required: true,
+		Help: "Specifications applied to the view arch, in the same format as view extensions"})
+	viewCustomization.AddIntegerField("Sequence", models.SimpleFieldParams{})
+
+	viewCustomization.Methods().Create().Extend("",
+		func(rs pool.ViewCustomizationSet, data models.FieldMapper) pool.ViewCustomizationSet {
+			res := rs.Super().Create(data)
+			checkCustomizationsAccess(res)
+			checkCustomizationsArch(res)
+			return res
+		})
+
+	viewCustomization.Methods().Write().Extend("",
+		func(rs pool.ViewCustomizationSet, data models.FieldMapper, fieldsToUnset ...models.FieldNamer) bool {
+			checkCustomizationsAccess(rs)
+			res := rs.Super().Write(data, fieldsToUnset...)
+			checkCustomizationsAccess(rs)
+			checkCustomizationsArch(rs)
+			return res
+		})
+
+	viewCustomization.Methods().Unlink().Extend("",
+		func(rs pool.ViewCustomizationSet) int64 {
+			checkCustomizationsAccess(rs)
+			return rs.Super().Unlink()
+		})
+
+	viewCustomization.AddMethod("GetCustomizations",
+		`GetCustomizations returns the customizations of the view with the given ID
+		that apply to the current user, in the order they must be applied: company
+		customizations first, so that user customizations take precedence, then by
+		sequence.`,
+		func(rs pool.ViewCustomizationSet, viewID string) []pool.ViewCustomizationData {
+			user := pool.User().Search(rs.Env(), pool.User().ID().Equals(rs.Env().Uid()))
+			cond := pool.ViewCustomization().View().Equals(viewID).And().User().IsNull()
+			if user.Company().IsEmpty() {
+				cond = cond.And().Company().IsNull()
+			} else {
+				cond = cond.AndCond(pool.ViewCustomization().Company().IsNull().
+					Or().CompanyFilteredOn(pool.Company().ID().Equals(user.Company().ID())))
+			}
+			res := rs.Search(cond).OrderBy("Sequence", "ID").All()
+			userCond := pool.ViewCustomization().View().Equals(viewID).
+				And().UserFilteredOn(pool.User().ID().Equals(rs.Env().Uid()))
+			return append(res, rs.Search(userCond).OrderBy("Sequence", "ID").All()...)
+		})
+
+	viewCustomization.AddMethod("SaveCustomization",
+		`SaveCustomization saves the given patch as the customization of the view with
+		the given ID named name for the current user, replacing the existing one if any.
+		The saved customization is applied after the other customizations of the user.`,
+		func(rs pool.ViewCustomizationSet, viewID, name, arch string) {
+			user := pool.User().Search(rs.Env(), pool.User().ID().Equals(rs.Env().Uid()))
+			cond := pool.ViewCustomization().View().Equals(viewID).
+				And().Name().Equals(name).
+				And().UserFilteredOn(pool.User().ID().Equals(user.ID()))
+			rs.Search(cond).Unlink()
+			if arch == "" {
+				return
+			}
+			rs.Create(&pool.ViewCustomizationData{
+				View:     viewID,
+				Name:     name,
+				User:     user,
+				Arch:     arch,
+				Sequence: 1000,
+			})
+		})
+}
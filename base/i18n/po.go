@@ -0,0 +1,191 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+/*
+Package i18n reads the translations of the modules from the .po files of
+their i18n directory.
+
+Each entry of a .po file has one or more references telling what the
+translated term is, in the form type:name:
+
+	#: model:Partner,Name
+	#: selection:Currency,Position
+	#: view:base_view_partner_form
+	#: code:
+	msgid "Name"
+	msgstr "Nom"
+
+where type is one of model (label or help of a field), selection (label
+of a selection value), view (string of a view arch) or code (string used
+in Go code). The name of model and selection references is the model and
+the field separated by a comma, and the name of view references is the
+view id. Entries without reference are code translations.
+
+The language of the file is taken from the Language header, or from
+the file name (e.g. fr_FR.po) if there is no such header.
+*/
+package i18n
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Translation types
+const (
+	TypeModel     = "model"
+	TypeSelection = "selection"
+	TypeView      = "view"
+	TypeCode      = "code"
+)
+
+// A Reference tells where a translated term is used
+type Reference struct {
+	Type string
+	Name string
+}
+
+// An Entry is a translated term of a .po file
+type Entry struct {
+	References []Reference
+	Source     string
+	Value      string
+}
+
+// A File holds the translations of a .po file in a language
+type File struct {
+	Lang    string
+	Entries []Entry
+}
+
+// ParseFile parses the .po file with the given name
+func ParseFile(fileName string) (*File, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	res, err := Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s:%s", fileName, err)
+	}
+	if res.Lang == "" {
+		res.Lang = strings.TrimSuffix(filepath.Base(fileName), filepath.Ext(fileName))
+	}
+	return res, nil
+}
+
+// Parse reads a .po file from the given reader. Untranslated, fuzzy
+// and plural entries are skipped.
+func Parse(r io.Reader) (*File, error) {
+	var (
+		res   File
+		entry poEntry
+		// current is the string being read, to which continuation lines are appended
+		current *string
+	)
+	scanner := bufio.NewScanner(r)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "":
+			res.addEntry(entry)
+			entry = poEntry{}
+			current = nil
+		case strings.HasPrefix(line, "#:"):
+			for _, ref := range strings.Fields(strings.TrimPrefix(line, "#:")) {
+				tokens := strings.SplitN(ref, ":", 2)
+				if len(tokens) != 2 || !validTypes[tokens[0]] {
+					return nil, fmt.Errorf("%d: invalid reference '%s'", lineNum, ref)
+				}
+				entry.refs = append(entry.refs, Reference{Type: tokens[0], Name: tokens[1]})
+			}
+		case strings.HasPrefix(line, "#,"):
+			entry.fuzzy = entry.fuzzy || strings.Contains(line, "fuzzy")
+		case strings.HasPrefix(line, "#"):
+			// Other comments
+		default:
+			keyword, value := line, ""
+			if i := strings.Index(line, " "); i > 0 {
+				keyword, value = line[:i], strings.TrimSpace(line[i+1:])
+			}
+			switch keyword {
+			case "msgctxt":
+				current = &entry.context
+			case "msgid":
+				current = &entry.id
+			case "msgstr":
+				current = &entry.str
+			case "msgid_plural":
+				entry.plural = true
+				current = &entry.skipped
+			default:
+				if strings.HasPrefix(keyword, "msgstr[") {
+					// Plural forms are not supported
+					current = &entry.skipped
+					break
+				}
+				if current == nil || !strings.HasPrefix(line, `"`) {
+					return nil, fmt.Errorf("%d: unexpected line '%s'", lineNum, line)
+				}
+				value = line
+			}
+			str, err := strconv.Unquote(value)
+			if err != nil {
+				return nil, fmt.Errorf("%d: invalid string %s", lineNum, value)
+			}
+			*current += str
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	res.addEntry(entry)
+	return &res, nil
+}
+
+// validTypes are the valid types of references
+var validTypes = map[string]bool{
+	TypeModel:     true,
+	TypeSelection: true,
+	TypeView:      true,
+	TypeCode:      true,
+}
+
+// A poEntry is an entry being parsed
+type poEntry struct {
+	refs    []Reference
+	context string
+	id      string
+	str     string
+	fuzzy   bool
+	plural  bool
+	// skipped holds the strings of the entry that are not used
+	skipped string
+}
+
+// addEntry adds the given parsed entry to this file, or reads the
+// language if it is the header entry.
+func (f *File) addEntry(entry poEntry) {
+	if entry.id == "" {
+		for _, header := range strings.Split(entry.str, "\n") {
+			if strings.HasPrefix(header, "Language:") {
+				f.Lang = strings.TrimSpace(strings.TrimPrefix(header, "Language:"))
+			}
+		}
+		return
+	}
+	if entry.str == "" || entry.fuzzy || entry.plural {
+		return
+	}
+	refs := entry.refs
+	if len(refs) == 0 {
+		refs = []Reference{{Type: TypeCode}}
+	}
+	f.Entries = append(f.Entries, Entry{References: refs, Source: entry.id, Value: entry.str})
+}
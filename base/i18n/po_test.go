@@ -0,0 +1,95 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package i18n
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const testPO = `# Test file
+msgid ""
+msgstr ""
+"Language: fr_FR\n"
+
+#: model:Partner,Name
+#: view:base_view_partner_form
+msgid "Name"
+msgstr "Nom"
+
+#. Comment for translators
+#, fuzzy
+#: model:Partner,Function
+msgid "Function"
+msgstr "Fonction"
+
+#: model:Partner,Ref
+msgid "Ref"
+msgstr ""
+
+msgid ""
+"A long text "
+"on several lines"
+msgstr ""
+"Un long texte "
+"sur plusieurs lignes"
+`
+
+func TestParse(t *testing.T) {
+	Convey("Testing .po files parsing", t, func() {
+		Convey("Entries should be read with their references", func() {
+			file, err := Parse(strings.NewReader(testPO))
+			So(err, ShouldBeNil)
+			So(file.Lang, ShouldEqual, "fr_FR")
+			So(file.Entries, ShouldHaveLength, 2)
+			So(file.Entries[0], ShouldResemble, Entry{
+				References: []Reference{{Type: TypeModel, Name: "Partner,Name"}, {Type: TypeView, Name: "base_view_partner_form"}},
+				Source:     "Name",
+				Value:      "Nom",
+			})
+			So(file.Entries[1], ShouldResemble, Entry{
+				References: []Reference{{Type: TypeCode}},
+				Source:     "A long text on several lines",
+				Value:      "Un long texte sur plusieurs lignes",
+			})
+		})
+		Convey("Plural entries should be skipped", func() {
+			file, err := Parse(strings.NewReader(`#: code:
+msgid "%d record"
+msgid_plural "%d records"
+msgstr[0] "%d enregistrement"
+msgstr[1] "%d enregistrements"
+
+#: model:Partner,Name
+msgid "Name"
+msgstr "Nom"
+`))
+			So(err, ShouldBeNil)
+			So(file.Entries, ShouldHaveLength, 1)
+			So(file.Entries[0].Source, ShouldEqual, "Name")
+		})
+		Convey("Invalid files should return an error", func() {
+			_, err := Parse(strings.NewReader("#: field:Partner,Name\nmsgid \"Name\"\nmsgstr \"Nom\"\n"))
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "invalid reference 'field:Partner,Name'")
+			_, err = Parse(strings.NewReader("msgid \"Name\"\nmsgstr Nom\n"))
+			So(err, ShouldNotBeNil)
+			_, err = Parse(strings.NewReader("\"Name\"\n"))
+			So(err, ShouldNotBeNil)
+		})
+		Convey("Module po files should be parsed", func() {
+			files, _ := filepath.Glob("*.po")
+			So(files, ShouldNotBeEmpty)
+			for _, fileName := range files {
+				file, err := ParseFile(fileName)
+				So(err, ShouldBeNil)
+				So(file.Lang, ShouldNotBeEmpty)
+				So(file.Entries, ShouldNotBeEmpty)
+			}
+		})
+	})
+}
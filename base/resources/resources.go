@@ -0,0 +1,63 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+/*
+Package resources locates the resource files of the modules, such as the
+XML files of their views directory or the .po files of their i18n directory.
+
+Modules declare the import path of their package with Register, next to
+server.RegisterModule, and resource directories are looked up in the
+directory of this package.
+*/
+package resources
+
+import (
+	"go/build"
+	"path/filepath"
+	"sync"
+
+	"github.com/npiganeau/yep/yep/server"
+	"github.com/npiganeau/yep/yep/tools/logging"
+)
+
+var (
+	log *logging.Logger
+	mu  sync.RWMutex
+	// dirs holds the directory of each registered module
+	dirs = make(map[string]string)
+)
+
+// Register declares the import path of the package of the module with the
+// given name, whose directory holds the resource directories of the module.
+// It must be called in the init function of the module.
+func Register(moduleName, importPath string) {
+	pkg, err := build.Import(importPath, "", build.FindOnly)
+	if err != nil {
+		log.Warn("Unable to locate module resources", "module", moduleName, "package", importPath, "error", err)
+		return
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	dirs[moduleName] = pkg.Dir
+}
+
+// Files returns the names of the files matching the given pattern in the
+// given resource directory of each module, in module load order.
+func Files(resource, pattern string) []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	var res []string
+	for _, mod := range server.Modules {
+		dir, ok := dirs[mod.Name]
+		if !ok {
+			continue
+		}
+		fileNames, _ := filepath.Glob(filepath.Join(dir, resource, pattern))
+		res = append(res, fileNames...)
+	}
+	return res
+}
+
+func init() {
+	log = logging.GetLogger("base")
+}
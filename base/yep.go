@@ -21,6 +21,7 @@ import (
 
 	// Import this module's defs
 	_ "github.com/npiganeau/yep-base/base/defs"
+	"github.com/npiganeau/yep-base/base/resources"
 	"github.com/npiganeau/yep/pool"
 	"github.com/npiganeau/yep/yep/actions"
 	"github.com/npiganeau/yep/yep/models"
@@ -50,6 +51,7 @@ var log *logging.Logger
 
 func init() {
 	log = logging.GetLogger("base")
+	resources.Register(MODULE_NAME, "github.com/npiganeau/yep-base/base")
 	server.RegisterModule(&server.Module{
 		Name: MODULE_NAME,
 		PostInit: func() {
@@ -96,6 +98,20 @@ func init() {
 				}
 
 				pool.Group().NewSet(env).ReloadGroups()
+
+				for _, modelName := range models.Registry.All() {
+					if models.Registry.MustGet(modelName).IsMixin() {
+						continue
+					}
+					fInfos := env.Pool(modelName).Call("FieldsGet", models.FieldsGetArgs{}).(map[string]*models.FieldInfo)
+					if _, exists := fInfos["parent_path"]; exists {
+						env.Pool(modelName).Call("InitParentPaths")
+					}
+				}
+
+				for _, poFile := range resources.Files("i18n", "*.po") {
+					pool.Translation().NewSet(env).LoadPOFile(poFile)
+				}
 			})
 			if err != nil {
 				log.Panic("Error while initializing", "error", err)
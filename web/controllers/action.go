@@ -50,7 +50,7 @@ func ActionRun(c *server.Context) {
 	kwargs["context"] = contextJSON
 
 	// Execute the function
-	resAction, _ := Execute(c.Session().Get("uid").(int64), CallParams{
+	resAction, _ := ExecuteServerAction(c.Session().Get("uid").(int64), CallParams{
 		Model:  action.Model,
 		Method: action.Method,
 		Args:   []json.RawMessage{idsJSON},
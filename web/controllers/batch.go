@@ -0,0 +1,157 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/npiganeau/yep/yep/models"
+)
+
+// refKey is the key of the JSON object used in the args and kwargs of a
+// batch call to reference the result of a previous call of the same batch.
+const refKey = "$ref"
+
+// Statuses of a call in a batch
+const (
+	// BatchStatusOK is the status of a call that has been executed successfully.
+	// Its result has been rolled back anyway if another call of the batch failed.
+	BatchStatusOK = "ok"
+	// BatchStatusError is the status of the call that failed
+	BatchStatusError = "error"
+	// BatchStatusSkipped is the status of the calls following a failed call
+	BatchStatusSkipped = "skipped"
+)
+
+// BatchParams is the arguments' struct for the ExecuteBatch function.
+type BatchParams struct {
+	Calls []CallParams `json:"calls"`
+}
+
+// A BatchCallResult holds the result of a single call of a batch.
+type BatchCallResult struct {
+	Status string      `json:"status"`
+	Result interface{} `json:"result,omitempty"`
+	Error  string      `json:"error,omitempty"`
+}
+
+// A BatchResult is the result of the ExecuteBatch function.
+type BatchResult struct {
+	// Success is true if all the calls have been executed and committed
+	Success bool              `json:"success"`
+	Results []BatchCallResult `json:"results"`
+}
+
+// ExecuteBatch executes the given calls in order in a single transaction.
+//
+// The args and kwargs of a call can reference the result of a previous call
+// of the batch with a JSON object {"$ref": N} where N is the index of the
+// previous call in the batch. For instance, a call can use the ID of a record
+// created by a previous call.
+//
+// If a call fails, the following calls are skipped and the whole batch is
+// rolled back. The returned BatchResult reports the status of each call and
+// the returned error is the error of the failed call.
+func ExecuteBatch(uid int64, params BatchParams) (*BatchResult, error) {
+	checkUser(uid)
+	res := &BatchResult{Results: make([]BatchCallResult, len(params.Calls))}
+	for i := range res.Results {
+		res.Results[i].Status = BatchStatusSkipped
+	}
+	rError := models.ExecuteInNewEnvironment(uid, func(env models.Environment) {
+		for i, call := range params.Calls {
+			if err := executeBatchCall(env, call, i, res.Results); err != nil {
+				res.Results[i] = BatchCallResult{Status: BatchStatusError, Error: err.Error()}
+				// Panic again to roll back the whole transaction
+				log.Panic("Batch call failed", "index", i, "model", call.Model, "method", call.Method, "error", err)
+			}
+		}
+	})
+	res.Success = rError == nil
+	return res, rError
+}
+
+// executeBatchCall executes the call of the given index in the batch after having
+// resolved its references to the given results of the previous calls. It sets
+// the result of the call in results and returns the error if the call failed.
+func executeBatchCall(env models.Environment, call CallParams, index int, results []BatchCallResult) (rError error) {
+	defer func() {
+		if r := recover(); r != nil {
+			switch e := r.(type) {
+			case error:
+				rError = e
+			default:
+				rError = fmt.Errorf("%v", r)
+			}
+		}
+	}()
+	for j, arg := range call.Args {
+		call.Args[j] = resolveBatchRefs(arg, results[:index])
+	}
+	for k, arg := range call.KWArgs {
+		call.KWArgs[k] = resolveBatchRefs(arg, results[:index])
+	}
+	res := execute(env, call)
+	results[index] = BatchCallResult{Status: BatchStatusOK, Result: res}
+	return nil
+}
+
+// resolveBatchRefs returns the given JSON data where all {"$ref": N} objects
+// have been replaced by the result of the Nth call in results.
+func resolveBatchRefs(data json.RawMessage, results []BatchCallResult) json.RawMessage {
+	if !bytes.Contains(data, []byte(refKey)) {
+		return data
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var value interface{}
+	if err := dec.Decode(&value); err != nil {
+		log.Panic("Unable to JSON unmarshal batch call argument", "error", err, "data", string(data))
+	}
+	value = replaceBatchRefs(value, results)
+	res, err := json.Marshal(value)
+	if err != nil {
+		log.Panic("Unable to JSON marshal batch call argument", "error", err, "value", value)
+	}
+	return res
+}
+
+// replaceBatchRefs recursively replaces the {"$ref": N} objects in the given
+// decoded JSON value by the result of the Nth call in results.
+func replaceBatchRefs(value interface{}, results []BatchCallResult) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if ref, ok := v[refKey]; ok && len(v) == 1 {
+			return batchRefValue(ref, results)
+		}
+		for key, val := range v {
+			v[key] = replaceBatchRefs(val, results)
+		}
+	case []interface{}:
+		for i, val := range v {
+			v[i] = replaceBatchRefs(val, results)
+		}
+	}
+	return value
+}
+
+// batchRefValue returns the result of the call referenced by ref in results.
+// It panics if ref does not reference a previous call.
+func batchRefValue(ref interface{}, results []BatchCallResult) interface{} {
+	num, ok := ref.(json.Number)
+	if !ok {
+		panic(fmt.Errorf("invalid batch reference %v: must be the index of a previous call", ref))
+	}
+	index, err := num.Int64()
+	if err != nil || index < 0 || int(index) >= len(results) {
+		panic(fmt.Errorf("invalid batch reference %s: must be the index of a previous call", num))
+	}
+	if results[index].Status != BatchStatusOK {
+		panic(errors.New("batch reference to a call that has not been executed"))
+	}
+	return results[index].Result
+}
@@ -40,3 +40,13 @@ func SearchRead(c *server.Context) {
 	res, err := searchRead(uid, params)
 	c.RPC(http.StatusOK, res, err)
 }
+
+// Batch executes the given calls in a single transaction
+func Batch(c *server.Context) {
+	uid := c.Session().Get("uid").(int64)
+	var params BatchParams
+	c.BindRPCParams(&params)
+	res, _ := ExecuteBatch(uid, params)
+	// The error of a failed batch is reported in the result of the failed call
+	c.RPC(http.StatusOK, res, nil)
+}
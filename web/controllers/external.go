@@ -0,0 +1,188 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/npiganeau/yep-base/web/xmlrpc"
+	"github.com/npiganeau/yep/pool"
+	"github.com/npiganeau/yep/yep/models"
+	"github.com/npiganeau/yep/yep/models/security"
+	"github.com/npiganeau/yep/yep/models/types"
+	"github.com/npiganeau/yep/yep/server"
+)
+
+// externalRPCParams is the params struct of external JSON-RPC calls
+type externalRPCParams struct {
+	Service string        `json:"service"`
+	Method  string        `json:"method"`
+	Args    []interface{} `json:"args"`
+}
+
+// XMLRPCCommon is the controller of the XML-RPC 'common' service
+// used by external clients to get the server version and authenticate.
+func XMLRPCCommon(c *server.Context) {
+	serveXMLRPC(c, "common")
+}
+
+// XMLRPCObject is the controller of the XML-RPC 'object' service
+// used by external clients to call model methods.
+func XMLRPCObject(c *server.Context) {
+	serveXMLRPC(c, "object")
+}
+
+// JSONRPC is the controller of the JSON-RPC external API.
+// The service to call is given in the params of the request.
+func JSONRPC(c *server.Context) {
+	var params externalRPCParams
+	c.BindRPCParams(&params)
+	res, err := dispatchExternalRPC(params.Service, params.Method, params.Args)
+	c.RPC(http.StatusOK, res, err)
+}
+
+// serveXMLRPC decodes the XML-RPC call of the request, dispatches
+// it to the given service and writes the XML-RPC response.
+func serveXMLRPC(c *server.Context, service string) {
+	method, args, err := xmlrpc.DecodeMethodCall(c.Request.Body)
+	var res interface{}
+	if err == nil {
+		res, err = dispatchExternalRPC(service, method, args)
+	}
+	var buf bytes.Buffer
+	if err != nil {
+		xmlrpc.EncodeFault(&buf, xmlrpc.Fault{Code: 1, String: err.Error()})
+	} else if err = xmlrpc.EncodeResponse(&buf, res); err != nil {
+		buf.Reset()
+		xmlrpc.EncodeFault(&buf, xmlrpc.Fault{Code: 1, String: err.Error()})
+	}
+	c.Data(http.StatusOK, "text/xml; charset=utf-8", buf.Bytes())
+}
+
+// dispatchExternalRPC calls the given method of the given service of the
+// external API with the given args and returns the result.
+//
+// The 'common' service provides the 'version', 'login' and 'authenticate'
+// methods. The 'object' service provides the 'execute' and 'execute_kw'
+// methods, which authenticate the user at each call.
+func dispatchExternalRPC(service, method string, args []interface{}) (res interface{}, rError error) {
+	defer func() {
+		if r := recover(); r != nil {
+			rError = fmt.Errorf("%v", r)
+		}
+	}()
+	switch service {
+	case "common":
+		switch method {
+		case "version":
+			return map[string]interface{}{
+				"server_serie":        "9.0",
+				"server_version_info": []interface{}{9, 0, 0, "final", 0},
+				"server_version":      "9.0c",
+				"protocol_version":    1,
+			}, nil
+		case "login", "authenticate":
+			if len(args) < 3 {
+				return nil, fmt.Errorf("%s expects at least 3 arguments (db, login, password)", method)
+			}
+			login, _ := args[1].(string)
+			password, _ := args[2].(string)
+			uid, err := security.AuthenticationRegistry.Authenticate(login, password, new(types.Context))
+			if err != nil {
+				return false, nil
+			}
+			return uid, nil
+		}
+	case "object":
+		switch method {
+		case "execute", "execute_kw":
+			params, uid, err := externalCallParams(method, args)
+			if err != nil {
+				return nil, err
+			}
+			return Execute(uid, params)
+		}
+	default:
+		return nil, fmt.Errorf("unknown service '%s'", service)
+	}
+	return nil, fmt.Errorf("unknown method '%s' of service '%s'", method, service)
+}
+
+// externalCallParams authenticates the user of the given execute or execute_kw args
+// and returns the CallParams to give to Execute and the id of the user.
+//
+// Args of execute_kw are (db, uid, password, model, method, args[, kwargs]) and
+// args of execute are (db, uid, password, model, method, arg1, arg2, ...).
+func externalCallParams(method string, args []interface{}) (CallParams, int64, error) {
+	if len(args) < 5 {
+		return CallParams{}, 0, fmt.Errorf("%s expects at least 5 arguments (db, uid, password, model, method)", method)
+	}
+	uid, err := authenticateExternalUser(args[1], args[2])
+	if err != nil {
+		return CallParams{}, 0, err
+	}
+	params := CallParams{
+		Model:  fmt.Sprintf("%v", args[3]),
+		Method: fmt.Sprintf("%v", args[4]),
+	}
+	callArgs := args[5:]
+	var kwArgs map[string]interface{}
+	if method == "execute_kw" {
+		callArgs = nil
+		if len(args) > 5 {
+			var ok bool
+			if callArgs, ok = args[5].([]interface{}); !ok {
+				return CallParams{}, 0, errors.New("execute_kw args must be a list")
+			}
+		}
+		if len(args) > 6 {
+			var ok bool
+			if kwArgs, ok = args[6].(map[string]interface{}); !ok {
+				return CallParams{}, 0, errors.New("execute_kw kwargs must be a dictionary")
+			}
+		}
+	}
+	params.Args = make([]json.RawMessage, len(callArgs))
+	for i, arg := range callArgs {
+		if params.Args[i], err = json.Marshal(arg); err != nil {
+			return CallParams{}, 0, err
+		}
+	}
+	params.KWArgs = make(map[string]json.RawMessage)
+	for key, arg := range kwArgs {
+		if params.KWArgs[key], err = json.Marshal(arg); err != nil {
+			return CallParams{}, 0, err
+		}
+	}
+	return params, uid, nil
+}
+
+// authenticateExternalUser checks that the given password is the password of the
+// user with the given id and returns this id as an int64.
+func authenticateExternalUser(userID, password interface{}) (int64, error) {
+	var uid int64
+	switch u := userID.(type) {
+	case int64:
+		uid = u
+	case float64:
+		uid = int64(u)
+	}
+	secret, _ := password.(string)
+	var login string
+	models.ExecuteInNewEnvironment(security.SuperUserID, func(env models.Environment) {
+		login = pool.User().Search(env, pool.User().ID().Equals(uid)).Login()
+	})
+	if uid == 0 || login == "" {
+		return 0, errors.New("access denied")
+	}
+	authUID, err := security.AuthenticationRegistry.Authenticate(login, secret, new(types.Context))
+	if err != nil || authUID != uid {
+		return 0, errors.New("access denied")
+	}
+	return uid, nil
+}
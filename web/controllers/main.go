@@ -189,6 +189,24 @@ func initRoutes() {
 	root.AddController(http.MethodGet, "/web/login", LoginGet)
 	root.AddController(http.MethodPost, "/web/login", LoginPost)
 	root.AddController(http.MethodGet, "/web/binary/company_logo", CompanyLogo)
+	root.AddController(http.MethodPost, "/xmlrpc/2/common", XMLRPCCommon)
+	root.AddController(http.MethodPost, "/xmlrpc/2/object", XMLRPCObject)
+	root.AddController(http.MethodPost, "/jsonrpc", JSONRPC)
+
+	api := root.AddGroup("/api")
+	{
+		api.AddMiddleWare(APIAuthRequired)
+		api.AddController(http.MethodGet, "/:model", APISearch)
+		api.AddController(http.MethodPost, "/:model", APICreate)
+		api.AddController(http.MethodGet, "/:model/:id", APIRead)
+		api.AddController(http.MethodPatch, "/:model/:id", APIUpdate)
+		api.AddController(http.MethodDelete, "/:model/:id", APIDelete)
+	}
+	apiDoc := root.AddGroup("/apidoc")
+	{
+		apiDoc.AddMiddleWare(APIAuthRequired)
+		apiDoc.AddController(http.MethodGet, "/openapi.json", OpenAPI)
+	}
 
 	root.AddStatic("/static", path.Join(generate.YEPDir, "yep", "server", "static"))
 	web := root.AddGroup("/web")
@@ -196,6 +214,7 @@ func initRoutes() {
 		web.AddMiddleWare(LoginRequired)
 		web.AddController(http.MethodGet, "/", WebClient)
 		web.AddController(http.MethodGet, "/image", Image)
+		web.AddController(http.MethodGet, "/view_cache/stats", ViewCacheStats)
 
 		sess := web.AddGroup("/session")
 		{
@@ -223,6 +242,8 @@ func initRoutes() {
 			dataset.AddController(http.MethodPost, "/call_kw/*path", CallKW)
 			dataset.AddController(http.MethodPost, "/search_read", SearchRead)
 			dataset.AddController(http.MethodPost, "/call_button", CallButton)
+			dataset.AddController(http.MethodPost, "/batch", Batch)
+			dataset.AddController(http.MethodPost, "/search_read_stream", SearchReadStream)
 		}
 		action := web.AddGroup("/action")
 		{
@@ -21,6 +21,7 @@ import (
 
 	"github.com/npiganeau/yep-base/web/domains"
 	"github.com/npiganeau/yep-base/web/odooproxy"
+	"github.com/npiganeau/yep-base/web/rpc"
 	"github.com/npiganeau/yep-base/web/webdata"
 	"github.com/npiganeau/yep/yep/models"
 	"github.com/npiganeau/yep/yep/models/types"
@@ -49,62 +50,92 @@ func Execute(uid int64, params CallParams) (res interface{}, rError error) {
 
 	// Create new Environment with new transaction
 	rError = models.ExecuteInNewEnvironment(uid, func(env models.Environment) {
+		res = execute(env, params)
+	})
 
-		// Create RecordSet from Environment
-		rs, parms, single := createRecordCollection(env, params)
-		ctx := extractContext(params)
-		rs = rs.WithNewContext(&ctx)
-
-		methodName := odooproxy.ConvertMethodName(params.Method)
-
-		// Parse Args and KWArgs using the following logic:
-		// - If 2nd argument of the function is a struct, then:
-		//     * Parse remaining Args in the struct fields
-		//     * Parse KWArgs in the struct fields, possibly overwriting Args
-		// - Else:
-		//     * Parse Args as the function args
-		//     * Ignore KWArgs
-		var fnArgs []interface{}
-		if rs.MethodType(methodName).NumIn() > 1 {
-			fnSecondArgType := rs.MethodType(methodName).In(1)
-			if fnSecondArgType.Kind() == reflect.Struct {
-				// 2nd argument is a struct,
-				fnArgs = make([]interface{}, 1)
-				argStructValue := reflect.New(fnSecondArgType).Elem()
-				putParamsValuesInStruct(&argStructValue, parms)
-				putKWValuesInStruct(&argStructValue, params.KWArgs)
-				fnArgs[0] = argStructValue.Interface()
-			} else {
-				// Second argument is not a struct, so we parse directly in the function args
-				fnArgs = make([]interface{}, len(parms))
-				err := putParamsValuesInArgs(&fnArgs, rs.MethodType(methodName), parms)
-				if err != nil {
-					log.Panic(err.Error(), "method", methodName, "args", parms)
-				}
+	return
+}
+
+// execute calls the method defined by params in the given environment and returns its result.
+// It panics if the method has not been exposed to RPC.
+func execute(env models.Environment, params CallParams) interface{} {
+	modelName := odooproxy.ConvertModelName(params.Model)
+	methodName := odooproxy.ConvertMethodName(params.Method)
+	if !rpc.IsExposed(modelName, methodName) {
+		log.Panic("Access denied: method is not exposed to RPC", "model", modelName, "method", methodName)
+	}
+	return callMethod(env, params)
+}
+
+// ExecuteServerAction executes the method of a server action. Contrary to Execute,
+// it does not check that the method is exposed to RPC since server actions are
+// defined by modules and not by the client.
+func ExecuteServerAction(uid int64, params CallParams) (res interface{}, rError error) {
+	checkUser(uid)
+	rError = models.ExecuteInNewEnvironment(uid, func(env models.Environment) {
+		res = callMethod(env, params)
+	})
+	return
+}
+
+// callMethod calls the method defined by params in the given environment and returns its result.
+// If the result is a RecordSet, its ID(s) are returned instead.
+func callMethod(env models.Environment, params CallParams) (res interface{}) {
+	// Create RecordSet from Environment
+	rs, parms, single := createRecordCollection(env, params)
+	ctx := extractContext(params)
+	rs = rs.WithNewContext(&ctx)
+
+	methodName := odooproxy.ConvertMethodName(params.Method)
+
+	// Parse Args and KWArgs using the following logic:
+	// - If 2nd argument of the function is a struct, then:
+	//     * Parse remaining Args in the struct fields
+	//     * Parse KWArgs in the struct fields, possibly overwriting Args
+	// - Else:
+	//     * Parse Args as the function args
+	//     * Parse KWArgs as the function args, using the parameter
+	//       names declared when the method was exposed to RPC
+	var fnArgs []interface{}
+	if rs.MethodType(methodName).NumIn() > 1 {
+		fnSecondArgType := rs.MethodType(methodName).In(1)
+		if fnSecondArgType.Kind() == reflect.Struct {
+			// 2nd argument is a struct,
+			fnArgs = make([]interface{}, 1)
+			argStructValue := reflect.New(fnSecondArgType).Elem()
+			putParamsValuesInStruct(&argStructValue, parms)
+			putKWValuesInStruct(&argStructValue, params.KWArgs)
+			fnArgs[0] = argStructValue.Interface()
+		} else {
+			// Second argument is not a struct, so we parse directly in the function args
+			paramNames := rpc.ParamNames(rs.ModelName(), methodName)
+			var err error
+			fnArgs, err = putParamsValuesInArgs(rs.MethodType(methodName), parms, params.KWArgs, paramNames)
+			if err != nil {
+				log.Panic(err.Error(), "model", rs.ModelName(), "method", methodName, "args", parms)
 			}
 		}
+	}
 
-		res = rs.Call(methodName, fnArgs...)
+	res = rs.Call(methodName, fnArgs...)
 
-		resVal := reflect.ValueOf(res)
-		if single && resVal.Kind() == reflect.Slice {
-			// Return only the first element of the slice if called with only one id.
-			newRes := reflect.New(resVal.Type().Elem()).Elem()
-			if resVal.Len() > 0 {
-				newRes.Set(resVal.Index(0))
-			}
-			res = newRes.Interface()
+	resVal := reflect.ValueOf(res)
+	if single && resVal.Kind() == reflect.Slice {
+		// Return only the first element of the slice if called with only one id.
+		newRes := reflect.New(resVal.Type().Elem()).Elem()
+		if resVal.Len() > 0 {
+			newRes.Set(resVal.Index(0))
 		}
-		// Return ID(s) if res is a *RecordSet
-		if rec, ok := res.(models.RecordSet); ok {
-			if len(rec.Ids()) == 1 {
-				res = rec.Ids()[0]
-			} else {
-				res = rec.Ids()
-			}
+		res = newRes.Interface()
+	}
+	// Return ID(s) if res is a *RecordSet
+	if rec, ok := res.(models.RecordSet); ok {
+		if len(rec.Ids()) == 1 {
+			res = rec.Ids()[0]
+		} else {
+			res = rec.Ids()
 		}
-	})
-
+	}
 	return
 }
 
@@ -146,30 +177,98 @@ func putKWValuesInStruct(structValue *reflect.Value, kwArgs map[string]json.RawM
 	}
 }
 
-// putParamsValuesInArgs decodes parms and sets fnArgs with the types of methodType arguments
-// and the values of parms, in order.
-func putParamsValuesInArgs(fnArgs *[]interface{}, methodType reflect.Type, parms []json.RawMessage) error {
+// putParamsValuesInArgs decodes parms and kwArgs into function args with the types of
+// methodType arguments. parms are set in order, and kwArgs are set at the position of
+// their key in paramNames. The 'context' key of kwArgs is ignored.
+//
+// Missing arguments of list or object types are set to their empty value. It returns
+// an error naming the faulty parameter if another argument is missing, if an argument
+// is given twice or if it cannot be decoded into the type of the method argument.
+func putParamsValuesInArgs(methodType reflect.Type, parms []json.RawMessage, kwArgs map[string]json.RawMessage,
+	paramNames []string) ([]interface{}, error) {
 	numArgs := methodType.NumIn() - 1
-	for i := 0; i < len(parms); i++ {
-		if (methodType.IsVariadic() && len(parms) < numArgs-1) ||
-			(!methodType.IsVariadic() && len(parms) < numArgs) {
-			// We have less arguments than the arguments of the method
-			return fmt.Errorf("Wrong number of args in non-struct function args (%d instead of %d)", len(parms), numArgs)
+	numFixed := numArgs
+	if methodType.IsVariadic() {
+		numFixed--
+	}
+	values := make([]json.RawMessage, numFixed)
+	if len(parms) > numFixed {
+		if !methodType.IsVariadic() {
+			return nil, fmt.Errorf("Too many args (%d instead of %d)", len(parms), numArgs)
+		}
+		values = make([]json.RawMessage, len(parms))
+	}
+	copy(values, parms)
+	for key, val := range kwArgs {
+		if key == "context" {
+			continue
+		}
+		index := -1
+		for i, name := range paramNames {
+			if name == key {
+				index = i
+				break
+			}
+		}
+		if index < 0 || index >= numFixed {
+			return nil, fmt.Errorf("Unexpected keyword argument '%s'", key)
+		}
+		if index < len(parms) {
+			return nil, fmt.Errorf("Got multiple values for argument '%s'", key)
+		}
+		values[index] = val
+	}
+	fnArgs := make([]interface{}, len(values))
+	for i, value := range values {
+		name := paramName(paramNames, i)
+		methInType := methodType.In(numArgs)
+		if i < numFixed {
+			methInType = methodType.In(i + 1)
+		} else {
+			methInType = methInType.Elem()
 		}
-		methInType := methodType.In(i + 1)
 		if val, ok := typeSubstitutions[methInType]; ok {
 			methInType = val
 		}
-		argsValue := reflect.ValueOf(parms[i])
 		resValue := reflect.New(methInType)
-		if err := unmarshalJSONValue(argsValue, resValue); err != nil {
-			// Same remark as above
-			log.Debug("Unable to unmarshal argument", "error", err)
+		switch string(value) {
+		case "", "false", "null":
+			// Missing arguments or false values sent by the client
+			// for lists or objects are set to their empty value
+			if !canBeEmpty(methInType) {
+				if value == nil {
+					return nil, fmt.Errorf("Missing argument '%s'", name)
+				}
+				break
+			}
+			fnArgs[i] = resValue.Elem().Interface()
 			continue
 		}
-		(*fnArgs)[i] = resValue.Elem().Interface()
+		if err := unmarshalJSONValue(reflect.ValueOf(value), resValue); err != nil {
+			return nil, fmt.Errorf("Invalid value for argument '%s': %s", name, err)
+		}
+		fnArgs[i] = resValue.Elem().Interface()
 	}
-	return nil
+	return fnArgs, nil
+}
+
+// paramName returns the name of the parameter at the given index from
+// the given paramNames, or a name made from its position if it is unknown.
+func paramName(paramNames []string, index int) string {
+	if index < len(paramNames) {
+		return paramNames[index]
+	}
+	return fmt.Sprintf("#%d", index+1)
+}
+
+// canBeEmpty returns true if typ is a type of lists or objects, whose
+// empty value can be given by the client with false or by omitting it.
+func canBeEmpty(typ reflect.Type) bool {
+	switch typ.Kind() {
+	case reflect.Slice, reflect.Map, reflect.Ptr, reflect.Struct:
+		return true
+	}
+	return false
 }
 
 // createRecordCollection creates a RecordCollection instance from the given environment, based
@@ -240,13 +339,14 @@ func getFieldValue(uid, id int64, model, field string) (res interface{}, rError
 
 // searchReadParams is the args struct for the searchRead function.
 type searchReadParams struct {
-	Context types.Context  `json:"context"`
-	Domain  domains.Domain `json:"domain"`
-	Fields  []string       `json:"fields"`
-	Limit   interface{}    `json:"limit"`
-	Model   string         `json:"model"`
-	Offset  int            `json:"offset"`
-	Sort    string         `json:"sort"`
+	Context  types.Context  `json:"context"`
+	Domain   domains.Domain `json:"domain"`
+	Fields   []string       `json:"fields"`
+	Limit    interface{}    `json:"limit"`
+	Model    string         `json:"model"`
+	Offset   int            `json:"offset"`
+	Sort     string         `json:"sort"`
+	Estimate bool           `json:"estimate"`
 }
 
 // searchRead retrieves database records according to the filters defined in params.
@@ -262,12 +362,9 @@ func searchRead(uid int64, params searchReadParams) (res *webdata.SearchReadResu
 			Limit:  params.Limit,
 			Order:  params.Sort,
 		}
-		records := rs.Call("SearchRead", srp).([]models.FieldMap)
-		rSet := rs.Call("AddDomainLimitOffset", srp.Domain, models.ConvertLimitToInt(srp.Limit), srp.Offset, srp.Order).(models.RecordCollection).Fetch()
-		length := rSet.SearchCount()
 		res = &webdata.SearchReadResult{
-			Records: records,
-			Length:  length,
+			Records: rs.Call("SearchRead", srp).([]models.FieldMap),
+			Length:  rs.Call("SearchLength", srp.Domain, params.Estimate).(int),
 		}
 	})
 	return
@@ -0,0 +1,207 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+	"github.com/npiganeau/yep/yep/models"
+	"github.com/npiganeau/yep/yep/models/fieldtype"
+	"github.com/npiganeau/yep/yep/models/types"
+	"github.com/npiganeau/yep/yep/server"
+)
+
+// OpenAPI returns the OpenAPI 3 document of the REST API
+func OpenAPI(c *server.Context) {
+	res, err := openAPISpec(c.MustGet("uid").(int64))
+	if err != nil {
+		apiError(c, http.StatusInternalServerError, err)
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+// openAPISpec generates the OpenAPI 3 document of the REST API from the
+// fields of all the models of the registry but mixins, as seen by the given user.
+func openAPISpec(uid int64) (res gin.H, rError error) {
+	checkUser(uid)
+	paths := make(gin.H)
+	schemas := make(gin.H)
+	rError = models.ExecuteInNewEnvironment(uid, func(env models.Environment) {
+		modelNames := models.Registry.All()
+		sort.Strings(modelNames)
+		for _, modelName := range modelNames {
+			if models.Registry.MustGet(modelName).IsMixin() {
+				continue
+			}
+			fInfos := env.Pool(modelName).Call("FieldsGet", models.FieldsGetArgs{}).(map[string]*models.FieldInfo)
+			schemas[modelName] = openAPIModelSchema(fInfos)
+			ref := gin.H{"$ref": fmt.Sprintf("#/components/schemas/%s", modelName)}
+			paths[fmt.Sprintf("/api/%s", modelName)] = openAPICollectionPath(modelName, ref)
+			paths[fmt.Sprintf("/api/%s/{id}", modelName)] = openAPIRecordPath(modelName, ref)
+		}
+	})
+	res = gin.H{
+		"openapi": "3.0.0",
+		"info": gin.H{
+			"title":   "YEP REST API",
+			"version": "1.0",
+		},
+		"paths": paths,
+		"components": gin.H{
+			"schemas": schemas,
+			"securitySchemes": gin.H{
+				"basicAuth": gin.H{"type": "http", "scheme": "basic"},
+			},
+		},
+		"security": []gin.H{{"basicAuth": []string{}}},
+	}
+	return
+}
+
+// openAPIModelSchema returns the OpenAPI schema of a model with the given fields
+func openAPIModelSchema(fInfos map[string]*models.FieldInfo) gin.H {
+	props := make(gin.H)
+	var required []string
+	for fName, fInfo := range fInfos {
+		prop := openAPIFieldSchema(fInfo)
+		if fInfo.String != "" {
+			prop["title"] = fInfo.String
+		}
+		if fInfo.Help != "" {
+			prop["description"] = fInfo.Help
+		}
+		if fInfo.ReadOnly {
+			prop["readOnly"] = true
+		}
+		if fInfo.Required {
+			required = append(required, fName)
+		}
+		props[fName] = prop
+	}
+	res := gin.H{"type": "object", "properties": props}
+	if len(required) > 0 {
+		sort.Strings(required)
+		res["required"] = required
+	}
+	return res
+}
+
+// openAPIFieldSchema returns the OpenAPI schema of the values of the given field
+func openAPIFieldSchema(fInfo *models.FieldInfo) gin.H {
+	switch fInfo.Type {
+	case fieldtype.Boolean:
+		return gin.H{"type": "boolean"}
+	case fieldtype.Integer:
+		return gin.H{"type": "integer", "format": "int64"}
+	case fieldtype.Float:
+		return gin.H{"type": "number"}
+	case fieldtype.Date:
+		return gin.H{"type": "string", "format": "date"}
+	case fieldtype.DateTime:
+		return gin.H{"type": "string", "format": "date-time"}
+	case fieldtype.Binary:
+		return gin.H{"type": "string", "format": "byte"}
+	case fieldtype.Selection:
+		res := gin.H{"type": "string"}
+		if sel, ok := fInfo.Selection.(types.Selection); ok {
+			values := make([]string, 0, len(sel))
+			for key := range sel {
+				values = append(values, key)
+			}
+			sort.Strings(values)
+			res["enum"] = values
+		}
+		return res
+	case fieldtype.Many2One, fieldtype.One2One, fieldtype.Rev2One:
+		return gin.H{
+			"description": fmt.Sprintf("ID of the related %s record, and its name when read", fInfo.Relation),
+			"oneOf": []gin.H{
+				{"type": "integer", "format": "int64"},
+				{"type": "array", "items": gin.H{}, "minItems": 2, "maxItems": 2},
+			},
+		}
+	case fieldtype.One2Many, fieldtype.Many2Many:
+		return gin.H{
+			"description": fmt.Sprintf("IDs of the related %s records, or a list of commands when written", fInfo.Relation),
+			"type":        "array",
+			"items":       gin.H{},
+		}
+	}
+	return gin.H{"type": "string"}
+}
+
+// openAPICollectionPath returns the OpenAPI path item of the given model collection
+func openAPICollectionPath(modelName string, ref gin.H) gin.H {
+	queryParam := func(name, typ, description string) gin.H {
+		return gin.H{"name": name, "in": "query", "description": description, "schema": gin.H{"type": typ}}
+	}
+	return gin.H{
+		"get": gin.H{
+			"summary": fmt.Sprintf("Search %s records", modelName),
+			"tags":    []string{modelName},
+			"parameters": []gin.H{
+				queryParam("domain", "string", "Search domain as a JSON list"),
+				queryParam("fields", "string", "Comma separated list of fields to read"),
+				queryParam("limit", "integer", "Maximum number of records to return"),
+				queryParam("offset", "integer", "Number of records to skip"),
+				queryParam("order", "string", "Comma separated list of fields to order by"),
+			},
+			"responses": gin.H{
+				"200": openAPIResponse("Matching records", gin.H{
+					"type": "object",
+					"properties": gin.H{
+						"records": gin.H{"type": "array", "items": ref},
+						"length":  gin.H{"type": "integer"},
+					},
+				}),
+			},
+		},
+		"post": gin.H{
+			"summary":     fmt.Sprintf("Create a %s record", modelName),
+			"tags":        []string{modelName},
+			"requestBody": gin.H{"required": true, "content": gin.H{"application/json": gin.H{"schema": ref}}},
+			"responses": gin.H{
+				"201": openAPIResponse("Created record", ref),
+			},
+		},
+	}
+}
+
+// openAPIRecordPath returns the OpenAPI path item of a single record of the given model
+func openAPIRecordPath(modelName string, ref gin.H) gin.H {
+	notFound := gin.H{"description": "Record not found"}
+	return gin.H{
+		"parameters": []gin.H{
+			{"name": "id", "in": "path", "required": true, "schema": gin.H{"type": "integer", "format": "int64"}},
+		},
+		"get": gin.H{
+			"summary":   fmt.Sprintf("Read a %s record", modelName),
+			"tags":      []string{modelName},
+			"responses": gin.H{"200": openAPIResponse("Record", ref), "404": notFound},
+		},
+		"patch": gin.H{
+			"summary":     fmt.Sprintf("Update a %s record", modelName),
+			"tags":        []string{modelName},
+			"requestBody": gin.H{"required": true, "content": gin.H{"application/json": gin.H{"schema": ref}}},
+			"responses":   gin.H{"200": openAPIResponse("Updated record", ref), "404": notFound},
+		},
+		"delete": gin.H{
+			"summary":   fmt.Sprintf("Delete a %s record", modelName),
+			"tags":      []string{modelName},
+			"responses": gin.H{"204": gin.H{"description": "Record deleted"}, "404": notFound},
+		},
+	}
+}
+
+// openAPIResponse returns an OpenAPI JSON response with the given description and schema
+func openAPIResponse(description string, schema gin.H) gin.H {
+	return gin.H{
+		"description": description,
+		"content":     gin.H{"application/json": gin.H{"schema": schema}},
+	}
+}
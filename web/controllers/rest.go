@@ -0,0 +1,223 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/npiganeau/yep-base/web/domains"
+	"github.com/npiganeau/yep/yep/models"
+	"github.com/npiganeau/yep/yep/models/security"
+	"github.com/npiganeau/yep/yep/models/types"
+	"github.com/npiganeau/yep/yep/server"
+)
+
+// APIAuthRequired is a middleware that authenticates the user of REST API
+// calls from HTTP basic authentication credentials. The session of the web
+// client is only accepted for read-only calls, so that cross-site requests
+// cannot modify records. Unauthenticated calls are aborted with a 401 status.
+func APIAuthRequired(c *server.Context) {
+	if login, secret, ok := c.Request.BasicAuth(); ok {
+		if uid, err := security.AuthenticationRegistry.Authenticate(login, secret, new(types.Context)); err == nil {
+			c.Set("uid", uid)
+			return
+		}
+	} else if c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead {
+		if uid, ok := c.Session().Get("uid").(int64); ok {
+			c.Set("uid", uid)
+			return
+		}
+	}
+	c.Header("WWW-Authenticate", `Basic realm="YEP"`)
+	c.JSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+	c.Abort()
+}
+
+// APISearch returns the records of the model matching the query parameters:
+//   - domain: the search domain as a JSON list or a python literal
+//   - fields: comma separated list of the fields to read
+//   - limit, offset: pagination of the results
+//   - order: comma separated list of the fields to order by
+//   - estimate: if "true", the length of the result may be estimated
+func APISearch(c *server.Context) {
+	params := searchReadParams{
+		Model:    c.Param("model"),
+		Limit:    80,
+		Sort:     c.Query("order"),
+		Estimate: c.Query("estimate") == "true",
+	}
+	if fields := c.Query("fields"); fields != "" {
+		params.Fields = strings.Split(fields, ",")
+	}
+	if offset := c.Query("offset"); offset != "" {
+		var err error
+		if params.Offset, err = strconv.Atoi(offset); err != nil {
+			apiError(c, http.StatusBadRequest, fmt.Errorf("invalid offset '%s'", offset))
+			return
+		}
+	}
+	if limit := c.Query("limit"); limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil {
+			apiError(c, http.StatusBadRequest, fmt.Errorf("invalid limit '%s'", limit))
+			return
+		}
+		params.Limit = l
+	}
+	if dom := c.Query("domain"); dom != "" {
+		if err := json.Unmarshal([]byte(dom), &params.Domain); err != nil {
+			if params.Domain, err = domains.ParseLiteral(dom); err != nil {
+				apiError(c, http.StatusBadRequest, fmt.Errorf("invalid domain: %s", err))
+				return
+			}
+		}
+	}
+	res, err := searchRead(c.MustGet("uid").(int64), params)
+	if err != nil {
+		apiError(c, http.StatusBadRequest, err)
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+// APIRead returns the record of the model with the given id.
+// The fields to read can be given as a comma separated list in the fields query parameter.
+func APIRead(c *server.Context) {
+	var fields []string
+	if f := c.Query("fields"); f != "" {
+		fields = strings.Split(f, ",")
+	}
+	res, status, err := apiReadRecord(c.MustGet("uid").(int64), c.Param("model"), c.Param("id"), fields)
+	if err != nil {
+		apiError(c, status, err)
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+// APICreate creates a new record of the model with the values of the request body
+// and returns the created record.
+func APICreate(c *server.Context) {
+	uid := c.MustGet("uid").(int64)
+	body, status, err := apiRequestBody(c)
+	if err != nil {
+		apiError(c, status, err)
+		return
+	}
+	id, err := Execute(uid, CallParams{
+		Model:  c.Param("model"),
+		Method: "create",
+		Args:   []json.RawMessage{body},
+	})
+	if err != nil {
+		apiError(c, http.StatusBadRequest, err)
+		return
+	}
+	res, status, err := apiReadRecord(uid, c.Param("model"), fmt.Sprintf("%d", id), nil)
+	if err != nil {
+		apiError(c, status, err)
+		return
+	}
+	c.JSON(http.StatusCreated, res)
+}
+
+// APIUpdate updates the record of the model with the given id with
+// the values of the request body and returns the updated record.
+func APIUpdate(c *server.Context) {
+	uid := c.MustGet("uid").(int64)
+	if _, status, err := apiReadRecord(uid, c.Param("model"), c.Param("id"), []string{"id"}); err != nil {
+		apiError(c, status, err)
+		return
+	}
+	body, status, err := apiRequestBody(c)
+	if err != nil {
+		apiError(c, status, err)
+		return
+	}
+	_, err = Execute(uid, CallParams{
+		Model:  c.Param("model"),
+		Method: "write",
+		Args:   []json.RawMessage{json.RawMessage(c.Param("id")), body},
+	})
+	if err != nil {
+		apiError(c, http.StatusBadRequest, err)
+		return
+	}
+	res, status, err := apiReadRecord(uid, c.Param("model"), c.Param("id"), nil)
+	if err != nil {
+		apiError(c, status, err)
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+// APIDelete deletes the record of the model with the given id.
+func APIDelete(c *server.Context) {
+	uid := c.MustGet("uid").(int64)
+	if _, status, err := apiReadRecord(uid, c.Param("model"), c.Param("id"), []string{"id"}); err != nil {
+		apiError(c, status, err)
+		return
+	}
+	_, err := Execute(uid, CallParams{
+		Model:  c.Param("model"),
+		Method: "unlink",
+		Args:   []json.RawMessage{json.RawMessage(c.Param("id"))},
+	})
+	if err != nil {
+		apiError(c, http.StatusBadRequest, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// apiReadRecord reads the given fields of the record of the given model with the given id.
+// It returns the record, or an error with the HTTP status to return if it cannot be read.
+func apiReadRecord(uid int64, model, id string, fields []string) (models.FieldMap, int, error) {
+	if _, err := strconv.ParseInt(id, 10, 64); err != nil {
+		return nil, http.StatusBadRequest, fmt.Errorf("invalid id '%s'", id)
+	}
+	fieldsJSON, _ := json.Marshal(fields)
+	res, err := Execute(uid, CallParams{
+		Model:  model,
+		Method: "read",
+		Args:   []json.RawMessage{json.RawMessage(id), fieldsJSON},
+	})
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	rec, ok := res.(models.FieldMap)
+	if !ok || len(rec) == 0 {
+		return nil, http.StatusNotFound, fmt.Errorf("%s record with id %s not found", model, id)
+	}
+	return rec, http.StatusOK, nil
+}
+
+// apiRequestBody returns the JSON object of the request body, or an error
+// with the HTTP status to return if the body is not a JSON object.
+func apiRequestBody(c *server.Context) (json.RawMessage, int, error) {
+	if c.ContentType() != "application/json" {
+		return nil, http.StatusUnsupportedMediaType, errors.New("request body must be of type application/json")
+	}
+	var body map[string]json.RawMessage
+	if err := json.NewDecoder(c.Request.Body).Decode(&body); err != nil {
+		return nil, http.StatusBadRequest, fmt.Errorf("request body must be a JSON object: %s", err)
+	}
+	res, err := json.Marshal(body)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	return res, http.StatusOK, nil
+}
+
+// apiError aborts the current request with the given status and error
+func apiError(c *server.Context, status int, err error) {
+	c.JSON(status, gin.H{"error": err.Error()})
+	c.Abort()
+}
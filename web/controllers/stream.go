@@ -0,0 +1,100 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/npiganeau/yep-base/web/domains"
+	"github.com/npiganeau/yep-base/web/odooproxy"
+	"github.com/npiganeau/yep-base/web/webdata"
+	"github.com/npiganeau/yep/yep/models"
+	"github.com/npiganeau/yep/yep/server"
+)
+
+// searchStreamParams is the args struct for the SearchReadStream controller
+type searchStreamParams struct {
+	Domain    domains.Domain `json:"domain"`
+	Fields    []string       `json:"fields"`
+	Model     string         `json:"model"`
+	Sort      string         `json:"sort"`
+	ChunkSize int            `json:"chunk_size"`
+	Estimate  bool           `json:"estimate"`
+}
+
+// SearchReadStream streams the records matching the domain of the JSON
+// request body as newline delimited JSON. The first line holds the number
+// of matching records as {"length": N}, then each line holds a record.
+//
+// Records are fetched by chunks, each in its own transaction, so that the
+// memory used does not depend on the number of records. If an error occurs
+// while streaming, it is sent as a last {"error": "..."} line.
+func SearchReadStream(c *server.Context) {
+	uid := c.Session().Get("uid").(int64)
+	var params searchStreamParams
+	if err := json.NewDecoder(c.Request.Body).Decode(&params); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("request body must be a JSON object: %s", err)})
+		return
+	}
+	length, err := searchLength(uid, params)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Status(http.StatusOK)
+	enc := json.NewEncoder(c.Writer)
+	if enc.Encode(gin.H{"length": length}) != nil {
+		return
+	}
+	var after int64
+	for {
+		chunk, err := searchReadChunk(uid, params, after)
+		if err != nil {
+			enc.Encode(gin.H{"error": err.Error()})
+			return
+		}
+		for _, rec := range chunk.Records {
+			if enc.Encode(rec) != nil {
+				// The client has gone away
+				return
+			}
+		}
+		c.Writer.Flush()
+		if chunk.Done {
+			return
+		}
+		after = chunk.Last
+	}
+}
+
+// searchLength returns the number of records matching the domain of the given params
+func searchLength(uid int64, params searchStreamParams) (length int, rError error) {
+	checkUser(uid)
+	rError = models.ExecuteInNewEnvironment(uid, func(env models.Environment) {
+		rs := env.Pool(odooproxy.ConvertModelName(params.Model))
+		length = rs.Call("SearchLength", params.Domain, params.Estimate).(int)
+	})
+	return
+}
+
+// searchReadChunk returns the chunk of records matching the given params
+// that comes after the record with the given ID.
+func searchReadChunk(uid int64, params searchStreamParams, after int64) (res webdata.SearchChunkResult, rError error) {
+	checkUser(uid)
+	rError = models.ExecuteInNewEnvironment(uid, func(env models.Environment) {
+		rs := env.Pool(odooproxy.ConvertModelName(params.Model))
+		res = rs.Call("SearchReadChunk", webdata.SearchChunkParams{
+			Domain: params.Domain,
+			Fields: params.Fields,
+			Order:  params.Sort,
+			After:  after,
+			Size:   params.ChunkSize,
+		}).(webdata.SearchChunkResult)
+	})
+	return
+}
@@ -0,0 +1,40 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/npiganeau/yep-base/web/viewcache"
+	"github.com/npiganeau/yep/yep/models/security"
+	"github.com/npiganeau/yep/yep/server"
+)
+
+// ViewCacheStats returns the statistics of the cache of processed views.
+// It is only available to administrators.
+func ViewCacheStats(c *server.Context) {
+	uid := c.Session().Get("uid").(int64)
+	if !isAdmin(uid) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "administrator access required"})
+		return
+	}
+	stats := viewcache.GetStats()
+	c.JSON(http.StatusOK, gin.H{
+		"hits":     stats.Hits,
+		"misses":   stats.Misses,
+		"entries":  stats.Entries,
+		"hit_rate": stats.HitRate(),
+	})
+}
+
+// isAdmin returns true if the given user is a member of the admin group
+func isAdmin(uid int64) bool {
+	for group := range security.Registry.UserGroups(uid) {
+		if group.ID == security.GroupAdminID {
+			return true
+		}
+	}
+	return false
+}
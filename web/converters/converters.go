@@ -0,0 +1,216 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+/*
+Package converters converts the field values received from the client into
+the Go types of the ORM, and the values of the ORM into the values expected
+by the client.
+
+Conversions are driven by the field type given by FieldsGet. Dates and
+datetimes are exchanged with the client as "2006-01-02" and
+"2006-01-02 15:04:05" strings in the timezone of the Converter, and empty
+values are exchanged as false.
+*/
+package converters
+
+import (
+	"encoding/base64"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/npiganeau/yep/yep/models"
+	"github.com/npiganeau/yep/yep/models/fieldtype"
+	"github.com/npiganeau/yep/yep/models/types"
+	"github.com/npiganeau/yep/yep/tools/logging"
+)
+
+// Formats of the dates and datetimes exchanged with the client
+const (
+	DateFormat     = "2006-01-02"
+	DateTimeFormat = "2006-01-02 15:04:05"
+)
+
+var log *logging.Logger
+
+// A Converter converts values between the client and the ORM.
+type Converter struct {
+	// Location is the timezone in which datetimes are exchanged with the client
+	Location *time.Location
+}
+
+// NewConverter returns a Converter for the 'tz' key of the given context.
+// It defaults to UTC if the context has no valid timezone.
+func NewConverter(ctx *types.Context) Converter {
+	tz, _ := ctx.Get("tz").(string)
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		log.Warn("Invalid timezone in context, using UTC", "tz", tz, "error", err)
+		loc = time.UTC
+	}
+	return Converter{Location: loc}
+}
+
+// FromClient converts the given value received from the client into
+// the Go value of a field described by the given FieldInfo.
+//
+// Values that are not JSON decoded values (such as RecordSets or values given
+// by Go code) are returned unchanged. It returns an error if the value cannot
+// be converted.
+func (c Converter) FromClient(value interface{}, info *models.FieldInfo) (interface{}, error) {
+	switch value.(type) {
+	case nil, bool, string, float64, []interface{}, map[string]interface{}:
+	default:
+		return value, nil
+	}
+	if info.Type == fieldtype.Boolean {
+		switch v := value.(type) {
+		case nil:
+			return false, nil
+		case bool:
+			return v, nil
+		}
+		return nil, fmt.Errorf("expected a boolean, got %v", value)
+	}
+	if value == nil || value == false {
+		return nil, nil
+	}
+	switch info.Type {
+	case fieldtype.Integer:
+		return toInt64(value)
+	case fieldtype.Float:
+		switch v := value.(type) {
+		case float64:
+			return v, nil
+		case int64:
+			return float64(v), nil
+		case int:
+			return float64(v), nil
+		}
+		return nil, fmt.Errorf("expected a number, got %v", value)
+	case fieldtype.Char, fieldtype.Text, fieldtype.HTML:
+		if v, ok := value.(string); ok {
+			return v, nil
+		}
+		return nil, fmt.Errorf("expected a string, got %v", value)
+	case fieldtype.Selection:
+		v, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("expected a string, got %v", value)
+		}
+		if sel, ok := info.Selection.(types.Selection); ok {
+			if _, exists := sel[v]; !exists {
+				return nil, fmt.Errorf("'%s' is not a valid selection value", v)
+			}
+		}
+		return v, nil
+	case fieldtype.Date:
+		t, err := c.parseTime(value, DateFormat)
+		if err != nil {
+			return nil, err
+		}
+		return types.Date(t), nil
+	case fieldtype.DateTime:
+		t, err := c.parseTime(value, DateTimeFormat)
+		if err != nil {
+			return nil, err
+		}
+		return types.DateTime(t.UTC()), nil
+	case fieldtype.Binary:
+		v, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("expected a base64 string, got %v", value)
+		}
+		return decodeBinary(v)
+	case fieldtype.Many2One, fieldtype.One2One:
+		if pair, ok := value.([]interface{}); ok && len(pair) == 2 {
+			// (id, name) pair
+			value = pair[0]
+		}
+		return toInt64(value)
+	}
+	return value, nil
+}
+
+// ToClient converts the given Go value of a field described by
+// the given FieldInfo into the value expected by the client.
+func (c Converter) ToClient(value interface{}, info *models.FieldInfo) interface{} {
+	switch v := value.(type) {
+	case nil:
+		return false
+	case types.Date:
+		if time.Time(v).IsZero() {
+			return false
+		}
+		return time.Time(v).Format(DateFormat)
+	case types.DateTime:
+		if time.Time(v).IsZero() {
+			return false
+		}
+		return time.Time(v).In(c.Location).Format(DateTimeFormat)
+	case string:
+		if v == "" && info.Type != fieldtype.Char && info.Type != fieldtype.Text && info.Type != fieldtype.HTML {
+			// Empty selection or binary
+			return false
+		}
+	}
+	return value
+}
+
+// parseTime parses the given value as a time in the given format
+// in the location of this Converter. RFC 3339 strings are also accepted.
+func (c Converter) parseTime(value interface{}, format string) (time.Time, error) {
+	v, ok := value.(string)
+	if !ok {
+		return time.Time{}, fmt.Errorf("expected a date string, got %v", value)
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	if format == DateTimeFormat && len(v) == len(DateFormat) {
+		// Date given for a datetime field
+		format = DateFormat
+	}
+	t, err := time.ParseInLocation(format, v, c.Location)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date '%s', expected format '%s'", v, format)
+	}
+	return t, nil
+}
+
+// decodeBinary checks that the given string is valid base64 data and returns it
+// without a leading data URL prefix and whitespace. Binary fields keep their
+// value base64 encoded.
+func decodeBinary(value string) (string, error) {
+	if strings.HasPrefix(value, "data:") {
+		if i := strings.Index(value, ";base64,"); i >= 0 {
+			value = value[i+len(";base64,"):]
+		}
+	}
+	value = strings.Join(strings.Fields(value), "")
+	if _, err := base64.StdEncoding.DecodeString(value); err != nil {
+		return "", fmt.Errorf("invalid base64 data: %s", err)
+	}
+	return value, nil
+}
+
+// toInt64 converts the given JSON number to an int64
+func toInt64(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case float64:
+		if v != math.Trunc(v) {
+			return nil, fmt.Errorf("expected an integer, got %v", v)
+		}
+		return int64(v), nil
+	case int64:
+		return v, nil
+	case int:
+		return int64(v), nil
+	}
+	return nil, fmt.Errorf("expected an integer, got %v", value)
+}
+
+func init() {
+	log = logging.GetLogger("web")
+}
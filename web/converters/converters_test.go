@@ -0,0 +1,89 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package converters
+
+import (
+	"testing"
+	"time"
+
+	"github.com/npiganeau/yep/yep/models"
+	"github.com/npiganeau/yep/yep/models/fieldtype"
+	"github.com/npiganeau/yep/yep/models/types"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestConverters(t *testing.T) {
+	paris, _ := time.LoadLocation("Europe/Paris")
+	conv := NewConverter(types.NewContext().WithKey("tz", "Europe/Paris"))
+	field := func(typ fieldtype.Type) *models.FieldInfo {
+		return &models.FieldInfo{Type: typ}
+	}
+	Convey("Testing conversion of client values", t, func() {
+		So(conv.Location, ShouldEqual, paris)
+		Convey("Numbers should be converted to the field type", func() {
+			val, err := conv.FromClient(float64(12), field(fieldtype.Integer))
+			So(err, ShouldBeNil)
+			So(val, ShouldEqual, int64(12))
+			_, err = conv.FromClient(12.5, field(fieldtype.Integer))
+			So(err, ShouldNotBeNil)
+			val, err = conv.FromClient(float64(7), field(fieldtype.Many2One))
+			So(err, ShouldBeNil)
+			So(val, ShouldEqual, int64(7))
+			val, err = conv.FromClient([]interface{}{float64(7), "Name"}, field(fieldtype.Many2One))
+			So(err, ShouldBeNil)
+			So(val, ShouldEqual, int64(7))
+		})
+		Convey("False should be converted to nil except for booleans", func() {
+			val, err := conv.FromClient(false, field(fieldtype.Many2One))
+			So(err, ShouldBeNil)
+			So(val, ShouldBeNil)
+			val, err = conv.FromClient(false, field(fieldtype.Char))
+			So(err, ShouldBeNil)
+			So(val, ShouldBeNil)
+			val, err = conv.FromClient(false, field(fieldtype.Boolean))
+			So(err, ShouldBeNil)
+			So(val, ShouldEqual, false)
+		})
+		Convey("Dates and datetimes should be parsed in the converter's timezone", func() {
+			val, err := conv.FromClient("2017-03-15", field(fieldtype.Date))
+			So(err, ShouldBeNil)
+			So(time.Time(val.(types.Date)).Format(DateFormat), ShouldEqual, "2017-03-15")
+			val, err = conv.FromClient("2017-03-15 10:30:00", field(fieldtype.DateTime))
+			So(err, ShouldBeNil)
+			So(time.Time(val.(types.DateTime)), ShouldResemble, time.Date(2017, 3, 15, 9, 30, 0, 0, time.UTC))
+			_, err = conv.FromClient("15/03/2017", field(fieldtype.Date))
+			So(err, ShouldNotBeNil)
+		})
+		Convey("Selections should be checked against the selection values", func() {
+			info := &models.FieldInfo{Type: fieldtype.Selection, Selection: types.Selection{"url": "URL"}}
+			val, err := conv.FromClient("url", info)
+			So(err, ShouldBeNil)
+			So(val, ShouldEqual, "url")
+			_, err = conv.FromClient("ftp", info)
+			So(err, ShouldNotBeNil)
+		})
+		Convey("Binaries should be checked and kept base64 encoded", func() {
+			val, err := conv.FromClient("data:image/png;base64,aGVs\nbG8=", field(fieldtype.Binary))
+			So(err, ShouldBeNil)
+			So(val, ShouldEqual, "aGVsbG8=")
+			_, err = conv.FromClient("not base64!", field(fieldtype.Binary))
+			So(err, ShouldNotBeNil)
+		})
+		Convey("Go values should be returned unchanged", func() {
+			date := types.Date(time.Date(2017, 3, 15, 0, 0, 0, 0, time.UTC))
+			val, err := conv.FromClient(date, field(fieldtype.Date))
+			So(err, ShouldBeNil)
+			So(val, ShouldResemble, date)
+		})
+	})
+	Convey("Testing conversion of values for the client", t, func() {
+		So(conv.ToClient(nil, field(fieldtype.Many2One)), ShouldEqual, false)
+		So(conv.ToClient(types.Date{}, field(fieldtype.Date)), ShouldEqual, false)
+		So(conv.ToClient(types.DateTime(time.Date(2017, 3, 15, 9, 30, 0, 0, time.UTC)), field(fieldtype.DateTime)),
+			ShouldEqual, "2017-03-15 10:30:00")
+		So(conv.ToClient("", field(fieldtype.Selection)), ShouldEqual, false)
+		So(conv.ToClient("", field(fieldtype.Char)), ShouldEqual, "")
+		So(conv.ToClient(int64(3), field(fieldtype.Integer)), ShouldEqual, int64(3))
+	})
+}
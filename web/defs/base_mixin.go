@@ -4,6 +4,7 @@
 package defs
 
 import (
+	"github.com/npiganeau/yep-base/web/rpc"
 	"github.com/npiganeau/yep/pool"
 	"github.com/npiganeau/yep/yep/models"
 )
@@ -11,6 +12,9 @@ import (
 func initBaseMixin() {
 	baseMixin := models.Registry.MustGet("BaseMixin")
 	baseMixin.AddBooleanField("Active", models.SimpleFieldParams{})
+	rpc.RegisterDefault("BaseMixin", "Active", func(env models.Environment) interface{} {
+		return true
+	})
 
 	baseMixin.AddMethod("ToggleActive",
 		`ToggleActive toggles the Active field of this object`,
@@ -21,5 +25,6 @@ func initBaseMixin() {
 				rs.SetActive(true)
 			}
 		})
+	rpc.ExposeMixin("BaseMixin", "ToggleActive")
 
 }
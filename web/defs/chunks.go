@@ -0,0 +1,113 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package defs
+
+import (
+	"strings"
+
+	"github.com/npiganeau/yep/yep/models"
+	"github.com/npiganeau/yep/yep/models/operator"
+)
+
+// defaultChunkSize is the number of records returned by SearchReadChunk
+// when no size is given by the caller.
+const defaultChunkSize = 1000
+
+// An orderTerm is a single field of an order clause
+type orderTerm struct {
+	field string
+	desc  bool
+}
+
+// String returns the order clause of this term
+func (ot orderTerm) String() string {
+	if ot.desc {
+		return ot.field + " desc"
+	}
+	return ot.field
+}
+
+// parseOrderTerms parses the given comma separated order clause.
+// The ID field is appended as last term if it is not already
+// in the clause, so that the order of the records is total.
+func parseOrderTerms(order string) []orderTerm {
+	var res []orderTerm
+	for _, item := range strings.Split(order, ",") {
+		tokens := strings.Fields(item)
+		switch {
+		case len(tokens) == 0:
+			continue
+		case len(tokens) > 2:
+			log.Panic("Invalid order clause", "order", order)
+		}
+		term := orderTerm{field: tokens[0]}
+		if len(tokens) == 2 {
+			switch strings.ToLower(tokens[1]) {
+			case "asc":
+			case "desc":
+				term.desc = true
+			default:
+				log.Panic("Invalid order direction", "order", order, "direction", tokens[1])
+			}
+		}
+		res = append(res, term)
+		if strings.ToLower(term.field) == "id" {
+			// The order is total, following terms are useless
+			return res
+		}
+	}
+	return append(res, orderTerm{field: "ID"})
+}
+
+// orderClause returns the comma separated order clause of the given terms
+func orderClause(terms []orderTerm) string {
+	res := make([]string, len(terms))
+	for i, term := range terms {
+		res[i] = term.String()
+	}
+	return strings.Join(res, ",")
+}
+
+// keysetCondition returns the condition matching the records that come after
+// the given last record when ordered by the given terms, that is:
+//
+//	f1 > v1 OR (f1 = v1 AND (f2 > v2 OR (f2 = v2 AND ... id > vid)))
+//
+// where vi is the value of the field fi of the last record. Descending terms
+// use the lower operator instead. Null values are sorted after all other values
+// as in PostgreSQL, that is last in ascending order and first in descending order.
+func keysetCondition(model *models.Model, terms []orderTerm, last models.RecordCollection) *models.Condition {
+	var cond *models.Condition
+	for i := len(terms) - 1; i >= 0; i-- {
+		term := terms[i]
+		var next *models.Condition
+		if strings.ToLower(term.field) != "id" && !last.Search(model.Field(term.field).IsNull()).IsEmpty() {
+			// Only the records with a null value can follow,
+			// and in descending order all the others.
+			next = model.Field(term.field).IsNull()
+			if cond != nil {
+				next = next.AndCond(cond)
+			}
+			if term.desc {
+				next = model.Field(term.field).IsNotNull().OrCond(next)
+			}
+			cond = next
+			continue
+		}
+		value := last.Get(term.field)
+		op := operator.Greater
+		if term.desc {
+			op = operator.Lower
+		}
+		next = model.Field(term.field).AddOperator(op, value)
+		if !term.desc {
+			next = next.OrCond(model.Field(term.field).IsNull())
+		}
+		if cond != nil {
+			next = next.OrCond(model.Field(term.field).Equals(value).AndCond(cond))
+		}
+		cond = next
+	}
+	return cond
+}
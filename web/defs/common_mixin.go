@@ -5,45 +5,87 @@ package defs
 
 import (
 	"encoding/json"
+	"fmt"
 	"strings"
+	"time"
 
+	"github.com/npiganeau/yep-base/base/i18n"
+	"github.com/npiganeau/yep-base/web/converters"
 	"github.com/npiganeau/yep-base/web/domains"
+	"github.com/npiganeau/yep-base/web/inherit"
+	"github.com/npiganeau/yep-base/web/rpc"
+	"github.com/npiganeau/yep-base/web/viewcache"
 	"github.com/npiganeau/yep-base/web/webdata"
 	"github.com/npiganeau/yep/pool"
 	"github.com/npiganeau/yep/yep/actions"
 	"github.com/npiganeau/yep/yep/models"
 	"github.com/npiganeau/yep/yep/models/fieldtype"
+	"github.com/npiganeau/yep/yep/models/security"
+	"github.com/npiganeau/yep/yep/models/types"
 	"github.com/npiganeau/yep/yep/tools/etree"
 	"github.com/npiganeau/yep/yep/views"
 )
 
 func initCommonMixin() {
 	commonMixin := pool.CommonMixin()
+	// Methods of the ORM that are called by the client
+	rpc.ExposeMixin("CommonMixin", "Unlink")
+	rpc.ExposeMixin("CommonMixin", "Copy", "default")
+	rpc.ExposeMixin("CommonMixin", "NameGet")
+	rpc.ExposeMixin("CommonMixin", "FieldsGet")
+	rpc.ExposeMixin("CommonMixin", "SearchCount")
 
 	commonMixin.Methods().Create().Extend("",
 		func(rs pool.CommonMixinSet, data models.FieldMapper) pool.CommonMixinSet {
 			fMap := rs.ProcessDataValues(data)
+			o2mData := rs.ExtractO2MData(fMap)
 			res := rs.Super().Create(fMap)
+			res.ProcessO2MData(o2mData)
 			return res
 		})
+	rpc.ExposeMixin("CommonMixin", "Create", "vals")
 
 	commonMixin.Methods().Write().Extend("",
 		func(rs pool.CommonMixinSet, data models.FieldMapper, fieldsToUnset ...models.FieldNamer) bool {
+			if rs.Len() > 1 {
+				fMap := data.FieldMap()
+				if rs.PrepareM2MCommands(fMap) {
+					// Some Many2Many commands depend on the current value
+					// of the field, which is different for each record.
+					res := true
+					for _, rec := range rs.Records() {
+						res = rec.Write(fMap, fieldsToUnset...) && res
+					}
+					return res
+				}
+				data = fMap
+			}
 			fMap := rs.ProcessDataValues(data)
+			o2mData := rs.ExtractO2MData(fMap)
 			res := rs.Super().Write(fMap, fieldsToUnset...)
+			rs.ProcessO2MData(o2mData)
 			return res
 		})
+	rpc.ExposeMixin("CommonMixin", "Write", "vals")
 
 	commonMixin.Methods().Read().Extend("",
 		func(rc models.RecordCollection, fields []string) []models.FieldMap {
 			res := rc.Super().Call("Read", fields).([]models.FieldMap)
+			conv := converters.NewConverter(rc.Env().Context())
 			for i, fMap := range res {
 				rec := rc.Model().Search(rc.Env(), rc.Model().Field("ID").Equals(fMap["id"].(int64)))
-				fInfos := rec.Call("FieldsGet", models.FieldsGetArgs{})
-				res[i] = rc.Call("AddNamesToRelations", fMap, fInfos).(models.FieldMap)
+				fInfos := rec.Call("FieldsGet", models.FieldsGetArgs{}).(map[string]*models.FieldInfo)
+				fMap = rc.Call("AddNamesToRelations", fMap, fInfos).(models.FieldMap)
+				for fName, value := range fMap {
+					if fInfo, exists := fInfos[fName]; exists {
+						fMap[fName] = conv.ToClient(value, fInfo)
+					}
+				}
+				res[i] = fMap
 			}
 			return res
 		})
+	rpc.ExposeMixin("CommonMixin", "Read", "fields")
 
 	commonMixin.AddMethod("AddNamesToRelations",
 		`AddNameToRelations returns the given FieldMap after getting the name of all 2one relation ids`,
@@ -80,12 +122,16 @@ func initCommonMixin() {
 
 		This is used for example to provide suggestions based on a partial
 		value for a relational field. Sometimes be seen as the inverse
-		function of NameGet but it is not guaranteed to be.`,
+		function of NameGet but it is not guaranteed to be.
+
+		With the full-text 'search' operator, results are ordered by relevance.`,
 		func(rc models.RecordCollection, params webdata.NameSearchParams) []webdata.RecordIDWithName {
-			searchRs := rc.Model().Search(rc.Env(), rc.Model().Field("Name").AddOperator(params.Operator, params.Name)).Limit(models.ConvertLimitToInt(params.Limit))
-			if extraCondition := domains.ParseDomain(params.Args); extraCondition != nil {
-				searchRs = searchRs.Search(extraCondition)
+			if params.Name != "" && (params.Operator == domains.OperatorSearch || params.Operator == domains.OperatorFullText) {
+				return rc.Call("NameSearchRanked", params).([]webdata.RecordIDWithName)
 			}
+			nameDomain := domains.Domain{[]interface{}{"Name", string(params.Operator), params.Name}}
+			searchDomain := domains.AND(nameDomain, params.Args)
+			searchRs := rc.Model().Search(rc.Env(), parseDomain(rc, searchDomain)).Limit(models.ConvertLimitToInt(params.Limit))
 
 			searchRs.Load("ID", "DisplayName")
 
@@ -96,13 +142,54 @@ func initCommonMixin() {
 			}
 			return res
 		})
+	rpc.ExposeMixin("CommonMixin", "NameSearch")
+
+	commonMixin.AddMethod("NameSearchRanked",
+		`NameSearchRanked is the implementation of NameSearch with the full-text
+		'search' operator. It performs a full-text search of the given name on the
+		search vector of the model (or on its Name field if it has none) and returns
+		the results ordered by relevance.`,
+		func(rc models.RecordCollection, params webdata.NameSearchParams) []webdata.RecordIDWithName {
+			limit := models.ConvertLimitToInt(params.Limit)
+			var res []webdata.RecordIDWithName
+			// Ranked ids are fetched by pages, since some of them may be
+			// filtered out by args or by the access rules of the user.
+			for offset := 0; ; offset += limit {
+				rankedIds := domains.FullTextSearch(rc, params.Name, "Name", limit, offset)
+				if len(rankedIds) == 0 {
+					break
+				}
+				searchDomain := domains.AND(domains.Domain{[]interface{}{"ID", "in", rankedIds}}, params.Args)
+				searchRs := rc.Model().Search(rc.Env(), parseDomain(rc, searchDomain))
+				searchRs.Load("ID", "DisplayName")
+
+				names := make(map[int64]string)
+				for _, rec := range searchRs.Records() {
+					names[rec.Get("id").(int64)] = rec.Get("display_name").(string)
+				}
+				for _, id := range rankedIds {
+					if name, ok := names[id]; ok {
+						res = append(res, webdata.RecordIDWithName{ID: id, Name: name})
+					}
+					if limit > 0 && len(res) >= limit {
+						return res
+					}
+				}
+				if limit <= 0 || len(rankedIds) < limit {
+					break
+				}
+			}
+			return res
+		})
 
 	commonMixin.AddMethod("ProcessDataValues",
 		`ProcessDataValues updates the given data values for Write and Create methods to be
-		compatible with the ORM`,
+		compatible with the ORM. Values received from the client are converted into the
+		Go types of their field.`,
 		func(rs pool.CommonMixinSet, data models.FieldMapper) models.FieldMap {
 			fMap := data.FieldMap()
 			fInfos := rs.FieldsGet(models.FieldsGetArgs{})
+			conv := converters.NewConverter(rs.Env().Context())
 			for f, v := range fMap {
 				fJSON := rs.Model().JSONizeFieldName(f)
 				if _, exists := fInfos[fJSON]; !exists {
@@ -111,43 +198,172 @@ func initCommonMixin() {
 				switch fInfos[fJSON].Type {
 				case fieldtype.Many2Many:
 					fMap[f] = rs.NormalizeM2MData(f, fInfos[fJSON], v)
+				case fieldtype.One2Many:
+					// One2Many values are processed by ProcessO2MData
+				default:
+					val, err := conv.FromClient(v, fInfos[fJSON])
+					if err != nil {
+						log.Panic("Invalid value for field", "model", rs.ModelName(), "field", f, "value", v, "error", err)
+					}
+					fMap[f] = val
 				}
 			}
 			return fMap
 		})
 
 	commonMixin.AddMethod("NormalizeM2MData",
-		`NormalizeM2MData converts the list of triplets received from the client into the final list of ids
-		to keep in the Many2Many relationship of this model through the given field.`,
-		func(rs pool.CommonMixinSet, fieldName string, info *models.FieldInfo, value interface{}) interface{} {
-			switch v := value.(type) {
-			case []interface{}:
-				resSet := rs.Env().Pool(info.Relation)
-				if len(v) == 0 {
-					return resSet
-				}
-				// We assume we have a list of triplets from client
-				for _, triplet := range v {
-					// TODO manage effectively multi-tuple input
-					action := int(triplet.([]interface{})[0].(float64))
-					switch action {
-					case 0:
-					case 1:
-					case 2:
-					case 3:
-					case 4:
-					case 5:
-					case 6:
-						idList := triplet.([]interface{})[2].([]interface{})
-						ids := make([]int64, len(idList))
-						for i, id := range idList {
-							ids[i] = int64(id.(float64))
+		`NormalizeM2MData converts the list of commands received from the client into the final
+		RecordSet to keep in the Many2Many relationship of this model through the given field.
+
+		Commands are applied in order, starting from the current value of the field if this
+		RecordSet is a singleton, or from an empty set otherwise:
+		- (0, 0, values) creates a new related record with the given values and links it
+		- (1, id, values) updates the related record with the given values
+		- (2, id) deletes the related record from the database and removes it
+		- (3, id) removes the related record from the relation without deleting it
+		- (4, id) links the existing record
+		- (5) removes all the records from the relation
+		- (6, 0, ids) replaces the relation by the records with the given ids
+
+		Commands that depend on the current value cannot be applied to several records
+		at once and must have been split with PrepareM2MCommands.`,
+		func(rc models.RecordCollection, fieldName string, info *models.FieldInfo, value interface{}) interface{} {
+			v, ok := value.([]interface{})
+			if !ok {
+				return value
+			}
+			relSet := rc.Env().Pool(info.Relation)
+			commands := executeX2ManyCommands(relSet, parseX2ManyCommands(v))
+			var ids []int64
+			switch {
+			case rc.Len() == 1:
+				ids = rc.Get(fieldName).(models.RecordCollection).Ids()
+			case rc.Len() > 1 && !replacesValue(commands):
+				log.Panic("Many2Many commands depending on the current value cannot be applied to several records",
+					"model", rc.ModelName(), "field", fieldName, "value", value)
+			}
+			for _, cmd := range commands {
+				switch cmd.action {
+				case 3:
+					ids = removeID(ids, cmd.id)
+				case 4:
+					ids = append(removeID(ids, cmd.id), cmd.id)
+				case 5:
+					ids = nil
+				case 6:
+					ids = cmd.ids
+				}
+			}
+			return relSet.Search(relSet.Model().Field("ID").In(ids))
+		})
+
+	commonMixin.AddMethod("PrepareM2MCommands",
+		`PrepareM2MCommands executes the commands of the Many2Many values of the given
+		FieldMap that create, update or delete related records, and replaces these values
+		by the equivalent link commands, so that they can be applied to several records
+		without repeating these operations. It returns true if some of these values depend
+		on the current value of their field, in which case they must be applied to each
+		record separately.`,
+		func(rc models.RecordCollection, fMap models.FieldMap) bool {
+			fInfos := rc.Call("FieldsGet", models.FieldsGetArgs{}).(map[string]*models.FieldInfo)
+			var relative bool
+			for f, v := range fMap {
+				info, ok := fInfos[rc.Model().JSONizeFieldName(f)]
+				if !ok || info.Type != fieldtype.Many2Many {
+					continue
+				}
+				value, ok := v.([]interface{})
+				if !ok {
+					continue
+				}
+				commands := executeX2ManyCommands(rc.Env().Pool(info.Relation), parseX2ManyCommands(value))
+				values := make([]interface{}, len(commands))
+				for i, cmd := range commands {
+					values[i] = cmd.clientValue()
+				}
+				fMap[f] = values
+				relative = relative || !replacesValue(commands)
+			}
+			return relative
+		})
+
+	commonMixin.AddMethod("ExtractO2MData",
+		`ExtractO2MData removes the values of the One2Many fields from the given FieldMap
+		and returns them in a new FieldMap. These values cannot be set by the ORM directly
+		and must be applied with ProcessO2MData once the records are created or updated.`,
+		func(rs pool.CommonMixinSet, fMap models.FieldMap) models.FieldMap {
+			res := make(models.FieldMap)
+			fInfos := rs.FieldsGet(models.FieldsGetArgs{})
+			for f, v := range fMap {
+				fInfo, exists := fInfos[rs.Model().JSONizeFieldName(f)]
+				if !exists {
+					log.Panic("Unable to find field", "model", rs.ModelName(), "field", f)
+				}
+				if fInfo.Type != fieldtype.One2Many {
+					continue
+				}
+				if _, ok := v.([]interface{}); !ok {
+					continue
+				}
+				res[f] = v
+				delete(fMap, f)
+			}
+			return res
+		})
+
+	commonMixin.AddMethod("ProcessO2MData",
+		`ProcessO2MData applies the lists of commands received from the client for the
+		One2Many fields of the given FieldMap to each record of this RecordSet.
+
+		Commands are applied in order and have the same meaning as in NormalizeM2MData,
+		except that removing a record from the relation (3, 5 and 6 commands) unsets
+		its reverse foreign key.`,
+		func(rc models.RecordCollection, o2mData models.FieldMap) {
+			if len(o2mData) == 0 {
+				return
+			}
+			fInfos := rc.Call("FieldsGet", models.FieldsGetArgs{}).(map[string]*models.FieldInfo)
+			for f, v := range o2mData {
+				info := fInfos[rc.Model().JSONizeFieldName(f)]
+				relSet := rc.Env().Pool(info.Relation)
+				reverseFK := relSet.Model().JSONizeFieldName(info.ReverseFK)
+				commands := parseX2ManyCommands(v.([]interface{}))
+				byID := func(id int64) models.RecordCollection {
+					return relSet.Search(relSet.Model().Field("ID").Equals(id))
+				}
+				for _, recID := range rc.Ids() {
+					children := relSet.Search(relSet.Model().Field(info.ReverseFK).Equals(recID))
+					for _, cmd := range commands {
+						switch cmd.action {
+						case 0:
+							values := make(models.FieldMap)
+							for k, val := range cmd.values {
+								values[k] = val
+							}
+							values[reverseFK] = recID
+							relSet.Call("Create", values)
+						case 1:
+							byID(cmd.id).Call("Write", cmd.values)
+						case 2:
+							byID(cmd.id).Call("Unlink")
+						case 3:
+							byID(cmd.id).Call("Write", models.FieldMap{reverseFK: nil})
+						case 4:
+							byID(cmd.id).Call("Write", models.FieldMap{reverseFK: recID})
+						case 5:
+							children.Call("Write", models.FieldMap{reverseFK: nil})
+						case 6:
+							if len(cmd.ids) == 0 {
+								children.Call("Write", models.FieldMap{reverseFK: nil})
+								break
+							}
+							children.Search(relSet.Model().Field("ID").NotIn(cmd.ids)).Call("Write", models.FieldMap{reverseFK: nil})
+							relSet.Search(relSet.Model().Field("ID").In(cmd.ids)).Call("Write", models.FieldMap{reverseFK: recID})
 						}
-						return resSet.Search(resSet.Model().Field("ID").In(ids))
+						children = relSet.Search(relSet.Model().Field(info.ReverseFK).Equals(recID))
 					}
 				}
 			}
-			return value
 		})
 
 	commonMixin.AddMethod("GetFormviewId",
@@ -157,6 +373,7 @@ func initCommonMixin() {
 		func(rs pool.CommonMixinSet) string {
 			return ""
 		})
+	rpc.ExposeMixin("CommonMixin", "GetFormviewId")
 
 	commonMixin.AddMethod("GetFormviewAction",
 		`GetFormviewAction returns an action to open the document.
@@ -175,6 +392,7 @@ func initCommonMixin() {
 				Context:     rs.Env().Context(),
 			}
 		})
+	rpc.ExposeMixin("CommonMixin", "GetFormviewAction")
 
 	commonMixin.AddMethod("FieldsViewGet",
 		`FieldsViewGet is the base implementation of the 'FieldsViewGet' method which
@@ -185,13 +403,51 @@ func initCommonMixin() {
 			if view == nil {
 				view = views.Registry.GetFirstViewForModel(rs.ModelName(), views.ViewType(args.ViewType))
 			}
+			version := viewCacheVersion(rs.Env())
+			cacheKey := viewcache.Key{
+				Model:    rs.ModelName(),
+				ViewType: args.ViewType,
+				Groups:   userGroupsKey(rs.Env().Uid()),
+				Lang:     userLang(rs.Env(), version),
+				Toolbar:  args.Toolbar,
+				Version:  version,
+			}
+			if view != nil {
+				cacheKey.ViewID = view.ID
+				cacheKey.ViewType = string(view.Type)
+				cacheKey.Customizations = customizationsKey(rs.Env(), view.ID, version)
+			}
+			if res, ok := viewcache.Get(cacheKey); ok {
+				res.ViewID = args.ViewID
+				return res
+			}
+			if view == nil {
+				view = rs.DefaultView(views.ViewType(args.ViewType))
+			}
+			arch, err := inherit.Apply(view.ID, view.Arch)
+			if err != nil {
+				// Invalid extensions are reported when views are checked at startup
+				log.Warn("Unable to apply view extensions", "view", view.ID, "error", err)
+			}
+			arch = pool.ViewCustomization().NewSet(rs.Env()).ApplyCustomizations(view.ID, arch, "")
 			cols := make([]models.FieldName, len(view.Fields))
 			for i, f := range view.Fields {
 				cols[i] = models.FieldName(rs.Model().JSONizeFieldName(string(f)))
 			}
+			if arch != view.Arch {
+				cols = viewFieldNames(rs.RecordCollection, arch)
+			}
 			fInfos := rs.FieldsGet(models.FieldsGetArgs{Fields: cols})
-			arch := rs.ProcessView(view.Arch, fInfos)
-			toolbar := rs.GetToolbar()
+			if lang := cacheKey.Lang; lang != "" && lang != defaultLang {
+				fInfos = rs.TranslateFields(fInfos, lang)
+				arch = rs.TranslateView(arch, view.ID, lang)
+			}
+			arch = rs.ProcessView(arch, fInfos)
+			var toolbar *webdata.Toolbar
+			if args.Toolbar {
+				tb := rs.GetToolbar()
+				toolbar = &tb
+			}
 			res := webdata.FieldsViewData{
 				Name:    view.Name,
 				Arch:    arch,
@@ -201,22 +457,133 @@ func initCommonMixin() {
 				Toolbar: toolbar,
 				Fields:  fInfos,
 			}
+			cached := res
+			viewcache.Set(cacheKey, &cached)
 			return &res
 		})
+	rpc.ExposeMixin("CommonMixin", "FieldsViewGet")
+
+	commonMixin.AddMethod("DefaultView",
+		`DefaultView returns a view of the given type generated from the fields
+		of the model. It is used when no view of this type is defined for the model.
+		Supported types are form, tree and search.`,
+		func(rc models.RecordCollection, viewType views.ViewType) *views.View {
+			fInfos := rc.Call("FieldsGet", models.FieldsGetArgs{}).(map[string]*models.FieldInfo)
+			var doc *etree.Document
+			switch viewType {
+			case views.VIEW_TYPE_FORM:
+				doc = defaultFormArch(fInfos)
+			case views.VIEW_TYPE_TREE:
+				doc = defaultTreeArch(fInfos)
+			case views.VIEW_TYPE_SEARCH:
+				doc = defaultSearchArch(fInfos)
+			default:
+				log.Panic("No view of this type defined for model", "model", rc.ModelName(), "type", viewType)
+			}
+			arch, err := doc.WriteToString()
+			if err != nil {
+				log.Panic("Unable to render XML", "error", err)
+			}
+			return &views.View{
+				Name:   fmt.Sprintf("%s.%s.default", rc.ModelName(), viewType),
+				Model:  rc.ModelName(),
+				Type:   viewType,
+				Arch:   arch,
+				Fields: viewFieldNames(rc, arch),
+			}
+		})
 
 	commonMixin.AddMethod("GetToolbar",
-		`GetToolbar returns a toolbar populated with the actions linked to this model`,
+		`GetToolbar returns a toolbar populated with the actions linked to this model:
+		- Print holds the reports,
+		- Relate holds the window actions on another model that show the
+		  records related to the active record (i.e. with active_id in the domain),
+		- Action holds the other window actions and the server actions.`,
 		func(rs pool.CommonMixinSet) webdata.Toolbar {
 			var res webdata.Toolbar
 			for _, a := range actions.Registry.GetActionLinksForModel(rs.ModelName()) {
 				switch a.Type {
-				case actions.ActionActWindow, actions.ActionServer:
+				case actions.ActionReport:
+					res.Print = append(res.Print, a)
+				case actions.ActionActWindow:
+					if a.Model != rs.ModelName() && strings.Contains(a.Domain, "active_id") {
+						res.Relate = append(res.Relate, a)
+						continue
+					}
+					res.Action = append(res.Action, a)
+				case actions.ActionServer:
 					res.Action = append(res.Action, a)
 				}
 			}
 			return res
 		})
 
+	commonMixin.AddMethod("TranslateFields",
+		`TranslateFields returns a copy of the given field infos with their label,
+		help and selection values translated in the given language.`,
+		func(rc models.RecordCollection, fieldInfos map[string]*models.FieldInfo, lang string) map[string]*models.FieldInfo {
+			translation := pool.Translation().NewSet(rc.Env())
+			labels := jsonizeTranslationKeys(rc, translation.GetModelTranslations(lang, i18n.TypeModel, rc.ModelName()))
+			selections := jsonizeTranslationKeys(rc, translation.GetModelTranslations(lang, i18n.TypeSelection, rc.ModelName()))
+			res := make(map[string]*models.FieldInfo, len(fieldInfos))
+			for name, fInfo := range fieldInfos {
+				fi := *fInfo
+				if value, ok := labels[name][fi.String]; ok {
+					fi.String = value
+				}
+				if value, ok := labels[name][fi.Help]; ok {
+					fi.Help = value
+				}
+				if sel, ok := fi.Selection.(types.Selection); ok && len(selections[name]) > 0 {
+					trSel := make(types.Selection, len(sel))
+					for key, label := range sel {
+						trSel[key] = label
+						if value, ok := selections[name][label]; ok {
+							trSel[key] = value
+						}
+					}
+					fi.Selection = trSel
+				}
+				res[name] = &fi
+			}
+			return res
+		})
+
+	commonMixin.AddMethod("TranslateView",
+		`TranslateView returns the given arch of the view with the given ID with its
+		translatable attributes and texts translated in the given language. Terms
+		translated for this view take precedence over the ones of other views.`,
+		func(rc models.RecordCollection, arch, viewID, lang string) string {
+			translation := pool.Translation().NewSet(rc.Env())
+			terms := translation.GetTranslations(lang, i18n.TypeView, "")
+			for source, value := range translation.GetTranslations(lang, i18n.TypeView, viewID) {
+				terms[source] = value
+			}
+			if len(terms) == 0 {
+				return arch
+			}
+			doc := etree.NewDocument()
+			if err := doc.ReadFromString(arch); err != nil {
+				log.Panic("Unable to parse view arch", "arch", arch, "error", err)
+			}
+			for _, elt := range doc.FindElements("//*") {
+				for _, attr := range translatableAttrs {
+					if value, ok := terms[elt.SelectAttrValue(attr, "")]; ok {
+						elt.CreateAttr(attr, value)
+					}
+				}
+				text := strings.TrimSpace(elt.Text())
+				if value, ok := terms[text]; ok && text != "" {
+					elt.SetText(strings.Replace(elt.Text(), text, value, 1))
+				}
+			}
+			res, err := doc.WriteToString()
+			if err != nil {
+				log.Panic("Unable to render XML", "error", err)
+			}
+			return res
+		})
+
 	commonMixin.AddMethod("ProcessView",
 		`ProcessView makes all the necessary modifications to the view
 		arch and returns the new xml string.`,
@@ -228,6 +595,11 @@ func initCommonMixin() {
 			}
 			// Apply changes
 			rs.UpdateFieldNames(doc, &fieldInfos)
+			rs.UpdateRootFieldNames(doc, fieldInfos)
+			rs.UpdateTemplateFieldNames(doc, fieldInfos)
+			rs.ProcessGroups(doc, fieldInfos)
+			rs.UpdateActionButtons(doc)
+			rs.AddOnchanges(doc)
 			rs.AddModifiers(doc, fieldInfos)
 			// Dump xml to string and return
 			res, err := doc.WriteToString()
@@ -237,9 +609,112 @@ func initCommonMixin() {
 			return res
 		})
 
+	commonMixin.AddMethod("UpdateActionButtons",
+		`UpdateActionButtons replaces the references such as %(action_id)d in the
+		name of the action buttons of the given xml doc by the action id.`,
+		func(rc models.RecordCollection, doc *etree.Document) {
+			for _, button := range doc.FindElements("//button[@type='action']") {
+				button.CreateAttr("name", webdata.ActionRef(button.SelectAttrValue("name", "")))
+			}
+		})
+
+	commonMixin.AddMethod("UpdateRootFieldNames",
+		`UpdateRootFieldNames changes the field names in the attributes of the root
+		element of kanban, calendar and gantt views (such as date_start) to their
+		JSON names, and adds these fields to fieldInfos so that they are fetched.`,
+		func(rc models.RecordCollection, doc *etree.Document, fieldInfos map[string]*models.FieldInfo) {
+			root := doc.Root()
+			if root == nil {
+				return
+			}
+			for _, attr := range webdata.RootFieldAttrs[root.Tag] {
+				fieldName := root.SelectAttrValue(attr, "")
+				if fieldName == "" {
+					continue
+				}
+				fieldJSON := rc.Model().JSONizeFieldName(fieldName)
+				root.CreateAttr(attr, fieldJSON)
+				addFieldInfo(rc, fieldInfos, fieldJSON)
+			}
+		})
+
+	commonMixin.AddMethod("UpdateTemplateFieldNames",
+		`UpdateTemplateFieldNames changes the field names used in the QWeb
+		expressions of kanban templates (e.g. record.Name.raw_value) to their
+		JSON names, and adds these fields to fieldInfos so that they are fetched.`,
+		func(rc models.RecordCollection, doc *etree.Document, fieldInfos map[string]*models.FieldInfo) {
+			for _, elt := range doc.FindElements("//templates//*") {
+				for i, attr := range elt.Attr {
+					if !strings.HasPrefix(attr.Key, "t-") {
+						continue
+					}
+					elt.Attr[i].Value = templateFieldRegexp.ReplaceAllStringFunc(attr.Value, func(expr string) string {
+						fieldJSON, ok := jsonizeFieldName(rc, strings.TrimPrefix(expr, "record."))
+						if !ok {
+							// Not a field, e.g. record.id or a typo
+							return expr
+						}
+						addFieldInfo(rc, fieldInfos, fieldJSON)
+						return "record." + fieldJSON
+					})
+				}
+			}
+		})
+
+	commonMixin.AddMethod("ProcessGroups",
+		`ProcessGroups removes from the given xml doc the nodes whose 'groups'
+		attribute is not satisfied by the current user. The fields that are not
+		in the view anymore are removed from fieldInfos, so that they are neither
+		displayed nor fetched by the client.`,
+		func(rc models.RecordCollection, doc *etree.Document, fieldInfos map[string]*models.FieldInfo) {
+			userGroups := make(map[string]bool)
+			for group := range security.Registry.UserGroups(rc.Env().Uid()) {
+				userGroups[group.ID] = true
+			}
+			removedFields := make(map[string]bool)
+			for _, elt := range doc.FindElements("//*[@groups]") {
+				if userInGroups(userGroups, elt.SelectAttrValue("groups", "")) {
+					elt.RemoveAttr("groups")
+					continue
+				}
+				// Fields of sub-views belong to the related model
+				if elt.Tag == "field" && !isEmbeddedField(elt) {
+					removedFields[elt.SelectAttrValue("name", "")] = true
+				}
+				for _, fieldTag := range elt.FindElements(".//field") {
+					if !isEmbeddedField(fieldTag) {
+						removedFields[fieldTag.SelectAttrValue("name", "")] = true
+					}
+				}
+				if parent := elt.Parent(); parent != nil {
+					parent.RemoveChild(elt)
+				}
+			}
+			if len(removedFields) == 0 {
+				return
+			}
+			// Keep the fields that are still present in another node of the view
+			for _, fieldTag := range doc.FindElements("//field") {
+				if !isEmbeddedField(fieldTag) {
+					delete(removedFields, fieldTag.SelectAttrValue("name", ""))
+				}
+			}
+			for field := range removedFields {
+				delete(fieldInfos, field)
+			}
+		})
+
 	commonMixin.AddMethod("AddModifiers",
-		`AddModifiers adds the modifiers attribute nodes to given xml doc.`,
+		`AddModifiers adds the modifiers attribute nodes to given xml doc.
+
+		Modifiers that do not depend on the record are resolved to booleans and only
+		true ones are kept. Other modifiers are domains evaluated by the client: their
+		field names are converted to JSON names, and the fields they depend on are
+		added to fieldInfos if they are not in the view, so that the client can
+		always evaluate them.`,
 		func(rs pool.CommonMixinSet, doc *etree.Document, fieldInfos map[string]*models.FieldInfo) {
+			rc := rs.RecordCollection
+			relatedInfos := make(map[string]map[string]*models.FieldInfo)
 			allModifiers := make(map[*etree.Element]map[string]interface{})
 			// Process attrs on all nodes
 			for _, attrsTag := range doc.FindElements("[@attrs]") {
@@ -251,26 +726,36 @@ func initCommonMixin() {
 				if !exists {
 					mods = map[string]interface{}{"readonly": false, "required": false, "invisible": false}
 				}
-				allModifiers[fieldTag] = rs.ProcessFieldElementModifiers(fieldTag, fieldInfos, mods)
+				// Fields of sub-views are fields of the related model
+				fInfos := fieldInfos
+				if model, topLevel, found := elementModel(rc, fieldTag, fieldInfos, relatedInfos); !topLevel {
+					fInfos = nil
+					if found {
+						fInfos = relatedFieldInfos(model, relatedInfos)
+					}
+				}
+				allModifiers[fieldTag] = rs.ProcessFieldElementModifiers(fieldTag, fInfos, mods)
 			}
 			// Set modifier attributes on elements
 			for element, modifiers := range allModifiers {
-				// Remove false keys
+				resolveModifiers(modifiers)
+				model, topLevel, found := elementModel(rc, element, fieldInfos, relatedInfos)
 				for mod, val := range modifiers {
-					v, ok := val.(bool)
-					if ok && !v {
-						delete(modifiers, mod)
+					dom, ok := val.(domains.Domain)
+					if !ok || !found {
+						continue
 					}
-				}
-				// Remove required if field is invisible or readonly
-				if req, ok := modifiers["required"].(bool); ok && req {
-					inv, ok2 := modifiers["invisible"].(bool)
-					ro, ok3 := modifiers["readonly"].(bool)
-					if ok2 && inv || ok3 && ro {
-						delete(modifiers, "required")
+					modifiers[mod] = jsonizeDomain(model, dom)
+					if !topLevel {
+						// Fields of sub-views are fetched by the client with the sub-view
+						continue
+					}
+					for _, field := range domains.Fields(dom) {
+						if fieldJSON, ok := jsonizeFieldName(rc, strings.Split(field, ".")[0]); ok {
+							addFieldInfo(rc, fieldInfos, fieldJSON)
+						}
 					}
 				}
-
 				modJSON, _ := json.Marshal(modifiers)
 				element.CreateAttr("modifiers", string(modJSON))
 			}
@@ -280,6 +765,7 @@ func initCommonMixin() {
 		`ProcessFieldElementModifiers modifies the given modifiers map by taking into account:
 		- 'invisible', 'readonly' and 'required' attributes in field tags
 		- 'ReadOnly' and 'Required' parameters of the model's field'
+		Modifiers set by these are true whatever the domain given in attrs.
 		It returns the modified map.`,
 		func(rs pool.CommonMixinSet, element *etree.Element, fieldInfos map[string]*models.FieldInfo, modifiers map[string]interface{}) map[string]interface{} {
 			fieldName := element.SelectAttr("name").Value
@@ -291,18 +777,23 @@ func initCommonMixin() {
 				}
 			}
 			// Force modifiers if defined in the model
-			if fieldInfos[fieldName].ReadOnly {
+			fInfo, ok := fieldInfos[fieldName]
+			if !ok {
+				return modifiers
+			}
+			if fInfo.ReadOnly {
 				modifiers["readonly"] = true
 			}
-			if fieldInfos[fieldName].Required {
+			if fInfo.Required {
 				modifiers["required"] = true
 			}
 			return modifiers
 		})
 
 	commonMixin.AddMethod("ProcessElementAttrs",
-		`ProcessElementAttrs returns a modifiers map according to the domain
-		in attrs of the given element`,
+		`ProcessElementAttrs returns a modifiers map according to the domain in attrs
+		of the given element. Domains that do not depend on the record are resolved
+		to booleans, and the other ones are simplified. Empty domains are ignored.`,
 		func(rc models.RecordCollection, element *etree.Element) map[string]interface{} {
 			modifiers := map[string]interface{}{"readonly": false, "required": false, "invisible": false}
 			attrStr := element.SelectAttrValue("attrs", "")
@@ -315,11 +806,14 @@ func initCommonMixin() {
 				log.Panic("Invalid attrs definition", "model", rc.ModelName(), "attrs", attrStr)
 			}
 			for modifier := range modifiers {
-				cond := domains.ParseDomain(attrs[modifier])
-				if cond == nil {
+				if len(attrs[modifier]) == 0 {
 					continue
 				}
-				modifiers[modifier] = attrs[modifier]
+				if value, ok := domains.Constant(attrs[modifier]); ok {
+					modifiers[modifier] = value
+					continue
+				}
+				modifiers[modifier] = domains.Simplify(attrs[modifier])
 			}
 			return modifiers
 		})
@@ -330,13 +824,20 @@ func initCommonMixin() {
 		This method also modifies the fields in the given fieldInfo to match the new name.`,
 		func(rc models.RecordCollection, doc *etree.Document, fieldInfos *map[string]*models.FieldInfo) {
 			for _, fieldTag := range doc.FindElements("//field") {
-				fieldName := fieldTag.SelectAttr("name").Value
+				fieldName := fieldTag.SelectAttrValue("name", "")
+				if fieldName == "" {
+					log.Panic("Field element without name in view", "model", rc.ModelName())
+				}
 				fieldJSON := rc.Model().JSONizeFieldName(fieldName)
 				fieldTag.RemoveAttr("name")
 				fieldTag.CreateAttr("name", fieldJSON)
 			}
 			for _, labelTag := range doc.FindElements("//label") {
-				fieldName := labelTag.SelectAttr("for").Value
+				fieldName := labelTag.SelectAttrValue("for", "")
+				if fieldName == "" {
+					// Labels can have a string instead of a field
+					continue
+				}
 				fieldJSON := rc.Model().JSONizeFieldName(fieldName)
 				labelTag.RemoveAttr("for")
 				labelTag.CreateAttr("for", fieldJSON)
@@ -350,12 +851,73 @@ func initCommonMixin() {
 			records := rSet.Read(params.Fields)
 			return records
 		})
+	rpc.ExposeMixin("CommonMixin", "SearchRead")
+
+	commonMixin.AddMethod("SearchReadChunk",
+		`SearchReadChunk returns the next chunk of at most params.Size records
+		matching params.Domain, starting after the record with ID params.After.
+
+		Chunks are paginated with the values of the order fields of the last
+		record instead of an offset, so that each chunk is fetched with a single
+		indexed query whatever its position in the result set. The ID is always
+		used as the last order field, and null values are sorted after all others.`,
+		func(rc models.RecordCollection, params webdata.SearchChunkParams) webdata.SearchChunkResult {
+			size := params.Size
+			if size <= 0 {
+				size = defaultChunkSize
+			}
+			terms := parseOrderTerms(params.Order)
+			rSet := rc.Call("AddDomainLimitOffset", params.Domain, size, 0, orderClause(terms)).(models.RecordCollection)
+			if params.After != 0 {
+				last := rc.Search(rc.Model().Field("ID").Equals(params.After))
+				if last.IsEmpty() {
+					log.Panic("Unknown record to continue the search from", "model", rc.ModelName(), "after", params.After)
+				}
+				rSet = rSet.Search(keysetCondition(rc.Model(), terms, last))
+			}
+			rSet = rSet.Fetch()
+			res := webdata.SearchChunkResult{
+				Records: rSet.Call("Read", params.Fields).([]models.FieldMap),
+				Last:    params.After,
+				Done:    rSet.Len() < size,
+			}
+			if ids := rSet.Ids(); len(ids) > 0 {
+				res.Last = ids[len(ids)-1]
+			}
+			return res
+		})
+	rpc.ExposeMixin("CommonMixin", "SearchReadChunk")
+
+	commonMixin.AddMethod("SearchLength",
+		`SearchLength returns the number of records matching the given domain
+		with a single count query.
+
+		If estimate is true and the domain is empty, the number of rows estimated
+		by the database planner is returned instead, which is much faster on large
+		tables but may be outdated. Since the estimate does not take record rules
+		into account, it is only returned to administrators.`,
+		func(rc models.RecordCollection, domain domains.Domain, estimate bool) int {
+			searchCond := parseDomain(rc, domain)
+			if searchCond == nil && estimate && pool.User().Search(rc.Env(), pool.User().ID().Equals(rc.Env().Uid())).IsAdmin() {
+				var count int64
+				rc.Env().Cr().Get(&count, "SELECT reltuples::bigint FROM pg_class WHERE relname = ?", rc.Model().TableName())
+				if count >= 0 {
+					// reltuples is -1 if the table has never been analyzed
+					return int(count)
+				}
+			}
+			if searchCond != nil {
+				rc = rc.Search(searchCond)
+			}
+			return rc.SearchCount()
+		})
+	rpc.ExposeMixin("CommonMixin", "SearchLength", "domain", "estimate")
 
 	commonMixin.AddMethod("AddDomainLimitOffset",
 		`AddDomainLimitOffsetOrder adds the given domain, limit, offset
 		and order to the current RecordSet query.`,
 		func(rc models.RecordCollection, domain domains.Domain, limit int, offset int, order string) models.RecordCollection {
-			if searchCond := domains.ParseDomain(domain); searchCond != nil {
+			if searchCond := parseDomain(rc, domain); searchCond != nil {
 				rc = rc.Search(searchCond)
 			}
 			// Limit
@@ -389,5 +951,243 @@ func initCommonMixin() {
 			}
 			return res
 		})
+	rpc.ExposeMixin("CommonMixin", "ReadGroup")
+
+	commonMixin.AddMethod("Onchange",
+		`Onchange runs the onchange methods of the fields given by params.FieldName
+		with the current values of the form, and returns the new values of the
+		modified fields, the new domains and the warnings to display.
+
+		params.FieldName is the name of the modified field, or the list of all the
+		fields when the form is initialized. Only the fields whose onchange spec in
+		params.Fields is set are processed. Fields modified by an onchange method
+		trigger their own onchange method in turn.`,
+		func(rc models.RecordCollection, params webdata.OnchangeParams) webdata.OnchangeResult {
+			if params.Context != nil {
+				rc = rc.WithNewContext(params.Context)
+			}
+			fInfos := rc.Call("FieldsGet", models.FieldsGetArgs{}).(map[string]*models.FieldInfo)
+			conv := converters.NewConverter(rc.Env().Context())
+			methods := make(map[string]string)
+			for field, method := range rpc.Onchanges(rc.ModelName()) {
+				methods[rc.Model().JSONizeFieldName(field)] = method
+			}
+			values := make(models.FieldMap)
+			for f, v := range params.Values {
+				fInfo, exists := fInfos[f]
+				if !exists || fInfo.Type.Is2ManyRelationType() {
+					values[f] = v
+					continue
+				}
+				val, err := conv.FromClient(v, fInfo)
+				if err != nil {
+					log.Panic("Invalid value for field", "model", rc.ModelName(), "field", f, "value", v, "error", err)
+				}
+				values[f] = val
+			}
+			var queue []string
+			switch fName := params.FieldName.(type) {
+			case string:
+				queue = []string{fName}
+			case []interface{}:
+				for _, f := range fName {
+					if fStr, ok := f.(string); ok {
+						queue = append(queue, fStr)
+					}
+				}
+			}
+			res := webdata.OnchangeResult{
+				Value:  make(models.FieldMap),
+				Domain: make(map[string]domains.Domain),
+			}
+			done := make(map[string]bool)
+			for len(queue) > 0 {
+				field := queue[0]
+				queue = queue[1:]
+				method, ok := methods[field]
+				spec := params.Fields[field]
+				if done[field] || !ok || spec == "" || spec == "0" {
+					continue
+				}
+				done[field] = true
+				changes := rc.Call(method, values).(webdata.OnchangeResult)
+				for f, v := range changes.Value {
+					fJSON := rc.Model().JSONizeFieldName(f)
+					values[fJSON] = v
+					if fInfo, exists := fInfos[fJSON]; exists {
+						v = conv.ToClient(v, fInfo)
+					}
+					res.Value[fJSON] = v
+					queue = append(queue, fJSON)
+				}
+				for f, dom := range changes.Domain {
+					res.Domain[rc.Model().JSONizeFieldName(f)] = dom
+				}
+				switch {
+				case changes.Warning == nil:
+				case res.Warning == nil:
+					res.Warning = changes.Warning
+				default:
+					res.Warning.Message += "\n\n" + changes.Warning.Message
+				}
+			}
+			return res
+		})
+	rpc.ExposeMixin("CommonMixin", "Onchange")
+
+	commonMixin.AddMethod("DefaultGet",
+		`DefaultGet returns the default values of the given fields for a new record,
+		converted for the client. Default values are taken in order of precedence from:
+		- the 'default_<field>' keys of the context,
+		- the defaults saved by the users with DefaultValue.SetDefault,
+		- the DefaultFunc registered for the field.`,
+		func(rc models.RecordCollection, fields []string) models.FieldMap {
+			fInfos := rc.Call("FieldsGet", models.FieldsGetArgs{}).(map[string]*models.FieldInfo)
+			conv := converters.NewConverter(rc.Env().Context())
+			defaultFuncs := make(map[string]rpc.DefaultFunc)
+			for field, fn := range rpc.Defaults(rc.ModelName()) {
+				defaultFuncs[rc.Model().JSONizeFieldName(field)] = fn
+			}
+			savedDefaults := make(map[string]interface{})
+			savedValues := rc.Env().Pool("DefaultValue").Call("GetDefaults", rc.ModelName()).(map[string]interface{})
+			for field, value := range savedValues {
+				savedDefaults[rc.Model().JSONizeFieldName(field)] = value
+			}
+			res := make(models.FieldMap)
+			for _, f := range fields {
+				fJSON := rc.Model().JSONizeFieldName(f)
+				fInfo, exists := fInfos[fJSON]
+				if !exists {
+					continue
+				}
+				if ctxKey := "default_" + fJSON; rc.Env().Context().HasKey(ctxKey) {
+					res[fJSON] = rc.Env().Context().Get(ctxKey)
+					continue
+				}
+				if value, ok := savedDefaults[fJSON]; ok {
+					// Saved defaults are stored as client values in UTC
+					val, err := converters.Converter{Location: time.UTC}.FromClient(value, fInfo)
+					if err == nil {
+						res[fJSON] = conv.ToClient(val, fInfo)
+						continue
+					}
+					log.Warn("Invalid saved default value", "model", rc.ModelName(), "field", fJSON, "error", err)
+				}
+				if fn, ok := defaultFuncs[fJSON]; ok {
+					res[fJSON] = conv.ToClient(fn(rc.Env()), fInfo)
+				}
+			}
+			return res
+		})
+	rpc.ExposeMixin("CommonMixin", "DefaultGet", "fields")
+
+	commonMixin.AddMethod("AddOnchanges",
+		`AddOnchanges sets the on_change attribute of the field nodes of the given xml doc
+		whose field has an onchange method, so that the client calls Onchange when they
+		are modified.`,
+		func(rc models.RecordCollection, doc *etree.Document) {
+			onchanges := make(map[string]bool)
+			for field := range rpc.Onchanges(rc.ModelName()) {
+				onchanges[rc.Model().JSONizeFieldName(field)] = true
+			}
+			for _, fieldTag := range doc.FindElements("//field") {
+				if !onchanges[fieldTag.SelectAttrValue("name", "")] {
+					continue
+				}
+				fieldTag.RemoveAttr("on_change")
+				fieldTag.CreateAttr("on_change", "1")
+			}
+		})
+
+}
+
+// userGroupsKey returns the Groups value of a view cache key for the given user
+func userGroupsKey(uid int64) string {
+	var groupIDs []string
+	for group := range security.Registry.UserGroups(uid) {
+		groupIDs = append(groupIDs, group.ID)
+	}
+	return viewcache.GroupsKey(groupIDs)
+}
+
+// customizationsKey returns the Customizations value of a view cache key for the
+// view with the given ID and the current user of the given environment. It is
+// cached in the view cache for the given data version.
+func customizationsKey(env models.Environment, viewID string, version int64) string {
+	name := "customizations:" + viewID
+	if key, ok := viewcache.GetUserValue(env.Uid(), version, name); ok {
+		return key
+	}
+	custos := pool.ViewCustomization().NewSet(env).GetCustomizations(viewID)
+	ids := make([]int64, len(custos))
+	for i, custo := range custos {
+		ids[i] = custo.ID
+	}
+	key := viewcache.IDsKey(ids)
+	viewcache.SetUserValue(env.Uid(), version, name, key)
+	return key
+}
+
+// userInGroups returns true if a user member of the given groups satisfies
+// the given 'groups' attribute value. This value is a comma separated list of
+// group IDs, which may be prefixed by '!' to exclude the members of the group.
+// The user must not be a member of any excluded group, and must be a member
+// of at least one of the other groups if there are any.
+func userInGroups(userGroups map[string]bool, groups string) bool {
+	var included []string
+	for _, group := range strings.Split(groups, ",") {
+		group = strings.TrimSpace(group)
+		switch {
+		case group == "":
+		case strings.HasPrefix(group, "!"):
+			if userGroups[strings.TrimPrefix(group, "!")] {
+				return false
+			}
+		default:
+			included = append(included, group)
+		}
+	}
+	for _, group := range included {
+		if userGroups[group] {
+			return true
+		}
+	}
+	return len(included) == 0
+}
+
+// viewFieldNames returns the JSON names of the fields of the given arch,
+// excluding the fields of the embedded views of relation fields.
+func viewFieldNames(rc models.RecordCollection, arch string) []models.FieldName {
+	doc := etree.NewDocument()
+	if err := doc.ReadFromString(arch); err != nil {
+		log.Panic("Unable to parse view arch", "arch", arch, "error", err)
+	}
+	var res []models.FieldName
+	for _, fieldTag := range doc.FindElements("//field") {
+		if !isEmbeddedField(fieldTag) {
+			res = append(res, models.FieldName(rc.Model().JSONizeFieldName(fieldTag.SelectAttrValue("name", ""))))
+		}
+	}
+	return res
+}
+
+// isEmbeddedField returns true if the given field element is inside another
+// field element, i.e. in the sub-view of a relation field.
+func isEmbeddedField(fieldTag *etree.Element) bool {
+	for parent := fieldTag.Parent(); parent != nil; parent = parent.Parent() {
+		if parent.Tag == "field" {
+			return true
+		}
+	}
+	return false
+}
 
+// parseDomain resolves the placeholders and custom operators of the given domain
+// and parses it into a Condition on the model of the given RecordCollection.
+// Returns nil if the domain is empty.
+func parseDomain(rc models.RecordCollection, dom domains.Domain) *models.Condition {
+	ctx := rc.Env().Context().WithKey("uid", rc.Env().Uid())
+	dom = domains.ResolvePlaceholders(dom, ctx)
+	dom = domains.ResolveOperators(dom, rc)
+	return domains.ParseDomain(dom)
 }
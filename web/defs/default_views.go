@@ -0,0 +1,122 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package defs
+
+import (
+	"sort"
+
+	"github.com/npiganeau/yep/yep/models"
+	"github.com/npiganeau/yep/yep/models/fieldtype"
+	"github.com/npiganeau/yep/yep/tools/etree"
+)
+
+// automaticFields are the fields managed by the ORM that
+// are not shown in the default views.
+var automaticFields = map[string]bool{
+	"id":            true,
+	"display_name":  true,
+	"create_date":   true,
+	"create_uid":    true,
+	"write_date":    true,
+	"write_uid":     true,
+	"__last_update": true,
+}
+
+// defaultViewFields returns the JSON names of the given fields that
+// can be displayed in a default view, sorted alphabetically.
+func defaultViewFields(fInfos map[string]*models.FieldInfo) []string {
+	var res []string
+	for name := range fInfos {
+		if automaticFields[name] {
+			continue
+		}
+		res = append(res, name)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// isFullWidthField returns true if the given field is displayed in its own
+// notebook page instead of the groups of a default form view.
+func isFullWidthField(fInfo *models.FieldInfo) bool {
+	return fInfo.Type.Is2ManyRelationType() || fInfo.Type == fieldtype.Text || fInfo.Type == fieldtype.HTML
+}
+
+// defaultFormArch returns the arch of a default form view for the given fields.
+// The name field is the title of the form. Other simple fields are split in
+// two columns, and text and 2many fields are displayed in notebook pages.
+func defaultFormArch(fInfos map[string]*models.FieldInfo) *etree.Document {
+	doc := etree.NewDocument()
+	sheet := doc.CreateElement("form").CreateElement("sheet")
+	if _, ok := fInfos["name"]; ok {
+		title := sheet.CreateElement("div")
+		title.CreateAttr("class", "oe_title")
+		title.CreateElement("h1").CreateElement("field").CreateAttr("name", "name")
+	}
+	var simple, fullWidth []string
+	for _, name := range defaultViewFields(fInfos) {
+		switch {
+		case name == "name":
+		case isFullWidthField(fInfos[name]):
+			fullWidth = append(fullWidth, name)
+		default:
+			simple = append(simple, name)
+		}
+	}
+	if len(simple) > 0 {
+		group := sheet.CreateElement("group")
+		half := (len(simple) + 1) / 2
+		for _, column := range [][]string{simple[:half], simple[half:]} {
+			colGroup := group.CreateElement("group")
+			for _, name := range column {
+				colGroup.CreateElement("field").CreateAttr("name", name)
+			}
+		}
+	}
+	if len(fullWidth) > 0 {
+		notebook := sheet.CreateElement("notebook")
+		for _, name := range fullWidth {
+			page := notebook.CreateElement("page")
+			page.CreateAttr("string", fInfos[name].String)
+			field := page.CreateElement("field")
+			field.CreateAttr("name", name)
+			field.CreateAttr("nolabel", "1")
+		}
+	}
+	return doc
+}
+
+// defaultTreeArch returns the arch of a default tree view for the given fields,
+// with the name field and the required fields.
+func defaultTreeArch(fInfos map[string]*models.FieldInfo) *etree.Document {
+	doc := etree.NewDocument()
+	tree := doc.CreateElement("tree")
+	var names []string
+	if _, ok := fInfos["name"]; ok {
+		names = append(names, "name")
+	}
+	for _, name := range defaultViewFields(fInfos) {
+		if name != "name" && fInfos[name].Required && !fInfos[name].Type.Is2ManyRelationType() {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		names = append(names, "display_name")
+	}
+	for _, name := range names {
+		tree.CreateElement("field").CreateAttr("name", name)
+	}
+	return doc
+}
+
+// defaultSearchArch returns the arch of a default search view
+// for the given fields, which searches on the name field.
+func defaultSearchArch(fInfos map[string]*models.FieldInfo) *etree.Document {
+	doc := etree.NewDocument()
+	search := doc.CreateElement("search")
+	if _, ok := fInfos["name"]; ok {
+		search.CreateElement("field").CreateAttr("name", "name")
+	}
+	return doc
+}
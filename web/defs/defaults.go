@@ -0,0 +1,42 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package defs
+
+import (
+	"time"
+
+	"github.com/npiganeau/yep-base/web/converters"
+	"github.com/npiganeau/yep-base/web/odooproxy"
+	"github.com/npiganeau/yep-base/web/rpc"
+	"github.com/npiganeau/yep/pool"
+	"github.com/npiganeau/yep/yep/models"
+)
+
+func initDefaultValues() {
+	defaultValue := pool.DefaultValue()
+
+	defaultValue.Methods().SetDefault().Extend("",
+		func(rs pool.DefaultValueSet, modelName, fieldName string, value interface{}, forAllUsers bool,
+			companyID interface{}, condition interface{}) {
+			// The client gives the Odoo model name
+			modelName = odooproxy.ConvertModelName(modelName)
+			rc := rs.Env().Pool(modelName)
+			fieldName = rc.Model().JSONizeFieldName(fieldName)
+			fInfos := rc.Call("FieldsGet", models.FieldsGetArgs{}).(map[string]*models.FieldInfo)
+			fInfo, exists := fInfos[fieldName]
+			if !exists {
+				log.Panic("Unknown field", "model", modelName, "field", fieldName)
+			}
+			val, err := converters.NewConverter(rs.Env().Context()).FromClient(value, fInfo)
+			if err != nil {
+				log.Panic("Invalid default value", "model", modelName, "field", fieldName, "value", value, "error", err)
+			}
+			// Saved defaults are stored as client values in UTC
+			// so that they can be converted back for any user
+			value = converters.Converter{Location: time.UTC}.ToClient(val, fInfo)
+			rs.Super().SetDefault(modelName, fieldName, value, forAllUsers, companyID, condition)
+		})
+	rpc.Expose("DefaultValue", "SetDefault", "model", "field_name", "value", "for_all_users", "company_id", "condition")
+	rpc.Restrict("DefaultValue")
+}
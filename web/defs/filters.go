@@ -0,0 +1,28 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package defs
+
+import (
+	"github.com/npiganeau/yep-base/web/domains"
+	"github.com/npiganeau/yep-base/web/odooproxy"
+	"github.com/npiganeau/yep/pool"
+	"github.com/npiganeau/yep/yep/models"
+)
+
+func initFilters() {
+	filter := pool.Filter()
+
+	filter.AddMethod("GetCondition",
+		`GetCondition returns the search Condition of this filter on its ResModel,
+		with the placeholders of its domain evaluated in the current context.
+		Returns nil if the filter's domain is empty.`,
+		func(rs pool.FilterSet) *models.Condition {
+			rs.EnsureOne()
+			dom, err := domains.ParseLiteral(rs.Domain())
+			if err != nil {
+				log.Panic("Invalid filter domain", "filter", rs.Name(), "domain", rs.Domain(), "error", err)
+			}
+			return parseDomain(rs.Env().Pool(odooproxy.ConvertModelName(rs.ResModel())), dom)
+		})
+}
@@ -11,4 +11,12 @@ func init() {
 	log = logging.GetLogger("web")
 	initCommonMixin()
 	initBaseMixin()
+	initFilters()
+	initUser()
+	initDefaultValues()
+	initViewCustomizations()
+	initTranslations()
+	initViewCache()
+	initSearchVectors()
+	initRPC()
 }
@@ -0,0 +1,100 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package defs
+
+import (
+	"strings"
+
+	"github.com/npiganeau/yep-base/web/domains"
+	"github.com/npiganeau/yep/yep/models"
+	"github.com/npiganeau/yep/yep/tools/etree"
+)
+
+// resolveModifiers removes the false modifiers of the given map, as well as
+// the required modifier if the element is always invisible or readonly.
+func resolveModifiers(modifiers map[string]interface{}) {
+	for mod, val := range modifiers {
+		if v, ok := val.(bool); ok && !v {
+			delete(modifiers, mod)
+		}
+	}
+	inv, _ := modifiers["invisible"].(bool)
+	ro, _ := modifiers["readonly"].(bool)
+	if inv || ro {
+		delete(modifiers, "required")
+	}
+}
+
+// elementModel returns the model of the records to which the given element of
+// a view of the model of rc applies, and true if it is the model of the view.
+// Elements of the sub-views of relation fields apply to the related model.
+// The last returned value is false if the model cannot be determined.
+// The field infos of the related models are cached in the given map.
+func elementModel(rc models.RecordCollection, elt *etree.Element, fieldInfos map[string]*models.FieldInfo,
+	cache map[string]map[string]*models.FieldInfo) (models.RecordCollection, bool, bool) {
+	parent := elt.Parent()
+	for parent != nil && parent.Tag != "field" {
+		parent = parent.Parent()
+	}
+	if parent == nil {
+		return rc, true, true
+	}
+	parentModel, topLevel, found := elementModel(rc, parent, fieldInfos, cache)
+	if !found {
+		return rc, false, false
+	}
+	fInfos := fieldInfos
+	if !topLevel {
+		fInfos = relatedFieldInfos(parentModel, cache)
+	}
+	fInfo, ok := fInfos[parent.SelectAttrValue("name", "")]
+	if !ok || fInfo.Relation == "" {
+		return rc, false, false
+	}
+	return rc.Env().Pool(fInfo.Relation), false, true
+}
+
+// relatedFieldInfos returns the field infos of the model of rc,
+// and caches them in the given map by model name.
+func relatedFieldInfos(rc models.RecordCollection, cache map[string]map[string]*models.FieldInfo) map[string]*models.FieldInfo {
+	if fInfos, ok := cache[rc.ModelName()]; ok {
+		return fInfos
+	}
+	fInfos := rc.Call("FieldsGet", models.FieldsGetArgs{}).(map[string]*models.FieldInfo)
+	cache[rc.ModelName()] = fInfos
+	return fInfos
+}
+
+// jsonizeDomain returns a copy of the given domain on the model of rc where
+// the field names of the terms are JSON names. Only the first field of field
+// paths is converted.
+func jsonizeDomain(rc models.RecordCollection, dom domains.Domain) domains.Domain {
+	res := make(domains.Domain, len(dom))
+	for i, token := range dom {
+		res[i] = token
+		var term []interface{}
+		switch t := token.(type) {
+		case []interface{}:
+			term = t
+		case domains.DomainTerm:
+			term = t
+		default:
+			continue
+		}
+		if len(term) == 0 {
+			continue
+		}
+		field, ok := term[0].(string)
+		if !ok {
+			continue
+		}
+		path := strings.SplitN(field, ".", 2)
+		if fieldJSON, ok := jsonizeFieldName(rc, path[0]); ok {
+			path[0] = fieldJSON
+		}
+		newTerm := append([]interface{}{strings.Join(path, ".")}, term[1:]...)
+		res[i] = newTerm
+	}
+	return res
+}
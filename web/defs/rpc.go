@@ -0,0 +1,12 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package defs
+
+import "github.com/npiganeau/yep-base/web/rpc"
+
+// initRPC declares the methods of the base models that are called by the web client
+func initRPC() {
+	rpc.Expose("Filter", "GetFilters", "model", "action_id")
+	rpc.Expose("User", "ContextGet")
+}
@@ -0,0 +1,17 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package defs
+
+import "github.com/npiganeau/yep-base/web/domains"
+
+func initSearchVectors() {
+	domains.RegisterSearchVector("Partner", domains.SearchVector{
+		Fields: map[string]string{
+			"Name":  "A",
+			"Email": "B",
+			"Ref":   "B",
+			"City":  "C",
+		},
+	})
+}
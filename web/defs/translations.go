@@ -0,0 +1,55 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package defs
+
+import (
+	"github.com/npiganeau/yep-base/web/rpc"
+	"github.com/npiganeau/yep-base/web/viewcache"
+	"github.com/npiganeau/yep/pool"
+	"github.com/npiganeau/yep/yep/models"
+)
+
+// defaultLang is the language in which the terms are written in the
+// source code and views. They need no translation in this language.
+const defaultLang = "en_US"
+
+// translatableAttrs are the attributes of the view elements that are translated
+var translatableAttrs = []string{"string", "help", "sum", "confirm", "placeholder"}
+
+// userLang returns the language of the current user of the given
+// environment, as set in the user's context. The language is cached
+// in the view cache for the given data version.
+func userLang(env models.Environment, version int64) string {
+	if lang, ok := viewcache.GetUserValue(env.Uid(), version, "lang"); ok {
+		return lang
+	}
+	var lang string
+	user := pool.User().Search(env, pool.User().ID().Equals(env.Uid()))
+	if !user.IsEmpty() {
+		lang, _ = user.ContextGet().Get("lang").(string)
+	}
+	viewcache.SetUserValue(env.Uid(), version, "lang", lang)
+	return lang
+}
+
+// jsonizeTranslationKeys returns the given translations by field name with
+// the JSON names of the fields of the model of rc. Translations of fields
+// that do not exist are dropped.
+func jsonizeTranslationKeys(rc models.RecordCollection, translations map[string]map[string]string) map[string]map[string]string {
+	res := make(map[string]map[string]string, len(translations))
+	for field, terms := range translations {
+		fieldJSON, ok := jsonizeFieldName(rc, field)
+		if !ok {
+			log.Warn("Translation of unknown field", "model", rc.ModelName(), "field", field)
+			continue
+		}
+		res[fieldJSON] = terms
+	}
+	return res
+}
+
+func initTranslations() {
+	// Translations are only modified by administrators and loaded from .po files
+	rpc.Restrict("Translation")
+}
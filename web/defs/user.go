@@ -0,0 +1,28 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package defs
+
+import (
+	"net/mail"
+
+	"github.com/npiganeau/yep-base/web/rpc"
+	"github.com/npiganeau/yep-base/web/webdata"
+	"github.com/npiganeau/yep/pool"
+	"github.com/npiganeau/yep/yep/models"
+)
+
+func initUser() {
+	user := pool.User()
+
+	user.AddMethod("OnchangeLogin",
+		`OnchangeLogin sets the email of the user to its login if it is an email address`,
+		func(rs pool.UserSet, values models.FieldMap) webdata.OnchangeResult {
+			login, _ := values["login"].(string)
+			if addr, err := mail.ParseAddress(login); err != nil || addr.Address != login {
+				return webdata.OnchangeResult{}
+			}
+			return webdata.OnchangeResult{Value: models.FieldMap{"Email": login}}
+		})
+	rpc.RegisterOnchange("User", "Login", "OnchangeLogin")
+}
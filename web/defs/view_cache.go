@@ -0,0 +1,108 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package defs
+
+import (
+	"fmt"
+
+	"github.com/npiganeau/yep-base/web/rpc"
+	"github.com/npiganeau/yep-base/web/viewcache"
+	"github.com/npiganeau/yep/pool"
+	"github.com/npiganeau/yep/yep/models"
+)
+
+// viewCacheVersion returns the version of the data the views are processed
+// from, as seen by the transaction of the given environment.
+func viewCacheVersion(env models.Environment) int64 {
+	var version int64
+	env.Cr().Get(&version, fmt.Sprintf("SELECT coalesce(max(version), 0) FROM %s",
+		pool.ViewCacheVersion().NewSet(env).Model().TableName()))
+	return version
+}
+
+// updateViewCacheVersion sets a new version of the data the views are processed
+// from in the transaction of the given environment. Other transactions only see
+// it once committed. It is taken from a sequence so that the version of a
+// transaction that is rolled back is never used again.
+func updateViewCacheVersion(env models.Environment) {
+	table := pool.ViewCacheVersion().NewSet(env).Model().TableName()
+	env.Cr().Execute(fmt.Sprintf(`INSERT INTO %[1]s (id, version) VALUES (1, nextval('%[1]s_id_seq'))
+		ON CONFLICT (id) DO UPDATE SET version = EXCLUDED.version`, table))
+}
+
+// initViewCache changes the version of the data the processed views are
+// computed from in the transactions modifying this data, so that views cached
+// before are not used anymore once the transaction is committed.
+func initViewCache() {
+	models.NewModel("ViewCacheVersion")
+	pool.ViewCacheVersion().AddIntegerField("Version", models.SimpleFieldParams{Required: true})
+	rpc.Restrict("ViewCacheVersion")
+
+	translation := pool.Translation()
+	translation.Methods().Create().Extend("",
+		func(rs pool.TranslationSet, data models.FieldMapper) pool.TranslationSet {
+			if !rs.Env().Context().HasKey("TranslationLoad") {
+				updateViewCacheVersion(rs.Env())
+			}
+			return rs.Super().Create(data)
+		})
+	translation.Methods().Write().Extend("",
+		func(rs pool.TranslationSet, data models.FieldMapper, fieldsToUnset ...models.FieldNamer) bool {
+			if !rs.Env().Context().HasKey("TranslationLoad") {
+				updateViewCacheVersion(rs.Env())
+			}
+			return rs.Super().Write(data, fieldsToUnset...)
+		})
+	translation.Methods().Unlink().Extend("",
+		func(rs pool.TranslationSet) int64 {
+			updateViewCacheVersion(rs.Env())
+			return rs.Super().Unlink()
+		})
+	translation.Methods().LoadPOFile().Extend("",
+		func(rs pool.TranslationSet, fileName string) {
+			// The version is changed once for the whole file
+			// instead of once per loaded translation.
+			rs.Super().LoadPOFile(fileName)
+			updateViewCacheVersion(rs.Env())
+		})
+
+	viewCustomization := pool.ViewCustomization()
+	viewCustomization.Methods().Create().Extend("",
+		func(rs pool.ViewCustomizationSet, data models.FieldMapper) pool.ViewCustomizationSet {
+			// The customizations key of the users of the view changes
+			updateViewCacheVersion(rs.Env())
+			return rs.Super().Create(data)
+		})
+	viewCustomization.Methods().Write().Extend("",
+		func(rs pool.ViewCustomizationSet, data models.FieldMapper, fieldsToUnset ...models.FieldNamer) bool {
+			updateViewCacheVersion(rs.Env())
+			return rs.Super().Write(data, fieldsToUnset...)
+		})
+	viewCustomization.Methods().Unlink().Extend("",
+		func(rs pool.ViewCustomizationSet) int64 {
+			updateViewCacheVersion(rs.Env())
+			return rs.Super().Unlink()
+		})
+
+	pool.User().Methods().Write().Extend("",
+		func(rs pool.UserSet, data models.FieldMapper, fieldsToUnset ...models.FieldNamer) bool {
+			// The language or the company of the users may change
+			updateViewCacheVersion(rs.Env())
+			res := rs.Super().Write(data, fieldsToUnset...)
+			fMap := data.FieldMap()
+			_, ok1 := fMap["Groups"]
+			_, ok2 := fMap["group_ids"]
+			if ok1 || ok2 {
+				// Views cached for the previous groups of the user are not used anymore
+				viewcache.Invalidate()
+			}
+			return res
+		})
+
+	pool.Group().Methods().ReloadGroups().Extend("",
+		func(rs pool.GroupSet) {
+			rs.Super().ReloadGroups()
+			viewcache.Invalidate()
+		})
+}
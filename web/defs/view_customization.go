@@ -0,0 +1,188 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package defs
+
+import (
+	"fmt"
+
+	"github.com/npiganeau/yep-base/web/inherit"
+	"github.com/npiganeau/yep-base/web/rpc"
+	"github.com/npiganeau/yep-base/web/webdata"
+	"github.com/npiganeau/yep/pool"
+	"github.com/npiganeau/yep/yep/tools/etree"
+	"github.com/npiganeau/yep/yep/views"
+)
+
+// columnsCustomization is the name of the customization
+// holding the column settings of a list view for a user.
+const columnsCustomization = "columns"
+
+// A column is a field column of a list view
+type column struct {
+	name      string
+	invisible string
+	width     string
+}
+
+// listColumns returns the field columns of the given list view arch in order
+func listColumns(arch string) []column {
+	doc := etree.NewDocument()
+	if err := doc.ReadFromString(arch); err != nil {
+		log.Panic("Unable to parse view arch", "arch", arch, "error", err)
+	}
+	var res []column
+	for _, fieldTag := range doc.FindElements("tree/field") {
+		res = append(res, column{
+			name:      fieldTag.SelectAttrValue("name", ""),
+			invisible: fieldTag.SelectAttrValue("invisible", ""),
+			width:     fieldTag.SelectAttrValue("width", ""),
+		})
+	}
+	return res
+}
+
+// columnPath returns the path of the column with the given name in a list view arch
+func columnPath(name string) string {
+	return fmt.Sprintf("tree/field[@name='%s']", name)
+}
+
+// columnsPatch returns the patch to apply to a list view with the given
+// base columns so that its columns are the given ones. It returns an
+// empty string if the columns are the same.
+func columnsPatch(base, columns []column) string {
+	doc := etree.NewDocument()
+	data := doc.CreateElement("data")
+	baseColumns := make(map[string]column, len(base))
+	for _, col := range base {
+		baseColumns[col.name] = col
+	}
+	for _, col := range columns {
+		baseCol := baseColumns[col.name]
+		if col.invisible == baseCol.invisible && col.width == baseCol.width {
+			continue
+		}
+		spec := data.CreateElement("xpath")
+		spec.CreateAttr("expr", columnPath(col.name))
+		spec.CreateAttr("position", "attributes")
+		for _, attr := range [][2]string{{"invisible", col.invisible}, {"width", col.width}} {
+			attrTag := spec.CreateElement("attribute")
+			attrTag.CreateAttr("name", attr[0])
+			attrTag.SetText(attr[1])
+		}
+	}
+	var reordered bool
+	for i := range columns {
+		reordered = reordered || i >= len(base) || columns[i].name != base[i].name
+	}
+	if reordered {
+		// Move the first column before the first base column,
+		// and each other column after the previous one.
+		for i, col := range columns {
+			anchor, position := base[0].name, "before"
+			if i > 0 {
+				anchor, position = columns[i-1].name, "after"
+			}
+			if anchor == col.name {
+				continue
+			}
+			spec := data.CreateElement("xpath")
+			spec.CreateAttr("expr", columnPath(anchor))
+			spec.CreateAttr("position", position)
+			move := spec.CreateElement("xpath")
+			move.CreateAttr("expr", columnPath(col.name))
+			move.CreateAttr("position", "move")
+		}
+	}
+	if len(data.ChildElements()) == 0 {
+		return ""
+	}
+	res, err := doc.WriteToString()
+	if err != nil {
+		log.Panic("Unable to render XML", "error", err)
+	}
+	return res
+}
+
+func initViewCustomizations() {
+	viewCustomization := pool.ViewCustomization()
+
+	viewCustomization.AddMethod("ApplyCustomizations",
+		`ApplyCustomizations returns the given arch of the view with the given ID after
+		applying the customizations of the current user. If skip is not empty, the user
+		customization with this name is not applied. Customizations that cannot be applied,
+		for instance because a module update removed the element they locate, are ignored.`,
+		func(rs pool.ViewCustomizationSet, viewID, arch, skip string) string {
+			for _, custo := range rs.GetCustomizations(viewID) {
+				if skip != "" && custo.Name == skip && !custo.User.IsEmpty() {
+					continue
+				}
+				res, err := inherit.Patch(arch, custo.Arch)
+				if err != nil {
+					log.Warn("Unable to apply view customization", "view", viewID, "customization", custo.ID, "error", err)
+					continue
+				}
+				arch = res
+			}
+			return arch
+		})
+
+	viewCustomization.AddMethod("SaveColumn",
+		`SaveColumn saves the visibility, position and width of a column
+		of a list view for the current user.`,
+		func(rs pool.ViewCustomizationSet, params webdata.SaveColumnParams) {
+			view := views.Registry.GetByID(params.ViewID)
+			if view == nil || view.Type != views.VIEW_TYPE_TREE {
+				log.Panic("Unknown list view", "view", params.ViewID)
+			}
+			moduleArch, err := inherit.Apply(view.ID, view.Arch)
+			if err != nil {
+				// Invalid extensions are reported when views are checked at startup
+				log.Warn("Unable to apply view extensions", "view", view.ID, "error", err)
+			}
+			base := listColumns(rs.ApplyCustomizations(view.ID, moduleArch, columnsCustomization))
+			columns := listColumns(rs.ApplyCustomizations(view.ID, moduleArch, ""))
+			if len(base) == 0 {
+				log.Panic("List view has no field column", "view", view.ID)
+			}
+			model := rs.Env().Pool(view.Model)
+			fieldJSON, ok := jsonizeFieldName(model, params.Field)
+			if !ok {
+				log.Panic("Unknown field", "model", view.Model, "field", params.Field)
+			}
+			index := -1
+			for i, col := range columns {
+				if colJSON, _ := jsonizeFieldName(model, col.name); colJSON == fieldJSON {
+					index = i
+					break
+				}
+			}
+			if index < 0 {
+				log.Panic("Field is not a column of the list view", "view", view.ID, "field", params.Field)
+			}
+			col := columns[index]
+			if params.Visible != nil {
+				col.invisible = ""
+				if !*params.Visible {
+					col.invisible = "1"
+				}
+			}
+			if params.Width != "" {
+				col.width = params.Width
+			}
+			columns = append(columns[:index], columns[index+1:]...)
+			if params.Sequence != nil {
+				index = *params.Sequence
+				if index < 0 {
+					index = 0
+				}
+				if index > len(columns) {
+					index = len(columns)
+				}
+			}
+			columns = append(columns[:index], append([]column{col}, columns[index:]...)...)
+			rs.SaveCustomization(view.ID, columnsCustomization, columnsPatch(base, columns))
+		})
+	rpc.Expose("ViewCustomization", "SaveColumn")
+	rpc.Restrict("ViewCustomization")
+}
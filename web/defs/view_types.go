@@ -0,0 +1,37 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package defs
+
+import (
+	"regexp"
+
+	"github.com/npiganeau/yep/yep/models"
+)
+
+// templateFieldRegexp matches the record fields used in QWeb expressions
+// of kanban templates, such as record.Name.raw_value
+var templateFieldRegexp = regexp.MustCompile(`\brecord\.([A-Za-z_][A-Za-z0-9_]*)`)
+
+// jsonizeFieldName returns the JSON name of the given field of the model of
+// the given RecordCollection and true, or false if the field does not exist.
+func jsonizeFieldName(rc models.RecordCollection, fieldName string) (res string, ok bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			res, ok = "", false
+		}
+	}()
+	return rc.Model().JSONizeFieldName(fieldName), true
+}
+
+// addFieldInfo adds the field info of the given field to fieldInfos
+// if it is not already there.
+func addFieldInfo(rc models.RecordCollection, fieldInfos map[string]*models.FieldInfo, fieldJSON string) {
+	if _, exists := fieldInfos[fieldJSON]; exists {
+		return
+	}
+	fInfos := rc.Call("FieldsGet", models.FieldsGetArgs{Fields: []models.FieldName{models.FieldName(fieldJSON)}}).(map[string]*models.FieldInfo)
+	for f, fInfo := range fInfos {
+		fieldInfos[f] = fInfo
+	}
+}
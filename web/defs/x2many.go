@@ -0,0 +1,138 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package defs
+
+import (
+	"github.com/npiganeau/yep/yep/models"
+)
+
+// An x2ManyCommand is a command received from the client to
+// modify the value of a Many2Many or One2Many field.
+type x2ManyCommand struct {
+	action int
+	id     int64
+	values models.FieldMap
+	ids    []int64
+}
+
+// parseX2ManyCommands parses the given list of commands received from the
+// client for a 2many field. A list of ids is interpreted as link commands.
+func parseX2ManyCommands(value []interface{}) []x2ManyCommand {
+	res := make([]x2ManyCommand, len(value))
+	for i, item := range value {
+		triplet, ok := item.([]interface{})
+		if !ok {
+			// We have a single id instead of a triplet
+			res[i] = x2ManyCommand{action: 4, id: idFromValue(item)}
+			continue
+		}
+		if len(triplet) == 0 {
+			log.Panic("Empty x2many command", "value", value)
+		}
+		cmd := x2ManyCommand{action: int(idFromValue(triplet[0]))}
+		if len(triplet) > 1 {
+			cmd.id = idFromValue(triplet[1])
+		}
+		if len(triplet) > 2 {
+			switch arg := triplet[2].(type) {
+			case map[string]interface{}:
+				cmd.values = models.FieldMap(arg)
+			case models.FieldMap:
+				cmd.values = arg
+			case []interface{}:
+				cmd.ids = make([]int64, len(arg))
+				for j, id := range arg {
+					cmd.ids[j] = idFromValue(id)
+				}
+			case []int64:
+				cmd.ids = arg
+			}
+		}
+		switch cmd.action {
+		case 0, 1:
+			if cmd.values == nil {
+				cmd.values = make(models.FieldMap)
+			}
+		case 2, 3, 4, 5, 6:
+		default:
+			log.Panic("Unknown x2many command", "command", triplet)
+		}
+		res[i] = cmd
+	}
+	return res
+}
+
+// idFromValue returns the given id received from the client as an int64
+func idFromValue(value interface{}) int64 {
+	switch v := value.(type) {
+	case float64:
+		return int64(v)
+	case int64:
+		return v
+	case int:
+		return int64(v)
+	case bool:
+		// The client sends false for unset ids
+		return 0
+	}
+	log.Panic("Unable to convert value to id", "value", value)
+	return 0
+}
+
+// removeID returns the given list of ids without the given id
+func removeID(ids []int64, id int64) []int64 {
+	var res []int64
+	for _, i := range ids {
+		if i != id {
+			res = append(res, i)
+		}
+	}
+	return res
+}
+
+// executeX2ManyCommands executes the commands of the given list that create,
+// update or delete records of relSet, and returns the list with creations
+// replaced by link commands and deletions by unlink commands.
+func executeX2ManyCommands(relSet models.RecordCollection, commands []x2ManyCommand) []x2ManyCommand {
+	var res []x2ManyCommand
+	for _, cmd := range commands {
+		switch cmd.action {
+		case 0:
+			for _, id := range relSet.Call("Create", cmd.values).(models.RecordCollection).Ids() {
+				res = append(res, x2ManyCommand{action: 4, id: id})
+			}
+		case 1:
+			relSet.Search(relSet.Model().Field("ID").Equals(cmd.id)).Call("Write", cmd.values)
+		case 2:
+			relSet.Search(relSet.Model().Field("ID").Equals(cmd.id)).Call("Unlink")
+			res = append(res, x2ManyCommand{action: 3, id: cmd.id})
+		default:
+			res = append(res, cmd)
+		}
+	}
+	return res
+}
+
+// replacesValue returns true if the result of the given commands does
+// not depend on the current value of the field, that is if they contain
+// a (5) or a (6, 0, ids) command.
+func replacesValue(commands []x2ManyCommand) bool {
+	for _, cmd := range commands {
+		if cmd.action == 5 || cmd.action == 6 {
+			return true
+		}
+	}
+	return false
+}
+
+// clientValue returns this command in the format sent by the client
+func (cmd x2ManyCommand) clientValue() []interface{} {
+	switch cmd.action {
+	case 0, 1:
+		return []interface{}{cmd.action, cmd.id, cmd.values}
+	case 6:
+		return []interface{}{cmd.action, 0, cmd.ids}
+	}
+	return []interface{}{cmd.action, cmd.id}
+}
@@ -0,0 +1,423 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package domains
+
+import (
+	"fmt"
+)
+
+// TrueLeaf and FalseLeaf are domain terms that are respectively always
+// true and always false. They are used to express constant domains.
+var (
+	TrueLeaf  = DomainTerm{1, "=", 1}
+	FalseLeaf = DomainTerm{0, "=", 1}
+)
+
+// negatedOperators maps each domain operator to its negation
+var negatedOperators = map[string]string{
+	"=":         "!=",
+	"!=":        "=",
+	"<":         ">=",
+	">=":        "<",
+	">":         "<=",
+	"<=":        ">",
+	"in":        "not in",
+	"not in":    "in",
+	"like":      "not like",
+	"not like":  "like",
+	"ilike":     "not ilike",
+	"not ilike": "ilike",
+}
+
+// AND returns a domain that is the logical conjunction of the given domains.
+// Empty domains are considered as always true and are ignored.
+func AND(doms ...Domain) Domain {
+	return combine(PREFIX_AND, doms)
+}
+
+// OR returns a domain that is the logical disjunction of the given domains.
+// If one of the domains is empty (i.e. always true), the result is an empty domain.
+func OR(doms ...Domain) Domain {
+	return combine(PREFIX_OR, doms)
+}
+
+// NOT returns a domain that is the negation of the given domain.
+// Negation is distributed to the domain terms so that the result
+// does not include the '!' operator whenever possible.
+func NOT(dom Domain) Domain {
+	if len(dom) == 0 {
+		return Domain{[]interface{}(FalseLeaf)}
+	}
+	res := Normalize(dom)
+	return distributeNot(parseTree(&res), true).toDomain()
+}
+
+// combine the given domains with the given operator, which must
+// be PREFIX_AND or PREFIX_OR.
+func combine(op DomainPrefixOperator, doms []Domain) Domain {
+	var res Domain
+	var count int
+	for _, dom := range doms {
+		if len(dom) == 0 {
+			if op == PREFIX_OR {
+				return Domain{}
+			}
+			continue
+		}
+		res = append(res, Normalize(dom)...)
+		count++
+	}
+	if count < 2 {
+		return res
+	}
+	prefix := make(Domain, count-1)
+	for i := range prefix {
+		prefix[i] = string(op)
+	}
+	return append(prefix, res...)
+}
+
+// Normalize returns the given domain in explicit prefix form, that is
+// with all implicit '&' operators made explicit.
+func Normalize(dom Domain) Domain {
+	if len(dom) == 0 {
+		return Domain{}
+	}
+	var res Domain
+	expected := 1
+	for _, token := range dom {
+		if expected == 0 {
+			res = append(Domain{string(PREFIX_AND)}, res...)
+			expected = 1
+		}
+		switch t := token.(type) {
+		case string:
+			switch DomainPrefixOperator(t) {
+			case PREFIX_AND, PREFIX_OR:
+				expected++
+			case PREFIX_NOT:
+			default:
+				log.Panic("Unknown prefix operator in domain", "operator", t, "domain", dom)
+			}
+		case []interface{}:
+			expected--
+		case DomainTerm:
+			token = []interface{}(t)
+			expected--
+		default:
+			log.Panic("Unexpected domain token", "token", token, "domain", dom)
+		}
+		res = append(res, token)
+	}
+	return res
+}
+
+// Simplify returns an equivalent of the given domain in normalized form
+// where duplicate terms have been removed, constant terms (TrueLeaf and
+// FalseLeaf) have been evaluated, negations have been distributed and
+// '=' terms on the same field that are OR-ed together have been merged
+// into a single 'in' term.
+func Simplify(dom Domain) Domain {
+	if len(dom) == 0 {
+		return Domain{}
+	}
+	norm := Normalize(dom)
+	tree := distributeNot(parseTree(&norm), false)
+	tree = tree.simplify()
+	if tree.isTrue() {
+		return Domain{}
+	}
+	return tree.toDomain()
+}
+
+// Constant returns the value of the given domain and true if the domain does
+// not depend on the records, that is if it simplifies to an empty domain
+// (always true) or to FalseLeaf (always false). Otherwise it returns false, false.
+func Constant(dom Domain) (value bool, ok bool) {
+	simplified := Simplify(dom)
+	if len(simplified) == 0 {
+		return true, true
+	}
+	if len(simplified) == 1 {
+		switch t := simplified[0].(type) {
+		case []interface{}:
+			return false, isConstantLeaf(t, FalseLeaf)
+		case DomainTerm:
+			return false, isConstantLeaf(t, FalseLeaf)
+		}
+	}
+	return false, false
+}
+
+// Fields returns the field names or paths used in the terms
+// of the given domain, without duplicates, in order.
+func Fields(dom Domain) []string {
+	var res []string
+	seen := make(map[string]bool)
+	for _, token := range dom {
+		var term []interface{}
+		switch t := token.(type) {
+		case []interface{}:
+			term = t
+		case DomainTerm:
+			term = t
+		default:
+			continue
+		}
+		if len(term) == 0 {
+			continue
+		}
+		field, ok := term[0].(string)
+		if !ok || seen[field] {
+			continue
+		}
+		seen[field] = true
+		res = append(res, field)
+	}
+	return res
+}
+
+// needsSimplification returns true if the given domain includes negations
+// or constant terms which cannot be parsed directly.
+func needsSimplification(dom Domain) bool {
+	for _, token := range dom {
+		switch t := token.(type) {
+		case string:
+			if DomainPrefixOperator(t) == PREFIX_NOT {
+				return true
+			}
+		case []interface{}:
+			if len(t) == 3 && (isConstantLeaf(t, TrueLeaf) || isConstantLeaf(t, FalseLeaf)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isConstantLeaf returns true if the given term is equal to the given constant leaf.
+func isConstantLeaf(term []interface{}, leaf DomainTerm) bool {
+	if len(term) != 3 {
+		return false
+	}
+	if _, ok := term[0].(string); ok {
+		return false
+	}
+	return toInt64(term[0]) == toInt64(leaf[0]) && term[1] == leaf[1] && toInt64(term[2]) == toInt64(leaf[2])
+}
+
+// A domainNode is a node of the tree representation of a domain.
+// It is either a leaf with a term, or an operator with children.
+type domainNode struct {
+	op       DomainPrefixOperator
+	children []*domainNode
+	term     []interface{}
+}
+
+// parseTree parses the given normalized domain into a tree.
+// The given domain through pointer is consumed during operation.
+func parseTree(dom *Domain) *domainNode {
+	if len(*dom) == 0 {
+		log.Panic("Malformed domain: missing terms for operator")
+	}
+	token := (*dom)[0]
+	*dom = (*dom)[1:]
+	switch t := token.(type) {
+	case string:
+		node := &domainNode{op: DomainPrefixOperator(t)}
+		arity := 2
+		if node.op == PREFIX_NOT {
+			arity = 1
+		}
+		for i := 0; i < arity; i++ {
+			node.children = append(node.children, parseTree(dom))
+		}
+		return node
+	case []interface{}:
+		return &domainNode{term: t}
+	}
+	log.Panic("Unexpected domain token", "token", token)
+	return nil
+}
+
+// distributeNot pushes the negations of the given tree down to the leaves.
+// If negate is true, the whole tree is negated.
+func distributeNot(node *domainNode, negate bool) *domainNode {
+	switch node.op {
+	case "":
+		if !negate {
+			return node
+		}
+		if isConstantLeaf(node.term, TrueLeaf) {
+			return &domainNode{term: FalseLeaf}
+		}
+		if isConstantLeaf(node.term, FalseLeaf) {
+			return &domainNode{term: TrueLeaf}
+		}
+		opStr, _ := node.term[1].(string)
+		if negOp, ok := negatedOperators[opStr]; ok {
+			return &domainNode{term: []interface{}{node.term[0], negOp, node.term[2]}}
+		}
+		return &domainNode{op: PREFIX_NOT, children: []*domainNode{node}}
+	case PREFIX_NOT:
+		return distributeNot(node.children[0], !negate)
+	}
+	res := &domainNode{op: node.op}
+	if negate {
+		res.op = PREFIX_AND
+		if node.op == PREFIX_AND {
+			res.op = PREFIX_OR
+		}
+	}
+	for _, child := range node.children {
+		res.children = append(res.children, distributeNot(child, negate))
+	}
+	return res
+}
+
+// isTrue returns true if this node is the TrueLeaf
+func (n *domainNode) isTrue() bool {
+	return n.op == "" && isConstantLeaf(n.term, TrueLeaf)
+}
+
+// isFalse returns true if this node is the FalseLeaf
+func (n *domainNode) isFalse() bool {
+	return n.op == "" && isConstantLeaf(n.term, FalseLeaf)
+}
+
+// key returns a string that uniquely identifies this node's content
+func (n *domainNode) key() string {
+	if n.op == "" {
+		return fmt.Sprintf("%#v", n.term)
+	}
+	res := string(n.op) + "("
+	for _, child := range n.children {
+		res += child.key() + ","
+	}
+	return res + ")"
+}
+
+// simplify returns a simplified version of this node.
+// This node must not include negations that can be distributed.
+func (n *domainNode) simplify() *domainNode {
+	if n.op == "" || n.op == PREFIX_NOT {
+		return n
+	}
+	// Flatten children with the same operator and simplify them
+	var children []*domainNode
+	for _, child := range n.children {
+		child = child.simplify()
+		if child.op == n.op {
+			children = append(children, child.children...)
+			continue
+		}
+		children = append(children, child)
+	}
+	// Evaluate constants and remove duplicates
+	seen := make(map[string]bool)
+	var res []*domainNode
+	for _, child := range children {
+		switch {
+		case n.op == PREFIX_AND && child.isFalse(), n.op == PREFIX_OR && child.isTrue():
+			return child
+		case n.op == PREFIX_AND && child.isTrue(), n.op == PREFIX_OR && child.isFalse():
+			continue
+		}
+		if seen[child.key()] {
+			continue
+		}
+		seen[child.key()] = true
+		res = append(res, child)
+	}
+	if n.op == PREFIX_OR {
+		res = mergeEqualTerms(res)
+	}
+	switch len(res) {
+	case 0:
+		if n.op == PREFIX_AND {
+			return &domainNode{term: TrueLeaf}
+		}
+		return &domainNode{term: FalseLeaf}
+	case 1:
+		return res[0]
+	}
+	return &domainNode{op: n.op, children: res}
+}
+
+// mergeEqualTerms merges the '=' and 'in' terms of the given OR-ed nodes
+// that apply on the same field into a single 'in' term.
+func mergeEqualTerms(nodes []*domainNode) []*domainNode {
+	var res []*domainNode
+	merged := make(map[string]*domainNode)
+	for _, node := range nodes {
+		if node.op != "" {
+			res = append(res, node)
+			continue
+		}
+		fieldName, ok := node.term[0].(string)
+		opStr, _ := node.term[1].(string)
+		var values []interface{}
+		switch {
+		case !ok:
+		case opStr == "=" && node.term[2] != nil && node.term[2] != false:
+			values = []interface{}{node.term[2]}
+		case opStr == "in":
+			values, _ = node.term[2].([]interface{})
+		}
+		if values == nil {
+			res = append(res, node)
+			continue
+		}
+		if mNode, exists := merged[fieldName]; exists {
+			mNode.term[1] = "in"
+			mNode.term[2] = appendUniqueValues(mNode.term[2].([]interface{}), values)
+			continue
+		}
+		mNode := &domainNode{term: []interface{}{fieldName, opStr, appendUniqueValues(nil, values)}}
+		merged[fieldName] = mNode
+		res = append(res, mNode)
+	}
+	// Restore single '=' terms that have not been merged
+	for _, node := range merged {
+		if values := node.term[2].([]interface{}); node.term[1] == "=" {
+			node.term[2] = values[0]
+		}
+	}
+	return res
+}
+
+// appendUniqueValues appends the given values to list, skipping
+// the values that are already in the list. It returns the new list.
+func appendUniqueValues(list []interface{}, values []interface{}) []interface{} {
+	seen := make(map[string]bool)
+	for _, v := range list {
+		seen[fmt.Sprintf("%#v", v)] = true
+	}
+	for _, v := range values {
+		if seen[fmt.Sprintf("%#v", v)] {
+			continue
+		}
+		seen[fmt.Sprintf("%#v", v)] = true
+		list = append(list, v)
+	}
+	return list
+}
+
+// toDomain returns this node as a normalized domain in prefix form
+func (n *domainNode) toDomain() Domain {
+	if n.op == "" {
+		return Domain{n.term}
+	}
+	var res Domain
+	for i := 0; i < len(n.children)-1; i++ {
+		res = append(res, string(n.op))
+	}
+	if n.op == PREFIX_NOT {
+		res = Domain{string(PREFIX_NOT)}
+	}
+	for _, child := range n.children {
+		res = append(res, child.toDomain()...)
+	}
+	return res
+}
@@ -76,6 +76,12 @@ var log *logging.Logger
 // ParseDomain gets Domain and parses it into a RecordSet query Condition.
 // Returns nil if the domain is []
 func ParseDomain(dom Domain) *models.Condition {
+	if needsSimplification(dom) {
+		dom = Simplify(dom)
+		if len(dom) == 1 && isConstantLeaf(dom[0].([]interface{}), FalseLeaf) {
+			return (&models.Condition{}).And().Field("ID").AddOperator(operator.Operator("="), 0)
+		}
+	}
 	res := parseDomain(&dom)
 	if res == nil {
 		return nil
@@ -93,6 +99,21 @@ func parseDomain(dom *Domain) *models.Condition {
 		return nil
 	}
 
+	if op, ok := (*dom)[0].(string); ok && DomainPrefixOperator(op) == PREFIX_NOT {
+		// Simplify keeps '!' only in front of terms whose operator has no
+		// negation (e.g. '=like'), so the negated condition is a single term.
+		*dom = (*dom)[1:]
+		if len(*dom) == 0 {
+			log.Panic("Malformed domain: missing term for '!' operator")
+		}
+		term, ok := (*dom)[0].([]interface{})
+		if !ok {
+			log.Panic("Malformed domain: '!' operator must be followed by a term", "token", (*dom)[0])
+		}
+		*dom = (*dom)[1:]
+		return models.Condition{}.AndNotCond(addTerm(&models.Condition{}, DomainTerm(term), PREFIX_AND))
+	}
+
 	res := &models.Condition{}
 	currentOp := PREFIX_AND
 
@@ -147,6 +168,12 @@ func addTerm(cond *models.Condition, term DomainTerm, op DomainPrefixOperator) *
 	fieldName := term[0].(string)
 	optr := operator.Operator(term[1].(string))
 	value := term[2]
+	if _, ok := value.(Expression); ok {
+		log.Panic("Unresolved expression in domain term, call ResolvePlaceholders first", "term", term)
+	}
+	if _, ok := operatorResolvers[optr]; ok {
+		log.Panic("Unresolved operator in domain term, call ResolveOperators first", "term", term)
+	}
 	meth := getConditionMethod(cond, op)
 	cond = meth().Field(fieldName).AddOperator(optr, value)
 	return cond
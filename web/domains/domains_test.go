@@ -15,10 +15,15 @@
 package domains
 
 import (
+	"html"
+	"io/ioutil"
+	"regexp"
 	"testing"
+	"time"
 
 	"github.com/npiganeau/yep/yep/models"
 	"github.com/npiganeau/yep/yep/models/security"
+	"github.com/npiganeau/yep/yep/models/types"
 	"github.com/npiganeau/yep/yep/tests"
 	_ "github.com/npiganeau/yep/yep/tests/testllmodule"
 	. "github.com/smartystreets/goconvey/convey"
@@ -108,6 +113,231 @@ func TestDomains(t *testing.T) {
 				So(dom3Users.Len(), ShouldEqual, 1)
 				So(dom3Users.Get("Name"), ShouldEqual, "Jane Smith")
 			})
+			Convey("Testing ['&', (A), '!', (B)] domain with an operator without negation", func() {
+				dom4 := []interface{}{
+					0: "&",
+					1: []interface{}{"Name", "like", "Smith"},
+					2: "!",
+					3: []interface{}{"Email", "=like", "j%"},
+				}
+				dom4Users := env.Pool("User").Search(ParseDomain(dom4))
+				So(dom4Users.Len(), ShouldEqual, 1)
+				So(dom4Users.Get("Name"), ShouldEqual, "Will Smith")
+			})
+		})
+	})
+}
+
+func TestDomainPlaceholders(t *testing.T) {
+	Convey("Testing domain placeholders resolution", t, func() {
+		ctx := types.NewContext().WithKey("uid", int64(2)).WithKey("tz", "UTC").WithKey("lang", "fr_FR")
+		today := time.Date(2017, 3, 15, 23, 59, 59, 0, time.UTC)
+		now = func() time.Time { return today }
+		Reset(func() {
+			now = time.Now
+		})
+		Convey("uid should be replaced by the context uid", func() {
+			dom := Domain{[]interface{}{"User", "=", Expression("uid")}}
+			So(ResolvePlaceholders(dom, ctx), ShouldResemble, Domain{[]interface{}{"User", "=", int64(2)}})
+		})
+		Convey("Expressions in lists should be resolved", func() {
+			dom := Domain{"|", []interface{}{"ID", "in", []interface{}{Expression("uid"), 3}}, []interface{}{"Name", "=", "uid"}}
+			So(ResolvePlaceholders(dom, ctx), ShouldResemble, Domain{"|",
+				[]interface{}{"ID", "in", []interface{}{int64(2), 3}},
+				[]interface{}{"Name", "=", "uid"}})
+		})
+		Convey("context_today() and relative dates should be evaluated", func() {
+			val, err := EvaluateExpression("context_today()", ctx)
+			So(err, ShouldBeNil)
+			So(val, ShouldEqual, today.Format("2006-01-02"))
+			val, err = EvaluateExpression("(context_today() + relativedelta(day=1)).strftime('%Y-%m-%d')", ctx)
+			So(err, ShouldBeNil)
+			So(val, ShouldEqual, today.Format("2006-01")+"-01")
+			val, err = EvaluateExpression("time.strftime('%Y-%m-01')", ctx)
+			So(err, ShouldBeNil)
+			So(val, ShouldEqual, today.Format("2006-01")+"-01")
+			val, err = EvaluateExpression("context_today() - relativedelta(days=1)", ctx)
+			So(err, ShouldBeNil)
+			So(val, ShouldEqual, today.AddDate(0, 0, -1).Format("2006-01-02"))
+		})
+		Convey("Days should be clamped to the last day of the month", func() {
+			now = func() time.Time { return time.Date(2017, 1, 31, 12, 0, 0, 0, time.UTC) }
+			val, err := EvaluateExpression("context_today() + relativedelta(months=1)", ctx)
+			So(err, ShouldBeNil)
+			So(val, ShouldEqual, "2017-02-28")
+			val, err = EvaluateExpression("context_today() + relativedelta(month=2, day=31)", ctx)
+			So(err, ShouldBeNil)
+			So(val, ShouldEqual, "2017-02-28")
+			val, err = EvaluateExpression("context_today() - relativedelta(months=11)", ctx)
+			So(err, ShouldBeNil)
+			So(val, ShouldEqual, "2016-02-29")
+			val, err = EvaluateExpression("context_today() + relativedelta(years=1, months=1, days=1)", ctx)
+			So(err, ShouldBeNil)
+			So(val, ShouldEqual, "2018-03-01")
+		})
+		Convey("context.get() should return context values or default", func() {
+			val, err := EvaluateExpression("context.get('lang')", ctx)
+			So(err, ShouldBeNil)
+			So(val, ShouldEqual, "fr_FR")
+			val, err = EvaluateExpression("context.get('unknown_key', 'en_US')", ctx)
+			So(err, ShouldBeNil)
+			So(val, ShouldEqual, "en_US")
+		})
+		Convey("Invalid expressions should return an error", func() {
+			_, err := EvaluateExpression("unknown_name", ctx)
+			So(err, ShouldNotBeNil)
+			_, err = EvaluateExpression("relativedelta(days=1)", ctx)
+			So(err, ShouldNotBeNil)
+			_, err = EvaluateExpression("context_today(", ctx)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestDomainCombination(t *testing.T) {
+	Convey("Testing domain combination and normalization", t, func() {
+		termA := []interface{}{"Name", "=", "John"}
+		termB := []interface{}{"Name", "=", "Jane"}
+		termC := []interface{}{"Age", ">", 24}
+		Convey("Normalize should make implicit '&' explicit", func() {
+			So(Normalize(Domain{termA, termB, termC}), ShouldResemble, Domain{"&", "&", termA, termB, termC})
+			So(Normalize(Domain{"|", termA, termB, termC}), ShouldResemble, Domain{"&", "|", termA, termB, termC})
+			So(Normalize(Domain{}), ShouldResemble, Domain{})
+		})
+		Convey("AND and OR should combine normalized domains", func() {
+			So(AND(Domain{termA, termB}, Domain{}, Domain{termC}), ShouldResemble, Domain{"&", "&", termA, termB, termC})
+			So(OR(Domain{termA}, Domain{"|", termB, termC}), ShouldResemble, Domain{"|", termA, "|", termB, termC})
+			So(OR(Domain{termA}, Domain{}), ShouldResemble, Domain{})
+			So(AND(Domain{}, Domain{}), ShouldBeEmpty)
+		})
+		Convey("NOT should distribute negation on terms", func() {
+			So(NOT(Domain{"|", termA, termC}), ShouldResemble, Domain{"&",
+				[]interface{}{"Name", "!=", "John"},
+				[]interface{}{"Age", "<=", 24}})
+			So(NOT(Domain{[]interface{}{"ID", "child_of", 1}}), ShouldResemble, Domain{"!", []interface{}{"ID", "child_of", 1}})
+		})
+		Convey("Simplify should remove duplicates and constant terms", func() {
+			So(Simplify(Domain{termA, []interface{}(TrueLeaf), termA}), ShouldResemble, Domain{termA})
+			So(Simplify(Domain{"|", termA, []interface{}(TrueLeaf)}), ShouldBeEmpty)
+			So(Simplify(Domain{termC, []interface{}(FalseLeaf)}), ShouldResemble, Domain{[]interface{}(FalseLeaf)})
+			So(Simplify(Domain{"!", "!", termC}), ShouldResemble, Domain{termC})
+		})
+		Convey("Constant should evaluate domains that do not depend on records", func() {
+			value, ok := Constant(Domain{"|", termA, []interface{}{1.0, "=", 1.0}})
+			So(ok, ShouldBeTrue)
+			So(value, ShouldBeTrue)
+			value, ok = Constant(Domain{termA, []interface{}(FalseLeaf)})
+			So(ok, ShouldBeTrue)
+			So(value, ShouldBeFalse)
+			_, ok = Constant(Domain{termA, []interface{}(TrueLeaf)})
+			So(ok, ShouldBeFalse)
+		})
+		Convey("Fields should return the fields used in the terms", func() {
+			So(Fields(Domain{"|", termA, "&", termB, termC}), ShouldResemble, []string{"Name", "Age"})
+			So(Fields(Domain{[]interface{}(TrueLeaf)}), ShouldBeEmpty)
+		})
+		Convey("Simplify should merge OR-ed '=' terms in a single 'in' term", func() {
+			So(Simplify(OR(Domain{termA}, Domain{termB}, Domain{termC}, Domain{termA})), ShouldResemble, Domain{"|",
+				[]interface{}{"Name", "in", []interface{}{"John", "Jane"}}, termC})
+		})
+	})
+}
+
+func TestDomainLiterals(t *testing.T) {
+	Convey("Testing python literal domains", t, func() {
+		Convey("Parsing a domain with tuples, booleans, None and numbers", func() {
+			dom, err := ParseLiteral(`['|', ('Active', '=', False), ('Parent', '=', None), ('ID', 'in', [1, 2, -3]), ('Rate', '>', 1.5)]`)
+			So(err, ShouldBeNil)
+			So(dom, ShouldResemble, Domain{"|",
+				[]interface{}{"Active", "=", false},
+				[]interface{}{"Parent", "=", nil},
+				[]interface{}{"ID", "in", []interface{}{int64(1), int64(2), int64(-3)}},
+				[]interface{}{"Rate", ">", 1.5}})
+		})
+		Convey("Non literal values should be parsed as expressions", func() {
+			dom, err := ParseLiteral(`[('Date', '>=', (context_today() - relativedelta(months=1)).strftime('%Y-%m-01')), ('User', '=', uid)]`)
+			So(err, ShouldBeNil)
+			So(dom, ShouldResemble, Domain{
+				[]interface{}{"Date", ">=", Expression("(context_today() - relativedelta(months=1)).strftime('%Y-%m-01')")},
+				[]interface{}{"User", "=", Expression("uid")}})
+		})
+		Convey("Empty domains should be parsed as empty Domain", func() {
+			for _, src := range []string{"", "[]", "False", "None"} {
+				dom, err := ParseLiteral(src)
+				So(err, ShouldBeNil)
+				So(dom, ShouldBeEmpty)
+			}
+		})
+		Convey("self should be bound to the searched text of filter domains", func() {
+			dom, err := ParseLiteral("[('Name', 'ilike', self)]")
+			So(err, ShouldBeNil)
+			So(dom, ShouldResemble, Domain{[]interface{}{"Name", "ilike", Expression("self")}})
+			ctx := types.NewContext()
+			So(ResolveFilterDomain(dom, "John", ctx), ShouldResemble, Domain{[]interface{}{"Name", "ilike", "John"}})
+			So(func() { ResolvePlaceholders(dom, ctx) }, ShouldPanic)
+		})
+		Convey("The filter domains of the module views should be parsed and resolved", func() {
+			filterDomain := regexp.MustCompile(`filter_domain="([^"]*)"`)
+			for _, fileName := range []string{"../../base/views/partners.xml", "../../base/views/users.xml"} {
+				data, err := ioutil.ReadFile(fileName)
+				So(err, ShouldBeNil)
+				matches := filterDomain.FindAllStringSubmatch(string(data), -1)
+				So(matches, ShouldNotBeEmpty)
+				for _, match := range matches {
+					dom, err := ParseLiteral(html.UnescapeString(match[1]))
+					So(err, ShouldBeNil)
+					resolved := ResolveFilterDomain(dom, "Smith", types.NewContext())
+					So(Fields(resolved), ShouldContain, "Name")
+					So(func() { NOT(resolved) }, ShouldNotPanic)
+				}
+			}
+		})
+		Convey("Malformed domains should return an error", func() {
+			for _, src := range []string{"('Name', '=', 'John')", "[('Name', '=')]", "['&', ('Name', '=', 'John')", "['^', ('Name', '=', 'John')]"} {
+				_, err := ParseLiteral(src)
+				So(err, ShouldNotBeNil)
+			}
+		})
+		Convey("Domains should be serialized back to python literals", func() {
+			for _, src := range []string{
+				`['|', ('Name', 'ilike', 'O\'Neil'), ('User', '=', uid), ('ID', 'in', [1, 2]), ('Active', '=', True)]`,
+				`['&', ('Parent', '=', None), ('Credit', '>', 2 * context.get('limit', 10) / 4)]`,
+				`[('Date', '<', context_today()), ('Sequence', '!=', 5 % 2)]`,
+			} {
+				dom, err := ParseLiteral(src)
+				So(err, ShouldBeNil)
+				So(dom.Literal(), ShouldEqual, src)
+			}
+		})
+		Convey("Expressions that cannot be evaluated should be rejected", func() {
+			for _, src := range []string{
+				`[('Date', '<', context_today() <= 1)]`,
+				`[('ID', 'in', {'a': 1})]`,
+				`[('Active', '=', not True)]`,
+			} {
+				dom, err := ParseLiteral(src)
+				if err == nil {
+					_, err = EvaluateExpression(string(dom[0].([]interface{})[2].(Expression)), types.NewContext())
+				}
+				So(err, ShouldNotBeNil)
+			}
+		})
+		Convey("Arithmetic operations should be evaluated", func() {
+			ctx := types.NewContext().WithKey("limit", int64(6))
+			for expr, expected := range map[string]interface{}{
+				"2 * context.get('limit', 10) / 4": 3.0,
+				"5 % 2 + 1":                        int64(2),
+				"-7 % 3":                           int64(2),
+				"1 + 2 * 3":                        int64(7),
+				"(1 + 2) * 3":                      int64(9),
+				"7.5 % 2":                          1.5,
+			} {
+				val, err := EvaluateExpression(expr, ctx)
+				So(err, ShouldBeNil)
+				So(val, ShouldEqual, expected)
+			}
+			_, err := EvaluateExpression("1 / 0", ctx)
+			So(err, ShouldNotBeNil)
 		})
 	})
 }
@@ -0,0 +1,709 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package domains
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/npiganeau/yep/yep/models/types"
+)
+
+// now returns the current time. It is a variable so that tests can pin the date.
+var now = time.Now
+
+// An Expression is a domain value that must be evaluated against the
+// current context before the domain can be parsed, such as `uid` or
+// `context_today() - relativedelta(months=1)`.
+type Expression string
+
+// ResolvePlaceholders returns a copy of the given domain in which all
+// Expression values have been evaluated with the given context.
+//
+// Supported expressions are:
+//
+//   - uid: the id of the current user (taken from the 'uid' context key)
+//   - context_today(): the current date in the 'tz' of the context
+//   - datetime.datetime.now() and datetime.date.today()
+//   - relativedelta(...) and datetime.timedelta(...) to be added or substracted from dates
+//   - time.strftime(format) and <date>.strftime(format)
+//   - context.get('key') and context.get('key', default)
+//   - self: the text searched by the user (taken from the 'self' context key),
+//     as used in the filter_domain of search view fields
+//   - +, -, *, / and % operations on numbers, and + and - on dates and deltas
+func ResolvePlaceholders(dom Domain, ctx *types.Context) Domain {
+	if len(dom) == 0 {
+		return dom
+	}
+	res := make(Domain, len(dom))
+	for i, term := range dom {
+		t, ok := term.([]interface{})
+		if !ok || len(t) != 3 {
+			res[i] = term
+			continue
+		}
+		val, err := resolveValue(t[2], ctx)
+		if err != nil {
+			log.Panic("Unable to resolve domain placeholder", "term", t, "error", err)
+		}
+		res[i] = []interface{}{t[0], t[1], val}
+	}
+	return res
+}
+
+// ResolveFilterDomain returns a copy of the given filter_domain of a search
+// view field in which self is bound to the given searched text and the other
+// Expression values have been evaluated with the given context.
+func ResolveFilterDomain(dom Domain, text string, ctx *types.Context) Domain {
+	return ResolvePlaceholders(dom, ctx.WithKey("self", text))
+}
+
+// resolveValue evaluates the given value if it is an Expression or a list
+// containing Expressions. Other values are returned as is.
+func resolveValue(value interface{}, ctx *types.Context) (interface{}, error) {
+	switch v := value.(type) {
+	case Expression:
+		return EvaluateExpression(string(v), ctx)
+	case []interface{}:
+		res := make([]interface{}, len(v))
+		for i, item := range v {
+			val, err := resolveValue(item, ctx)
+			if err != nil {
+				return nil, err
+			}
+			res[i] = val
+		}
+		return res, nil
+	}
+	return value, nil
+}
+
+// EvaluateExpression evaluates the given expression string with the given
+// context and returns a value that can be used in a domain term.
+// Dates are returned as strings in the ORM format.
+func EvaluateExpression(expr string, ctx *types.Context) (interface{}, error) {
+	tokens, err := tokenize(expr)
+	if err != nil {
+		return nil, err
+	}
+	e := evaluator{tokens: tokens, ctx: ctx}
+	val, err := e.expression()
+	if err != nil {
+		return nil, err
+	}
+	if e.peek().kind != tokenEOF {
+		return nil, fmt.Errorf("unexpected token '%s' in expression '%s'", e.peek().text, expr)
+	}
+	switch v := val.(type) {
+	case dateValue:
+		return v.String(), nil
+	case relativeDelta:
+		return nil, fmt.Errorf("expression '%s' evaluates to a bare time delta", expr)
+	}
+	return val, nil
+}
+
+// A tokenKind is the kind of a token of a python-like expression
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenName
+	tokenNumber
+	tokenString
+	tokenPunct
+)
+
+// A token is a lexical element of a python-like expression
+type token struct {
+	kind tokenKind
+	text string
+	// value holds the unquoted value of string tokens
+	value string
+	// pos is the position of the token in the source string
+	pos int
+}
+
+// tokenize splits the given python-like source into tokens.
+// The returned slice is always terminated by a tokenEOF token.
+func tokenize(src string) ([]token, error) {
+	var res []token
+	runes := []rune(src)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case unicode.IsLetter(r) || r == '_':
+			start := i
+			for i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) || runes[i] == '_') {
+				i++
+			}
+			res = append(res, token{kind: tokenName, text: string(runes[start:i]), pos: start})
+		case unicode.IsDigit(r):
+			start := i
+			for i < len(runes) && (unicode.IsDigit(runes[i]) || runes[i] == '.' || runes[i] == 'e' || runes[i] == 'E') {
+				i++
+			}
+			res = append(res, token{kind: tokenNumber, text: string(runes[start:i]), pos: start})
+		case r == '"' || r == '\'':
+			start := i
+			var value []rune
+			i++
+			for ; i < len(runes) && runes[i] != r; i++ {
+				if runes[i] == '\\' && i+1 < len(runes) {
+					i++
+					switch runes[i] {
+					case 'n':
+						value = append(value, '\n')
+					case 't':
+						value = append(value, '\t')
+					default:
+						value = append(value, runes[i])
+					}
+					continue
+				}
+				value = append(value, runes[i])
+			}
+			if i >= len(runes) {
+				return nil, fmt.Errorf("unterminated string at position %d in '%s'", start, src)
+			}
+			i++
+			res = append(res, token{kind: tokenString, text: string(runes[start:i]), value: string(value), pos: start})
+		case strings.ContainsRune("()[],.=+-*/%", r):
+			res = append(res, token{kind: tokenPunct, text: string(r), pos: i})
+			i++
+		default:
+			return nil, fmt.Errorf("unexpected character '%c' at position %d in '%s'", r, i, src)
+		}
+	}
+	res = append(res, token{kind: tokenEOF, pos: len(runes)})
+	return res, nil
+}
+
+// A dateValue is a date or datetime resulting from an expression evaluation
+type dateValue struct {
+	time.Time
+	dateOnly bool
+}
+
+// String returns the given dateValue in the ORM format.
+func (dv dateValue) String() string {
+	if dv.dateOnly {
+		return dv.Format("2006-01-02")
+	}
+	return dv.UTC().Format("2006-01-02 15:04:05")
+}
+
+// A relativeDelta is a time offset to apply to a dateValue.
+// Relative fields are added, absolute fields (year, month, day) replace
+// the corresponding fields of the date when they are not zero.
+type relativeDelta struct {
+	years, months, days, hours, minutes, seconds int
+	year, month, day                             int
+}
+
+// applyTo returns the given date shifted by this relativeDelta, with
+// the given sign (1 for addition, -1 for substraction).
+//
+// As with python's relativedelta, absolute fields are applied and relative
+// years and months are added first, then the day is clamped to the last day
+// of the resulting month, so that adding a month to January 31st gives the
+// last day of February. Relative days and times are added last.
+func (rd relativeDelta) applyTo(dv dateValue, sign int) dateValue {
+	t := dv.Time
+	year, month, day := t.Date()
+	if rd.year != 0 {
+		year = rd.year
+	}
+	if rd.month != 0 {
+		month = time.Month(rd.month)
+	}
+	if rd.day != 0 {
+		day = rd.day
+	}
+	months := int(month) - 1 + sign*(12*rd.years+rd.months)
+	year += months / 12
+	months %= 12
+	if months < 0 {
+		months += 12
+		year--
+	}
+	month = time.Month(months + 1)
+	if lastDay := time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC).Day(); day > lastDay {
+		day = lastDay
+	}
+	t = time.Date(year, month, day, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+	t = t.AddDate(0, 0, sign*rd.days)
+	t = t.Add(time.Duration(sign) * (time.Duration(rd.hours)*time.Hour +
+		time.Duration(rd.minutes)*time.Minute + time.Duration(rd.seconds)*time.Second))
+	return dateValue{Time: t, dateOnly: dv.dateOnly}
+}
+
+// An evaluator evaluates a tokenized python-like expression
+type evaluator struct {
+	tokens []token
+	pos    int
+	ctx    *types.Context
+}
+
+// peek returns the current token without consuming it
+func (e *evaluator) peek() token {
+	return e.tokens[e.pos]
+}
+
+// next consumes and returns the current token
+func (e *evaluator) next() token {
+	tok := e.tokens[e.pos]
+	if tok.kind != tokenEOF {
+		e.pos++
+	}
+	return tok
+}
+
+// expect consumes the current token and returns an error if it is not
+// the given punctuation.
+func (e *evaluator) expect(punct string) error {
+	tok := e.next()
+	if tok.kind != tokenPunct || tok.text != punct {
+		return fmt.Errorf("expected '%s' at position %d, got '%s'", punct, tok.pos, tok.text)
+	}
+	return nil
+}
+
+// accept consumes the current token if it is the given punctuation
+// and returns true. It returns false otherwise.
+func (e *evaluator) accept(punct string) bool {
+	tok := e.peek()
+	if tok.kind == tokenPunct && tok.text == punct {
+		e.pos++
+		return true
+	}
+	return false
+}
+
+// expression evaluates additions and substractions
+func (e *evaluator) expression() (interface{}, error) {
+	left, err := e.term()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		var sign int
+		switch {
+		case e.accept("+"):
+			sign = 1
+		case e.accept("-"):
+			sign = -1
+		default:
+			return left, nil
+		}
+		right, err := e.term()
+		if err != nil {
+			return nil, err
+		}
+		left, err = addValues(left, right, sign)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// term evaluates multiplications, divisions and modulos
+func (e *evaluator) term() (interface{}, error) {
+	left, err := e.unary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		tok := e.peek()
+		if tok.kind != tokenPunct || (tok.text != "*" && tok.text != "/" && tok.text != "%") {
+			return left, nil
+		}
+		e.next()
+		right, err := e.unary()
+		if err != nil {
+			return nil, err
+		}
+		left, err = multiplyValues(left, right, tok.text)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// unary evaluates an optionally negated postfix expression
+func (e *evaluator) unary() (interface{}, error) {
+	if e.accept("-") {
+		val, err := e.unary()
+		if err != nil {
+			return nil, err
+		}
+		switch v := val.(type) {
+		case int64:
+			return -v, nil
+		case float64:
+			return -v, nil
+		}
+		return nil, fmt.Errorf("cannot negate %v", val)
+	}
+	return e.postfix()
+}
+
+// postfix evaluates a primary expression followed by method calls
+// such as .strftime('%Y-%m-%d')
+func (e *evaluator) postfix() (interface{}, error) {
+	val, err := e.primary()
+	if err != nil {
+		return nil, err
+	}
+	for e.accept(".") {
+		name := e.next()
+		if name.kind != tokenName {
+			return nil, fmt.Errorf("expected method name at position %d", name.pos)
+		}
+		args, kwargs, err := e.callArgs()
+		if err != nil {
+			return nil, err
+		}
+		val, err = callMethod(val, name.text, args, kwargs)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return val, nil
+}
+
+// primary evaluates literals, parenthesized expressions and function calls
+func (e *evaluator) primary() (interface{}, error) {
+	tok := e.next()
+	switch tok.kind {
+	case tokenNumber:
+		return parseNumber(tok.text)
+	case tokenString:
+		return tok.value, nil
+	case tokenPunct:
+		switch tok.text {
+		case "(":
+			val, err := e.expression()
+			if err != nil {
+				return nil, err
+			}
+			return val, e.expect(")")
+		case "[":
+			var res []interface{}
+			for !e.accept("]") {
+				val, err := e.expression()
+				if err != nil {
+					return nil, err
+				}
+				res = append(res, val)
+				if !e.accept(",") {
+					if err := e.expect("]"); err != nil {
+						return nil, err
+					}
+					break
+				}
+			}
+			return res, nil
+		}
+	case tokenName:
+		return e.name(tok)
+	}
+	return nil, fmt.Errorf("unexpected token '%s' at position %d", tok.text, tok.pos)
+}
+
+// name evaluates the dotted name starting with the given token and
+// calls it if it is followed by parenthesis.
+func (e *evaluator) name(tok token) (interface{}, error) {
+	switch tok.text {
+	case "True":
+		return true, nil
+	case "False":
+		return false, nil
+	case "None":
+		return nil, nil
+	case "uid":
+		return toInt64(e.ctx.Get("uid")), nil
+	case "self":
+		if !e.ctx.HasKey("self") {
+			return nil, fmt.Errorf("self is only defined in the filter_domain of search view fields")
+		}
+		return e.ctx.Get("self"), nil
+	}
+	fullName := tok.text
+	for e.peek().kind == tokenPunct && e.peek().text == "." && e.tokens[e.pos+1].kind == tokenName &&
+		e.tokens[e.pos+2].kind == tokenPunct && (e.tokens[e.pos+2].text == "." || e.tokens[e.pos+2].text == "(") {
+		e.next()
+		fullName += "." + e.next().text
+	}
+	if e.peek().kind != tokenPunct || e.peek().text != "(" {
+		return nil, fmt.Errorf("unknown name '%s' at position %d", fullName, tok.pos)
+	}
+	args, kwargs, err := e.callArgs()
+	if err != nil {
+		return nil, err
+	}
+	return e.callFunction(fullName, args, kwargs)
+}
+
+// callArgs parses the arguments of a function call, including the parenthesis.
+func (e *evaluator) callArgs() ([]interface{}, map[string]interface{}, error) {
+	if err := e.expect("("); err != nil {
+		return nil, nil, err
+	}
+	var args []interface{}
+	kwargs := make(map[string]interface{})
+	for !e.accept(")") {
+		if e.peek().kind == tokenName && e.tokens[e.pos+1].kind == tokenPunct && e.tokens[e.pos+1].text == "=" {
+			key := e.next().text
+			e.next()
+			val, err := e.expression()
+			if err != nil {
+				return nil, nil, err
+			}
+			kwargs[key] = val
+		} else {
+			val, err := e.expression()
+			if err != nil {
+				return nil, nil, err
+			}
+			args = append(args, val)
+		}
+		if !e.accept(",") {
+			if err := e.expect(")"); err != nil {
+				return nil, nil, err
+			}
+			break
+		}
+	}
+	return args, kwargs, nil
+}
+
+// location returns the time.Location of the 'tz' key of the context
+// or UTC if it is not set or invalid.
+func (e *evaluator) location() *time.Location {
+	tz, _ := e.ctx.Get("tz").(string)
+	if tz == "" {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		log.Warn("Invalid timezone in context, using UTC", "tz", tz, "error", err)
+		return time.UTC
+	}
+	return loc
+}
+
+// callFunction evaluates the function with the given dotted name.
+func (e *evaluator) callFunction(name string, args []interface{}, kwargs map[string]interface{}) (interface{}, error) {
+	switch name {
+	case "context_today", "datetime.date.today":
+		today := now().In(e.location())
+		return dateValue{Time: time.Date(today.Year(), today.Month(), today.Day(), 0, 0, 0, 0, time.UTC), dateOnly: true}, nil
+	case "datetime.datetime.now":
+		return dateValue{Time: now()}, nil
+	case "time.strftime":
+		if len(args) != 1 {
+			return nil, fmt.Errorf("time.strftime takes exactly one argument")
+		}
+		return callMethod(dateValue{Time: now().In(e.location())}, "strftime", args, kwargs)
+	case "relativedelta", "datetime.timedelta", "timedelta":
+		var rd relativeDelta
+		for key, val := range kwargs {
+			num := int(toInt64(val))
+			switch key {
+			case "years":
+				rd.years = num
+			case "months":
+				rd.months = num
+			case "weeks":
+				rd.days += 7 * num
+			case "days":
+				rd.days += num
+			case "hours":
+				rd.hours = num
+			case "minutes":
+				rd.minutes = num
+			case "seconds":
+				rd.seconds = num
+			case "year":
+				rd.year = num
+			case "month":
+				rd.month = num
+			case "day":
+				rd.day = num
+			default:
+				return nil, fmt.Errorf("unknown argument '%s' for %s", key, name)
+			}
+		}
+		return rd, nil
+	case "context.get":
+		if len(args) < 1 || len(args) > 2 {
+			return nil, fmt.Errorf("context.get takes one or two arguments")
+		}
+		key, ok := args[0].(string)
+		if !ok {
+			return nil, fmt.Errorf("context key must be a string, got %v", args[0])
+		}
+		if e.ctx.HasKey(key) {
+			return e.ctx.Get(key), nil
+		}
+		if len(args) == 2 {
+			return args[1], nil
+		}
+		return nil, nil
+	}
+	return nil, fmt.Errorf("unknown function '%s'", name)
+}
+
+// callMethod calls the method with the given name on the given value.
+func callMethod(val interface{}, name string, args []interface{}, kwargs map[string]interface{}) (interface{}, error) {
+	dv, ok := val.(dateValue)
+	if !ok || name != "strftime" {
+		return nil, fmt.Errorf("unknown method '%s' on %v", name, val)
+	}
+	if len(args) != 1 {
+		return nil, fmt.Errorf("strftime takes exactly one argument")
+	}
+	format, ok := args[0].(string)
+	if !ok {
+		return nil, fmt.Errorf("strftime format must be a string, got %v", args[0])
+	}
+	return strftime(dv.Time, format), nil
+}
+
+// addValues returns left + sign * right.
+func addValues(left, right interface{}, sign int) (interface{}, error) {
+	switch l := left.(type) {
+	case dateValue:
+		if rd, ok := right.(relativeDelta); ok {
+			return rd.applyTo(l, sign), nil
+		}
+	case relativeDelta:
+		if dv, ok := right.(dateValue); ok && sign == 1 {
+			return l.applyTo(dv, 1), nil
+		}
+	case int64:
+		switch r := right.(type) {
+		case int64:
+			return l + int64(sign)*r, nil
+		case float64:
+			return float64(l) + float64(sign)*r, nil
+		}
+	case float64:
+		switch r := right.(type) {
+		case int64:
+			return l + float64(sign)*float64(r), nil
+		case float64:
+			return l + float64(sign)*r, nil
+		}
+	case string:
+		if r, ok := right.(string); ok && sign == 1 {
+			return l + r, nil
+		}
+	}
+	return nil, fmt.Errorf("unsupported operation between %v and %v", left, right)
+}
+
+// multiplyValues returns left * right, left / right or left % right depending
+// on the given operator. Divisions always return a float64 as in python 3, and
+// the result of modulos has the sign of right.
+func multiplyValues(left, right interface{}, op string) (interface{}, error) {
+	l, lInt := left.(int64)
+	r, rInt := right.(int64)
+	if lInt && rInt {
+		switch op {
+		case "*":
+			return l * r, nil
+		case "%":
+			if r == 0 {
+				return nil, fmt.Errorf("integer modulo by zero")
+			}
+			res := l % r
+			if res != 0 && (res < 0) != (r < 0) {
+				res += r
+			}
+			return res, nil
+		}
+	}
+	lf, lOk := toFloat64(left)
+	rf, rOk := toFloat64(right)
+	if !lOk || !rOk {
+		return nil, fmt.Errorf("unsupported operation '%s' between %v and %v", op, left, right)
+	}
+	switch op {
+	case "*":
+		return lf * rf, nil
+	case "/":
+		if rf == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		return lf / rf, nil
+	}
+	if rf == 0 {
+		return nil, fmt.Errorf("float modulo by zero")
+	}
+	return lf - rf*math.Floor(lf/rf), nil
+}
+
+// toFloat64 converts the given int64 or float64 value to float64.
+// The returned bool is false if the value is not one of these types.
+func toFloat64(val interface{}) (float64, bool) {
+	switch v := val.(type) {
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
+
+// strftime formats the given time with the given python strftime format.
+func strftime(t time.Time, format string) string {
+	replacer := strings.NewReplacer(
+		"%Y", fmt.Sprintf("%04d", t.Year()),
+		"%m", fmt.Sprintf("%02d", t.Month()),
+		"%d", fmt.Sprintf("%02d", t.Day()),
+		"%H", fmt.Sprintf("%02d", t.Hour()),
+		"%M", fmt.Sprintf("%02d", t.Minute()),
+		"%S", fmt.Sprintf("%02d", t.Second()),
+		"%%", "%",
+	)
+	return replacer.Replace(format)
+}
+
+// parseNumber parses the given number literal into an int64 or a float64
+func parseNumber(text string) (interface{}, error) {
+	if i, err := strconv.ParseInt(text, 10, 64); err == nil {
+		return i, nil
+	}
+	f, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid number '%s'", text)
+	}
+	return f, nil
+}
+
+// toInt64 converts the given numeric value to int64. It returns 0 if
+// the value is not a number.
+func toInt64(val interface{}) int64 {
+	switch v := val.(type) {
+	case int64:
+		return v
+	case int:
+		return int64(v)
+	case int32:
+		return int64(v)
+	case float64:
+		return int64(v)
+	case float32:
+		return int64(v)
+	}
+	return 0
+}
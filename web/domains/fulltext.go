@@ -0,0 +1,169 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package domains
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/npiganeau/yep/yep/models"
+	"github.com/npiganeau/yep/yep/models/operator"
+)
+
+// Full-text search domain operators. Both are equivalent and match the
+// records whose search vector matches the words of the given value.
+const (
+	OperatorSearch   operator.Operator = "search"
+	OperatorFullText operator.Operator = "@@"
+)
+
+// defaultSearchConfig is the text search configuration used when none is given
+const defaultSearchConfig = "simple"
+
+// searchVectorColumn is the name of the column storing the search vector in
+// the table of the models with a declared SearchVector.
+const searchVectorColumn = "search_vector"
+
+// A SearchVector defines the fields of a model on which full-text search is
+// performed, and the PostgreSQL text search configuration to use.
+type SearchVector struct {
+	// Config is the name of the PostgreSQL text search configuration
+	// such as 'english' or 'french'. Defaults to 'simple'.
+	Config string
+	// Fields maps the names of the fields to include in the search vector
+	// with their weight ('A', 'B', 'C' or 'D', 'A' being the highest).
+	Fields map[string]string
+}
+
+var (
+	// searchVectors holds the SearchVector of each model
+	searchVectors = make(map[string]SearchVector)
+	// configRegexp matches valid text search configuration names
+	configRegexp = regexp.MustCompile(`^[a-z_]+$`)
+	// fieldRegexp matches valid field names
+	fieldRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+// RegisterSearchVector declares the given SearchVector for the given model.
+// Full-text search terms on this model will search all the fields of the vector
+// and NameSearch with the 'search' operator will order its results by relevance.
+// The vector is stored in a generated column of the table of the model, which
+// is created by SyncSearchVectors.
+func RegisterSearchVector(modelName string, sv SearchVector) {
+	if sv.Config == "" {
+		sv.Config = defaultSearchConfig
+	}
+	if !configRegexp.MatchString(sv.Config) {
+		log.Panic("Invalid text search configuration", "model", modelName, "config", sv.Config)
+	}
+	for field, weight := range sv.Fields {
+		switch weight {
+		case "A", "B", "C", "D":
+		default:
+			log.Panic("Invalid search vector weight", "model", modelName, "field", field, "weight", weight)
+		}
+	}
+	searchVectors[modelName] = sv
+}
+
+// GetSearchVector returns the SearchVector declared for the given model
+// and true, or false if the model has no declared search vector.
+func GetSearchVector(modelName string) (SearchVector, bool) {
+	sv, ok := searchVectors[modelName]
+	return sv, ok
+}
+
+// vectorSQL returns the SQL expression of this SearchVector for the given model
+func (sv SearchVector) vectorSQL(rc models.RecordCollection) string {
+	fields := make([]string, 0, len(sv.Fields))
+	for field := range sv.Fields {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	parts := make([]string, len(fields))
+	for i, field := range fields {
+		parts[i] = fmt.Sprintf("setweight(to_tsvector('%s'::regconfig, coalesce(%s, '')), '%s')",
+			sv.Config, rc.Model().JSONizeFieldName(field), sv.Fields[field])
+	}
+	return strings.Join(parts, " || ")
+}
+
+// SyncSearchVectors creates the generated column storing the search vector
+// and its GIN index in the table of each model with a declared SearchVector.
+// The column is recreated if the SearchVector has changed since it was created.
+// It must be called once the tables of all models have been created.
+//
+// Generated columns require PostgreSQL 12 or later.
+func SyncSearchVectors(env models.Environment) {
+	for modelName, sv := range searchVectors {
+		rc := env.Pool(modelName)
+		table := rc.Model().TableName()
+		vector := sv.vectorSQL(rc)
+		// The vector expression is stored as the comment of the column
+		// so that we can find out whether it must be recreated.
+		var comments []string
+		env.Cr().Select(&comments, `SELECT coalesce(col_description(attrelid, attnum), '') FROM pg_attribute
+			WHERE attrelid = ?::regclass AND attname = ? AND NOT attisdropped`, table, searchVectorColumn)
+		if len(comments) == 1 && comments[0] == vector {
+			continue
+		}
+		log.Debug("Creating search vector column", "model", modelName, "vector", vector)
+		env.Cr().Execute(fmt.Sprintf("ALTER TABLE %s DROP COLUMN IF EXISTS %s", table, searchVectorColumn))
+		env.Cr().Execute(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s tsvector GENERATED ALWAYS AS (%s) STORED",
+			table, searchVectorColumn, vector))
+		env.Cr().Execute(fmt.Sprintf("CREATE INDEX %s_%s_index ON %s USING gin (%s)",
+			table, searchVectorColumn, table, searchVectorColumn))
+		env.Cr().Execute(fmt.Sprintf("COMMENT ON COLUMN %s.%s IS '%s'",
+			table, searchVectorColumn, strings.Replace(vector, "'", "''", -1)))
+	}
+}
+
+// FullTextSearch returns the ids of the records of the model of rc
+// whose search vector matches the given text, ordered by relevance.
+// If limit is positive, at most limit ids are returned, starting
+// at the given offset.
+//
+// If the model has a declared search vector, the search is made on its
+// stored column. Otherwise it is made on the given fallback field only,
+// whose vector is computed for each row.
+func FullTextSearch(rc models.RecordCollection, text string, fallbackField string, limit, offset int) []int64 {
+	sv, ok := GetSearchVector(rc.ModelName())
+	vector := searchVectorColumn
+	if !ok {
+		sv = SearchVector{Config: defaultSearchConfig, Fields: map[string]string{fallbackField: "A"}}
+		vector = fmt.Sprintf("(%s)", sv.vectorSQL(rc))
+	}
+	query := fmt.Sprintf(`SELECT id FROM %s WHERE %s @@ plainto_tsquery('%s', ?)
+		ORDER BY ts_rank(%s, plainto_tsquery('%s', ?)) DESC, id`,
+		rc.Model().TableName(), vector, sv.Config, vector, sv.Config)
+	args := []interface{}{text, text}
+	if limit > 0 {
+		query += " LIMIT ? OFFSET ?"
+		args = append(args, limit, offset)
+	}
+	var ids []int64
+	rc.Env().Cr().Select(&ids, query, args...)
+	return ids
+}
+
+// resolveFullTextSearch rewrites a full-text search term into an 'in' term
+// with the ids of the matching records.
+func resolveFullTextSearch(rc models.RecordCollection, term DomainTerm) DomainTerm {
+	fieldName, ok := term[0].(string)
+	if !ok || !fieldRegexp.MatchString(fieldName) {
+		log.Panic("Malformed domain term", "term", term)
+	}
+	text, ok := term[2].(string)
+	if !ok {
+		log.Panic("Full-text search value must be a string", "term", term)
+	}
+	return DomainTerm{"ID", "in", FullTextSearch(rc, text, fieldName, 0, 0)}
+}
+
+func init() {
+	RegisterOperatorResolver(OperatorSearch, resolveFullTextSearch)
+	RegisterOperatorResolver(OperatorFullText, resolveFullTextSearch)
+}
@@ -0,0 +1,279 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package domains
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ParseLiteral parses the given python literal domain string, such as
+// "['|', ('Name', 'ilike', 'John'), ('User', '=', uid)]", into a Domain.
+//
+// Lists and tuples are both parsed as lists, None as nil, True and False as
+// booleans and numbers as int64 or float64.
+// Values that are not literals (such as uid or context_today()) are returned
+// as Expression to be evaluated later by ResolvePlaceholders. This includes
+// self in the filter_domain of search view fields, which is bound to the
+// searched text by ResolveFilterDomain.
+//
+// An empty string, "[]", "False" or "None" is parsed as an empty Domain.
+func ParseLiteral(src string) (Domain, error) {
+	switch strings.TrimSpace(src) {
+	case "", "False", "None":
+		return Domain{}, nil
+	}
+	tokens, err := tokenize(src)
+	if err != nil {
+		return nil, err
+	}
+	lp := literalParser{tokens: tokens, src: []rune(src)}
+	val, err := lp.value()
+	if err != nil {
+		return nil, err
+	}
+	if lp.peek().kind != tokenEOF {
+		return nil, fmt.Errorf("unexpected token '%s' at position %d in domain %s", lp.peek().text, lp.peek().pos, src)
+	}
+	list, ok := val.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("domain must be a list, got %s", src)
+	}
+	res := make(Domain, len(list))
+	for i, item := range list {
+		switch it := item.(type) {
+		case string:
+			switch DomainPrefixOperator(it) {
+			case PREFIX_AND, PREFIX_OR, PREFIX_NOT:
+			default:
+				return nil, fmt.Errorf("unknown prefix operator '%s' in domain %s", it, src)
+			}
+		case []interface{}:
+			if len(it) != 3 {
+				return nil, fmt.Errorf("domain terms must have 3 elements, got %v in domain %s", it, src)
+			}
+		default:
+			return nil, fmt.Errorf("unexpected element %v in domain %s", item, src)
+		}
+		res[i] = item
+	}
+	return res, nil
+}
+
+// Literal returns the given domain as a python literal string that can be
+// parsed by ParseLiteral or evaluated by the client.
+func (d Domain) Literal() string {
+	items := make([]string, len(d))
+	for i, term := range d {
+		switch t := term.(type) {
+		case string:
+			items[i] = formatLiteral(t)
+		case []interface{}:
+			items[i] = formatTerm(t)
+		case DomainTerm:
+			items[i] = formatTerm(t)
+		default:
+			log.Panic("Unexpected Domain term", "domain", d)
+		}
+	}
+	return fmt.Sprintf("[%s]", strings.Join(items, ", "))
+}
+
+// formatTerm returns the given domain term as a python tuple literal
+func formatTerm(term []interface{}) string {
+	items := make([]string, len(term))
+	for i, val := range term {
+		items[i] = formatLiteral(val)
+	}
+	return fmt.Sprintf("(%s)", strings.Join(items, ", "))
+}
+
+// formatLiteral returns the given value as a python literal.
+func formatLiteral(val interface{}) string {
+	switch v := val.(type) {
+	case nil:
+		return "None"
+	case bool:
+		if v {
+			return "True"
+		}
+		return "False"
+	case Expression:
+		return string(v)
+	case string:
+		return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`, "\n", `\n`).Replace(v) + "'"
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32)
+	case []interface{}:
+		items := make([]string, len(v))
+		for i, item := range v {
+			items[i] = formatLiteral(item)
+		}
+		return fmt.Sprintf("[%s]", strings.Join(items, ", "))
+	case []int64:
+		items := make([]string, len(v))
+		for i, item := range v {
+			items[i] = strconv.FormatInt(item, 10)
+		}
+		return fmt.Sprintf("[%s]", strings.Join(items, ", "))
+	}
+	return fmt.Sprintf("%v", val)
+}
+
+// A literalParser parses python literals from a list of tokens
+type literalParser struct {
+	tokens []token
+	pos    int
+	src    []rune
+}
+
+// peek returns the current token without consuming it
+func (lp *literalParser) peek() token {
+	return lp.tokens[lp.pos]
+}
+
+// next consumes and returns the current token
+func (lp *literalParser) next() token {
+	tok := lp.tokens[lp.pos]
+	if tok.kind != tokenEOF {
+		lp.pos++
+	}
+	return tok
+}
+
+// isPunct returns true if the current token is the given punctuation
+func (lp *literalParser) isPunct(punct string) bool {
+	tok := lp.peek()
+	return tok.kind == tokenPunct && tok.text == punct
+}
+
+// value parses a python value. If the value is not a literal, it
+// is returned as an Expression.
+func (lp *literalParser) value() (interface{}, error) {
+	start := lp.pos
+	val, isLiteral, err := lp.literal()
+	if err != nil {
+		return nil, err
+	}
+	if isLiteral && lp.atValueEnd() {
+		return val, nil
+	}
+	lp.pos = start
+	return lp.expression()
+}
+
+// atValueEnd returns true if the current token ends a value
+func (lp *literalParser) atValueEnd() bool {
+	return lp.peek().kind == tokenEOF || lp.isPunct(",") || lp.isPunct("]") || lp.isPunct(")")
+}
+
+// literal parses a python literal value. The returned bool is false if
+// the value at the current position is not a literal.
+func (lp *literalParser) literal() (interface{}, bool, error) {
+	tok := lp.next()
+	switch tok.kind {
+	case tokenString:
+		return tok.value, true, nil
+	case tokenNumber:
+		val, err := parseNumber(tok.text)
+		return val, err == nil, nil
+	case tokenName:
+		switch tok.text {
+		case "True":
+			return true, true, nil
+		case "False":
+			return false, true, nil
+		case "None":
+			return nil, true, nil
+		}
+		return nil, false, nil
+	case tokenPunct:
+		switch tok.text {
+		case "-":
+			if lp.peek().kind != tokenNumber {
+				return nil, false, nil
+			}
+			val, err := parseNumber(lp.next().text)
+			switch v := val.(type) {
+			case int64:
+				return -v, true, nil
+			case float64:
+				return -v, true, nil
+			}
+			return nil, false, err
+		case "[", "(":
+			closing := "]"
+			if tok.text == "(" {
+				closing = ")"
+			}
+			res := []interface{}{}
+			for !lp.isPunct(closing) {
+				val, err := lp.value()
+				if err != nil {
+					return nil, false, err
+				}
+				res = append(res, val)
+				if !lp.isPunct(",") {
+					break
+				}
+				lp.next()
+			}
+			if !lp.isPunct(closing) {
+				return nil, false, fmt.Errorf("expected '%s' at position %d, got '%s'", closing, lp.peek().pos, lp.peek().text)
+			}
+			lp.next()
+			if tok.text == "(" && len(res) == 1 && lp.tokens[lp.pos-2].text != "," {
+				// This is a parenthesized expression, not a tuple
+				return nil, false, nil
+			}
+			return res, true, nil
+		}
+	}
+	return nil, false, nil
+}
+
+// expression consumes tokens until the end of the current value and
+// returns the corresponding source as an Expression.
+func (lp *literalParser) expression() (interface{}, error) {
+	start := lp.peek().pos
+	depth := 0
+	for {
+		tok := lp.peek()
+		if tok.kind == tokenEOF {
+			if depth > 0 {
+				return nil, fmt.Errorf("unbalanced parenthesis in expression at position %d", start)
+			}
+			break
+		}
+		if tok.kind == tokenPunct {
+			switch tok.text {
+			case "(", "[":
+				depth++
+			case ")", "]":
+				if depth == 0 {
+					return lp.expressionFrom(start, tok.pos)
+				}
+				depth--
+			case ",":
+				if depth == 0 {
+					return lp.expressionFrom(start, tok.pos)
+				}
+			}
+		}
+		lp.next()
+	}
+	return lp.expressionFrom(start, len(lp.src))
+}
+
+// expressionFrom returns the source between start and end as an Expression
+func (lp *literalParser) expressionFrom(start, end int) (interface{}, error) {
+	expr := strings.TrimSpace(string(lp.src[start:end]))
+	if expr == "" {
+		return nil, fmt.Errorf("empty expression at position %d", start)
+	}
+	return Expression(expr), nil
+}
@@ -0,0 +1,237 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package domains
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/npiganeau/yep/yep/models"
+	"github.com/npiganeau/yep/yep/models/operator"
+)
+
+// Domain operators that are not supported by the ORM directly and that
+// must be resolved by ResolveOperators before the domain is parsed.
+const (
+	OperatorChildOf  operator.Operator = "child_of"
+	OperatorParentOf operator.Operator = "parent_of"
+)
+
+// An OperatorResolver rewrites the given domain term with a custom operator
+// into an equivalent term that can be understood by the ORM.
+// rc is an empty RecordCollection of the model on which the domain applies.
+type OperatorResolver func(rc models.RecordCollection, term DomainTerm) DomainTerm
+
+// operatorResolvers holds the registered OperatorResolver for each custom operator
+var operatorResolvers = make(map[operator.Operator]OperatorResolver)
+
+// RegisterOperatorResolver registers the given OperatorResolver for the
+// given operator, so that domain terms with this operator are rewritten
+// by ResolveOperators.
+func RegisterOperatorResolver(op operator.Operator, resolver OperatorResolver) {
+	operatorResolvers[op] = resolver
+}
+
+// ResolveOperators returns a copy of the given domain in which the terms with
+// a custom operator (such as child_of or parent_of) have been rewritten into
+// terms that the ORM understands. rc is a RecordCollection of the model on which
+// the domain applies.
+func ResolveOperators(dom Domain, rc models.RecordCollection) Domain {
+	if len(dom) == 0 {
+		return dom
+	}
+	res := make(Domain, len(dom))
+	for i, term := range dom {
+		t, ok := term.([]interface{})
+		if !ok || len(t) != 3 {
+			res[i] = term
+			continue
+		}
+		opStr, _ := t[1].(string)
+		resolver, exists := operatorResolvers[operator.Operator(opStr)]
+		if !exists {
+			res[i] = term
+			continue
+		}
+		res[i] = []interface{}(resolver(rc, DomainTerm(t)))
+	}
+	return res
+}
+
+// resolveChildOf rewrites a 'child_of' term into an 'in' term with
+// the ids of the given records and all their descendants.
+func resolveChildOf(rc models.RecordCollection, term DomainTerm) DomainTerm {
+	fieldName, target := hierarchyTarget(rc, term)
+	ids := valueToIDs(target, term[2])
+	return DomainTerm{fieldName, "in", getDescendantIDs(target, ids)}
+}
+
+// resolveParentOf rewrites a 'parent_of' term into an 'in' term with
+// the ids of the given records and all their ancestors.
+func resolveParentOf(rc models.RecordCollection, term DomainTerm) DomainTerm {
+	fieldName, target := hierarchyTarget(rc, term)
+	ids := valueToIDs(target, term[2])
+	return DomainTerm{fieldName, "in", getAncestorIDs(target, ids)}
+}
+
+// hierarchyTarget returns the field name of the given term and an empty
+// RecordCollection of the model on which the hierarchy must be computed.
+// This is the model of rc if the field is 'ID' or the related model otherwise.
+func hierarchyTarget(rc models.RecordCollection, term DomainTerm) (string, models.RecordCollection) {
+	fieldName, ok := term[0].(string)
+	if !ok {
+		log.Panic("Malformed domain term", "term", term)
+	}
+	fieldJSON := rc.Model().JSONizeFieldName(fieldName)
+	if fieldJSON == "id" {
+		return fieldName, rc.Env().Pool(rc.ModelName())
+	}
+	fInfos := rc.Call("FieldsGet", models.FieldsGetArgs{}).(map[string]*models.FieldInfo)
+	fi, exists := fInfos[fieldJSON]
+	if !exists || fi.Relation == "" {
+		log.Panic("Hierarchical operators can only be used on ID or relation fields", "model", rc.ModelName(), "term", term)
+	}
+	return fieldName, rc.Env().Pool(fi.Relation)
+}
+
+// parentField returns the name of the field pointing to the parent record
+// in the given model. Models that do not embed the HierarchyMixin must have
+// a 'Parent' field pointing to their own model.
+func parentField(rc models.RecordCollection) string {
+	fInfos := rc.Call("FieldsGet", models.FieldsGetArgs{}).(map[string]*models.FieldInfo)
+	if _, exists := fInfos["parent_path"]; exists {
+		return rc.Call("ParentFieldName").(string)
+	}
+	fi, exists := fInfos["parent_id"]
+	if !exists || fi.Relation != rc.ModelName() {
+		log.Panic("Hierarchical operators require a parent field", "model", rc.ModelName())
+	}
+	return "Parent"
+}
+
+// hasParentPath returns true if the given model stores the materialized
+// path of its records hierarchy (i.e. it embeds the HierarchyMixin).
+func hasParentPath(rc models.RecordCollection) bool {
+	fInfos := rc.Call("FieldsGet", models.FieldsGetArgs{}).(map[string]*models.FieldInfo)
+	_, exists := fInfos["parent_path"]
+	return exists
+}
+
+// getDescendantIDs returns the given ids and the ids of all the descendants
+// of the records with these ids in the model of rc.
+func getDescendantIDs(rc models.RecordCollection, ids []int64) []int64 {
+	if len(ids) == 0 {
+		return ids
+	}
+	if hasParentPath(rc) {
+		var cond *models.Condition
+		for _, id := range ids {
+			c := rc.Model().Field("ParentPath").AddOperator(operator.Operator("like"), fmt.Sprintf("/%d/", id))
+			if cond == nil {
+				cond = c
+				continue
+			}
+			cond = cond.OrCond(c)
+		}
+		return rc.Search(cond).Ids()
+	}
+	pField := parentField(rc)
+	seen := make(map[int64]bool)
+	res := make([]int64, 0, len(ids))
+	frontier := ids
+	for len(frontier) > 0 {
+		var next []int64
+		for _, id := range frontier {
+			if !seen[id] {
+				seen[id] = true
+				res = append(res, id)
+				next = append(next, id)
+			}
+		}
+		if len(next) == 0 {
+			break
+		}
+		frontier = rc.Search(rc.Model().Field(pField).In(next)).Ids()
+	}
+	return res
+}
+
+// getAncestorIDs returns the given ids and the ids of all the ancestors
+// of the records with these ids in the model of rc.
+func getAncestorIDs(rc models.RecordCollection, ids []int64) []int64 {
+	if len(ids) == 0 {
+		return ids
+	}
+	seen := make(map[int64]bool)
+	res := make([]int64, 0, len(ids))
+	if hasParentPath(rc) {
+		for _, rec := range rc.Search(rc.Model().Field("ID").In(ids)).Records() {
+			for _, id := range parentPathIDs(rec.Get("ParentPath").(string)) {
+				if !seen[id] {
+					seen[id] = true
+					res = append(res, id)
+				}
+			}
+		}
+		return res
+	}
+	pField := parentField(rc)
+	frontier := ids
+	for len(frontier) > 0 {
+		var next []int64
+		for _, rec := range rc.Search(rc.Model().Field("ID").In(frontier)).Records() {
+			if seen[rec.Ids()[0]] {
+				continue
+			}
+			seen[rec.Ids()[0]] = true
+			res = append(res, rec.Ids()[0])
+			if parent := rec.Get(pField).(models.RecordCollection); !parent.IsEmpty() {
+				next = append(next, parent.Ids()[0])
+			}
+		}
+		frontier = next
+	}
+	return res
+}
+
+// parentPathIDs returns the ids of the given materialized parent path.
+// A parent path is in the form "/1/5/7/" where 7 is the id of the record
+// and 1 and 5 the ids of its ancestors.
+func parentPathIDs(path string) []int64 {
+	var res []int64
+	for _, idStr := range strings.Split(strings.Trim(path, "/"), "/") {
+		id, err := strconv.ParseInt(idStr, 10, 64)
+		if err != nil {
+			continue
+		}
+		res = append(res, id)
+	}
+	return res
+}
+
+// valueToIDs returns the list of ids given as value of a hierarchical domain
+// term. The value can be an id, a list of ids or a name to search for.
+func valueToIDs(rc models.RecordCollection, value interface{}) []int64 {
+	switch v := value.(type) {
+	case string:
+		return rc.Search(rc.Model().Field("Name").AddOperator(operator.Operator("ilike"), strings.TrimSpace(v))).Ids()
+	case []interface{}:
+		res := make([]int64, 0, len(v))
+		for _, item := range v {
+			res = append(res, valueToIDs(rc, item)...)
+		}
+		return res
+	case []int64:
+		return v
+	case nil, bool:
+		return []int64{}
+	}
+	return []int64{toInt64(value)}
+}
+
+func init() {
+	RegisterOperatorResolver(OperatorChildOf, resolveChildOf)
+	RegisterOperatorResolver(OperatorParentOf, resolveParentOf)
+}
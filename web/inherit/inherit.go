@@ -0,0 +1,364 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+/*
+Package inherit allows modules to extend the views of other modules
+instead of copying them.
+
+An extension is registered with the id of the view it inherits from
+(inherit_id) and an arch made of one or more specification elements,
+optionally wrapped in a <data> element:
+
+	inherit.Register("base_view_users_form", `
+	<data>
+		<xpath expr="//field[@name='Login']" position="after">
+			<field name="Signature"/>
+		</xpath>
+		<field name="Email" position="attributes">
+			<attribute name="invisible">0</attribute>
+		</field>
+	</data>`)
+
+A specification is either an <xpath expr="..."> element, or any other
+element whose attributes identify the element to locate (shorthand).
+The position attribute defines what is done with the content of the
+specification relative to the located element:
+
+  - inside (default): appended as last children
+  - before, after: inserted as siblings
+  - replace: replaces the located element
+  - attributes: each <attribute name="x">value</attribute> child sets the
+    attribute x to value, or removes it if value is empty
+
+A child of a specification with position="move" is not copied: it locates
+an element of the view which is moved to the position of the specification.
+The following moves the Email field before the Login field:
+
+	<field name="Login" position="before">
+		<field name="Email" position="move"/>
+	</field>
+
+Extensions are applied in registration order when the view is requested,
+that is in module load order if Register is called in the init function of
+the modules. An extension can therefore locate elements added by the
+extensions of the modules it depends on.
+
+Extensions can also be declared in the views XML files of the modules, as
+views with an inherit_id attribute whose content is the extension arch:
+
+	<view id="my_module_view_users_form" inherit_id="base_view_users_form">
+		<field name="Login" position="after">
+			<field name="Signature"/>
+		</field>
+	</view>
+
+They are registered with RegisterAt when the views are loaded, after the
+extensions registered in Go, in module load order.
+*/
+package inherit
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/npiganeau/yep/yep/tools/etree"
+	"github.com/npiganeau/yep/yep/tools/logging"
+)
+
+// An extension is a registered modification of a view
+type extension struct {
+	arch string
+	// location is the file and line where the extension has been registered
+	location string
+}
+
+var (
+	log *logging.Logger
+	mu  sync.RWMutex
+	// extensions holds the registered extensions of each view
+	extensions = make(map[string][]extension)
+)
+
+// Register adds the given extension arch to the view with the given id.
+// It panics if the arch is not valid XML or has no specification element.
+func Register(viewID, arch string) {
+	location := "unknown location"
+	if _, file, line, ok := runtime.Caller(1); ok {
+		location = fmt.Sprintf("%s:%d", file, line)
+	}
+	if err := RegisterAt(viewID, arch, location); err != nil {
+		log.Panic("Invalid view extension", "view", viewID, "location", location, "error", err)
+	}
+}
+
+// RegisterAt adds the given extension arch to the view with the given id,
+// with the given location (e.g. the file and line of an XML view) for
+// error messages. It returns an error if the arch is not valid XML or
+// has no specification element.
+func RegisterAt(viewID, arch, location string) error {
+	if _, err := parseSpecs(arch); err != nil {
+		return err
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	extensions[viewID] = append(extensions[viewID], extension{arch: arch, location: location})
+	return nil
+}
+
+// Apply returns the given arch of the view with the given id
+// after applying all the extensions registered for this view.
+//
+// Extensions that cannot be applied, for instance because an element
+// cannot be located, are skipped and reported in the returned error.
+// The given arch is returned unchanged if it cannot be parsed.
+func Apply(viewID, arch string) (string, error) {
+	mu.RLock()
+	exts := extensions[viewID]
+	mu.RUnlock()
+	if len(exts) == 0 {
+		return arch, nil
+	}
+	doc := etree.NewDocument()
+	if err := doc.ReadFromString(arch); err != nil {
+		return arch, fmt.Errorf("unable to parse arch of view '%s': %s", viewID, err)
+	}
+	var errs []string
+	for _, ext := range exts {
+		specs, _ := parseSpecs(ext.arch)
+		extDoc := doc.Copy()
+		if err := applySpecs(extDoc, specs); err != nil {
+			errs = append(errs, fmt.Sprintf("extension of view '%s' registered at %s: %s", viewID, ext.location, err))
+			continue
+		}
+		doc = extDoc
+	}
+	res, err := doc.WriteToString()
+	if err != nil {
+		return arch, err
+	}
+	if len(errs) > 0 {
+		return res, errors.New(strings.Join(errs, "; "))
+	}
+	return res, nil
+}
+
+// Patch returns the given arch after applying the specifications of
+// the given patch, which has the same format as registered extensions.
+func Patch(arch, patch string) (string, error) {
+	specs, err := parseSpecs(patch)
+	if err != nil {
+		return "", fmt.Errorf("invalid patch: %s", err)
+	}
+	doc := etree.NewDocument()
+	if err := doc.ReadFromString(arch); err != nil {
+		return "", fmt.Errorf("unable to parse arch: %s", err)
+	}
+	if err := applySpecs(doc, specs); err != nil {
+		return "", err
+	}
+	return doc.WriteToString()
+}
+
+// parseSpecs returns the specification elements of the given extension arch
+func parseSpecs(arch string) ([]*etree.Element, error) {
+	doc := etree.NewDocument()
+	if err := doc.ReadFromString(arch); err != nil {
+		return nil, err
+	}
+	var res []*etree.Element
+	for _, elt := range doc.ChildElements() {
+		if elt.Tag == "data" {
+			res = append(res, elt.ChildElements()...)
+			continue
+		}
+		res = append(res, elt)
+	}
+	if len(res) == 0 {
+		return nil, errors.New("extension has no specification element")
+	}
+	for _, spec := range res {
+		if _, err := specPath(spec); err != nil {
+			return nil, err
+		}
+		for _, child := range spec.ChildElements() {
+			if child.SelectAttrValue("position", "") != "move" {
+				continue
+			}
+			if _, err := specPath(child); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return res, nil
+}
+
+// applySpecs applies the given specification elements in order to the given document
+func applySpecs(doc *etree.Document, specs []*etree.Element) error {
+	for _, spec := range specs {
+		if err := applySpec(doc, spec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applySpec applies the given specification element to the given document
+func applySpec(doc *etree.Document, spec *etree.Element) error {
+	path, err := specPath(spec)
+	if err != nil {
+		return err
+	}
+	anchor, err := findElement(doc, path)
+	if err != nil {
+		return err
+	}
+	if anchor == nil {
+		return fmt.Errorf("element '%s' cannot be located in parent view", path)
+	}
+	position := spec.SelectAttrValue("position", "inside")
+	if position == "attributes" {
+		return setAttributes(anchor, spec, path)
+	}
+	content, err := specContent(doc, spec, anchor)
+	if err != nil {
+		return err
+	}
+	switch position {
+	case "inside":
+		for _, elt := range content {
+			anchor.AddChild(elt)
+		}
+	case "before":
+		return insertSiblings(anchor, anchor, content)
+	case "after":
+		return insertSiblings(anchor, nextSibling(anchor), content)
+	case "replace":
+		if err := insertSiblings(anchor, anchor, content); err != nil {
+			return err
+		}
+		anchor.Parent().RemoveChild(anchor)
+	default:
+		return fmt.Errorf("invalid position '%s' for element '%s'", position, path)
+	}
+	return nil
+}
+
+// specContent returns the elements to insert for the given specification:
+// copies of its children, or the elements located by the children with
+// position="move", which are removed from their current position.
+func specContent(doc *etree.Document, spec, anchor *etree.Element) ([]*etree.Element, error) {
+	var res []*etree.Element
+	for _, child := range spec.ChildElements() {
+		if child.SelectAttrValue("position", "") != "move" {
+			res = append(res, child.Copy())
+			continue
+		}
+		path, err := specPath(child)
+		if err != nil {
+			return nil, err
+		}
+		elt, err := findElement(doc, path)
+		if err != nil {
+			return nil, err
+		}
+		if elt == nil {
+			return nil, fmt.Errorf("element '%s' to move cannot be located in parent view", path)
+		}
+		if elt == anchor {
+			return nil, fmt.Errorf("element '%s' cannot be moved relative to itself", path)
+		}
+		elt.Parent().RemoveChild(elt)
+		res = append(res, elt)
+	}
+	return res, nil
+}
+
+// setAttributes sets the attributes of the given anchor element
+// from the children of the given attributes specification.
+func setAttributes(anchor, spec *etree.Element, path string) error {
+	for _, attr := range spec.ChildElements() {
+		name := attr.SelectAttrValue("name", "")
+		if attr.Tag != "attribute" || name == "" {
+			return fmt.Errorf("invalid element '%s' in attributes specification of '%s'", attr.Tag, path)
+		}
+		if value := strings.TrimSpace(attr.Text()); value != "" {
+			anchor.CreateAttr(name, value)
+		} else {
+			anchor.RemoveAttr(name)
+		}
+	}
+	return nil
+}
+
+// specPath returns the path of the element located by the given specification.
+// Shorthand specifications match the first element with the same tag and
+// the same attributes, except position. Their attribute values must not
+// contain quotes or brackets.
+func specPath(spec *etree.Element) (string, error) {
+	if spec.Tag == "xpath" {
+		expr := spec.SelectAttrValue("expr", "")
+		if expr == "" {
+			return "", errors.New("xpath specification without expr attribute")
+		}
+		return expr, nil
+	}
+	path := "//" + spec.Tag
+	for _, attr := range spec.Attr {
+		if attr.Key == "position" {
+			continue
+		}
+		if strings.ContainsAny(attr.Value, "'[]") {
+			// Paths do not support escaping quotes and brackets
+			return "", fmt.Errorf("invalid value of attribute '%s' of '%s' specification: quotes and brackets are not allowed", attr.Key, spec.Tag)
+		}
+		path += fmt.Sprintf("[@%s='%s']", attr.Key, attr.Value)
+	}
+	return path, nil
+}
+
+// findElement returns the first element of doc matching the given path,
+// or an error if the path is not valid.
+func findElement(doc *etree.Document, path string) (elt *etree.Element, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("invalid path '%s': %v", path, r)
+		}
+	}()
+	return doc.FindElement(path), nil
+}
+
+// nextSibling returns the token following the given element
+// in its parent, or nil if it is the last one.
+func nextSibling(elt *etree.Element) etree.Token {
+	parent := elt.Parent()
+	for i, token := range parent.Child {
+		if token == etree.Token(elt) && i+1 < len(parent.Child) {
+			return parent.Child[i+1]
+		}
+	}
+	return nil
+}
+
+// insertSiblings inserts the given elements in the parent of anchor,
+// before the given token, or at the end of the parent if nil.
+func insertSiblings(anchor *etree.Element, before etree.Token, elements []*etree.Element) error {
+	parent := anchor.Parent()
+	if parent == nil || parent.Tag == "" {
+		return errors.New("cannot insert elements next to the root element of the view")
+	}
+	for _, elt := range elements {
+		if before == nil {
+			parent.AddChild(elt)
+			continue
+		}
+		parent.InsertChild(before, elt)
+	}
+	return nil
+}
+
+func init() {
+	log = logging.GetLogger("web")
+}
@@ -0,0 +1,136 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package inherit
+
+import (
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const baseArch = `<form string="Users">
+	<sheet>
+		<group name="main">
+			<field name="Name"/>
+			<field name="Login"/>
+		</group>
+		<field name="Email" invisible="1"/>
+	</sheet>
+</form>`
+
+func TestViewInheritance(t *testing.T) {
+	Convey("Testing view inheritance", t, func() {
+		Convey("Views without extensions should be returned as is", func() {
+			arch, err := Apply("test_view_no_ext", baseArch)
+			So(err, ShouldBeNil)
+			So(arch, ShouldEqual, baseArch)
+		})
+		Convey("Xpath specifications should insert elements at the given position", func() {
+			Register("test_view_xpath", `
+<data>
+	<xpath expr="//field[@name='Login']" position="before"><field name="Lang"/></xpath>
+	<xpath expr="//field[@name='Login']" position="after"><field name="Company"/><field name="Active"/></xpath>
+	<xpath expr="//group[@name='main']" position="inside"><field name="Signature"/></xpath>
+</data>`)
+			arch, err := Apply("test_view_xpath", baseArch)
+			So(err, ShouldBeNil)
+			So(arch, ShouldContainSubstring, `<field name="Name"/>
+			<field name="Lang"/><field name="Login"/><field name="Company"/><field name="Active"/>
+		<field name="Signature"/></group>`)
+		})
+		Convey("Shorthand specifications should locate elements by their attributes", func() {
+			Register("test_view_shorthand", `
+<data>
+	<field name="Email" position="replace"><field name="Email" widget="email"/></field>
+	<field name="Name" position="attributes">
+		<attribute name="required">1</attribute>
+	</field>
+</data>`)
+			arch, err := Apply("test_view_shorthand", baseArch)
+			So(err, ShouldBeNil)
+			So(arch, ShouldContainSubstring, `<field name="Name" required="1"/>`)
+			So(arch, ShouldContainSubstring, `<field name="Email" widget="email"/>`)
+			So(arch, ShouldNotContainSubstring, `invisible="1"`)
+		})
+		Convey("Empty attribute values should remove the attribute", func() {
+			Register("test_view_remove_attr", `<field name="Email" position="attributes"><attribute name="invisible"/></field>`)
+			arch, err := Apply("test_view_remove_attr", baseArch)
+			So(err, ShouldBeNil)
+			So(arch, ShouldContainSubstring, `<field name="Email"/>`)
+		})
+		Convey("Extensions should be applied in registration order", func() {
+			Register("test_view_order", `<field name="Login" position="after"><field name="Partner"/></field>`)
+			Register("test_view_order", `<field name="Partner" position="after"><field name="Groups"/></field>`)
+			arch, err := Apply("test_view_order", baseArch)
+			So(err, ShouldBeNil)
+			So(arch, ShouldContainSubstring, `<field name="Login"/><field name="Partner"/><field name="Groups"/>`)
+		})
+		Convey("Missing anchors should return an error with the extension location", func() {
+			Register("test_view_missing", `<field name="Unknown" position="after"><field name="Lang"/></field>`)
+			_, err := Apply("test_view_missing", baseArch)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "element '//field[@name='Unknown']' cannot be located in parent view")
+			So(err.Error(), ShouldContainSubstring, "inherit_test.go:")
+		})
+		Convey("Extensions that cannot be applied should be skipped", func() {
+			So(RegisterAt("test_view_skip", `<field name="Login" position="after"><field name="Lang"/></field>`, "views.xml:1"), ShouldBeNil)
+			So(RegisterAt("test_view_skip", `<data>
+	<field name="Login" position="after"><field name="Company"/></field>
+	<field name="Unknown" position="after"><field name="Active"/></field>
+</data>`, "views.xml:5"), ShouldBeNil)
+			arch, err := Apply("test_view_skip", baseArch)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "registered at views.xml:5")
+			So(arch, ShouldContainSubstring, `<field name="Login"/><field name="Lang"/>`)
+			So(arch, ShouldNotContainSubstring, `Company`)
+			So(arch, ShouldNotContainSubstring, `Active`)
+		})
+		Convey("Shorthand values with quotes or brackets should be rejected at registration", func() {
+			So(RegisterAt("test_view_quotes", `<field name="Login" string="User's login" position="after"/>`, "views.xml:1"), ShouldNotBeNil)
+			So(RegisterAt("test_view_quotes", `<field name="Name" position="before"><field name="Log[in]" position="move"/></field>`, "views.xml:1"), ShouldNotBeNil)
+			So(func() { Register("test_view_quotes", `<field name="it's" position="replace"/>`) }, ShouldPanic)
+			arch, err := Apply("test_view_quotes", baseArch)
+			So(err, ShouldBeNil)
+			So(arch, ShouldEqual, baseArch)
+		})
+		Convey("Invalid positions should return an error", func() {
+			Register("test_view_position", `<field name="Login" position="around"/>`)
+			_, err := Apply("test_view_position", baseArch)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "invalid position 'around'")
+		})
+		Convey("Elements with position move should be moved instead of copied", func() {
+			Register("test_view_move", `
+<data>
+	<field name="Name" position="before"><field name="Login" position="move"/></field>
+	<xpath expr="//group[@name='main']" position="inside"><xpath expr="//field[@name='Email']" position="move"/></xpath>
+</data>`)
+			arch, err := Apply("test_view_move", baseArch)
+			So(err, ShouldBeNil)
+			So(arch, ShouldContainSubstring, `<group name="main">
+			<field name="Login"/><field name="Name"/>`)
+			So(arch, ShouldContainSubstring, `<field name="Email" invisible="1"/></group>`)
+			So(strings.Count(arch, `name="Login"`), ShouldEqual, 1)
+			Register("test_view_move_missing", `<field name="Name" position="after"><field name="Lang" position="move"/></field>`)
+			_, err = Apply("test_view_move_missing", baseArch)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "element '//field[@name='Lang']' to move cannot be located in parent view")
+		})
+		Convey("Patches should be applied without registration", func() {
+			arch, err := Patch(baseArch, `<field name="Email" position="attributes"><attribute name="invisible"/></field>`)
+			So(err, ShouldBeNil)
+			So(arch, ShouldContainSubstring, `<field name="Email"/>`)
+			arch, err = Apply("test_view_patch", baseArch)
+			So(err, ShouldBeNil)
+			So(arch, ShouldEqual, baseArch)
+			_, err = Patch(baseArch, `<data/>`)
+			So(err, ShouldNotBeNil)
+		})
+		Convey("Invalid extension archs should panic at registration", func() {
+			So(func() { Register("test_view_invalid", `<data>`) }, ShouldPanic)
+			So(func() { Register("test_view_invalid", `<data/>`) }, ShouldPanic)
+		})
+	})
+}
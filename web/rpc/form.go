@@ -0,0 +1,74 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package rpc
+
+import "github.com/npiganeau/yep/yep/models"
+
+// A DefaultFunc returns the default value of a field for a new record
+type DefaultFunc func(env models.Environment) interface{}
+
+var (
+	// onchanges holds the onchange method of each field of each model
+	onchanges = make(map[string]map[string]string)
+	// defaults holds the DefaultFunc of each field of each model or global mixin
+	defaults = make(map[string]map[string]DefaultFunc)
+)
+
+// RegisterOnchange declares the given method of the given model as the onchange
+// method of the given field. It is called by the Onchange method of CommonMixin
+// when the field is modified in a form view.
+//
+// Onchange methods must have the following signature, where values are the
+// current values of the form:
+//
+//	func(rs pool.MyModelSet, values models.FieldMap) webdata.OnchangeResult
+func RegisterOnchange(modelName, fieldName, method string) {
+	mu.Lock()
+	defer mu.Unlock()
+	if onchanges[modelName] == nil {
+		onchanges[modelName] = make(map[string]string)
+	}
+	onchanges[modelName][fieldName] = method
+}
+
+// Onchanges returns the onchange method of each field
+// of the given model that has one.
+func Onchanges(modelName string) map[string]string {
+	mu.RLock()
+	defer mu.RUnlock()
+	res := make(map[string]string)
+	for field, method := range onchanges[modelName] {
+		res[field] = method
+	}
+	return res
+}
+
+// RegisterDefault declares the given DefaultFunc as computing the default value
+// of the given field of the given model for new records created from the client.
+// modelName can also be the name of a mixin whose methods are exposed for all models.
+func RegisterDefault(modelName, fieldName string, fn DefaultFunc) {
+	mu.Lock()
+	defer mu.Unlock()
+	if defaults[modelName] == nil {
+		defaults[modelName] = make(map[string]DefaultFunc)
+	}
+	defaults[modelName][fieldName] = fn
+}
+
+// Defaults returns the DefaultFunc of each field of the given model, including
+// the defaults registered for the mixins whose methods are exposed for all models.
+func Defaults(modelName string) map[string]DefaultFunc {
+	mu.RLock()
+	defer mu.RUnlock()
+	res := make(map[string]DefaultFunc)
+	for mixin := range globalMixins {
+		for field, fn := range defaults[mixin] {
+			res[field] = fn
+		}
+	}
+	for field, fn := range defaults[modelName] {
+		res[field] = fn
+	}
+	return res
+}
@@ -0,0 +1,159 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+/*
+Package rpc holds the declarations of the model methods that can be
+called by clients through RPC.
+
+Methods are not callable by clients unless they have been explicitly
+exposed with Expose, or with ExposeMixin for the methods of mixins which
+are inherited by all models such as CommonMixin. Models declared with
+Restrict only expose the methods explicitly exposed for them.
+*/
+package rpc
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/npiganeau/yep/yep/models"
+)
+
+var (
+	mu sync.RWMutex
+	// exposed holds the parameter names of the exposed methods of each model or mixin
+	exposed = make(map[string]map[string][]string)
+	// globalMixins holds the names of the mixins whose
+	// exposed methods are exposed for all models
+	globalMixins = make(map[string]bool)
+	// restricted holds the names of the models that do not
+	// expose the methods of the global mixins
+	restricted = make(map[string]bool)
+)
+
+// Expose declares the given method of the given model as callable through RPC.
+// The method name is the YEP method name (e.g. SearchRead).
+//
+// params are the names of the parameters of the method as used by clients
+// (e.g. 'vals' or 'fields'). They allow binding keyword arguments by name
+// for methods whose parameters are not given as a struct.
+func Expose(modelName, method string, params ...string) {
+	mu.Lock()
+	defer mu.Unlock()
+	if exposed[modelName] == nil {
+		exposed[modelName] = make(map[string][]string)
+	}
+	exposed[modelName][method] = params
+}
+
+// ExposeMixin declares the given method of the given mixin as callable
+// through RPC on all models. It must only be used for mixins that are
+// inherited by all models, such as CommonMixin or BaseMixin.
+func ExposeMixin(mixinName, method string, params ...string) {
+	Expose(mixinName, method, params...)
+	mu.Lock()
+	defer mu.Unlock()
+	globalMixins[mixinName] = true
+}
+
+// Restrict declares that only the methods exposed for the given model with
+// Expose are callable through RPC, and not the methods exposed for all models
+// with ExposeMixin. It is meant for models whose records must only be
+// modified through dedicated methods.
+func Restrict(modelName string) {
+	mu.Lock()
+	defer mu.Unlock()
+	restricted[modelName] = true
+}
+
+// IsExposed returns true if the given method of the given model
+// has been declared as callable through RPC.
+func IsExposed(modelName, method string) bool {
+	_, ok := lookup(modelName, method)
+	return ok
+}
+
+// ParamNames returns the names of the parameters of the given method
+// of the given model, as declared when the method was exposed.
+func ParamNames(modelName, method string) []string {
+	params, _ := lookup(modelName, method)
+	return params
+}
+
+// lookup returns the parameter names of the given exposed method of the
+// given model and true, or false if the method is not exposed.
+func lookup(modelName, method string) ([]string, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	if params, ok := exposed[modelName][method]; ok {
+		return params, true
+	}
+	if restricted[modelName] {
+		return nil, false
+	}
+	for mixin := range globalMixins {
+		if params, ok := exposed[mixin][method]; ok {
+			return params, true
+		}
+	}
+	return nil, false
+}
+
+// ExposedMethods returns the sorted list of the methods of the given model
+// that are callable through RPC, including the methods exposed for all models.
+func ExposedMethods(modelName string) []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	methods := make(map[string]bool)
+	for method := range exposed[modelName] {
+		methods[method] = true
+	}
+	for mixin := range globalMixins {
+		if restricted[modelName] {
+			break
+		}
+		for method := range exposed[mixin] {
+			methods[method] = true
+		}
+	}
+	res := make([]string, 0, len(methods))
+	for method := range methods {
+		res = append(res, method)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// CheckExposed returns an error for each exposed method that does not exist
+// on its model. It must be called once all modules are loaded so that methods
+// renamed or removed after being exposed are reported at startup instead of
+// failing when a client calls them.
+func CheckExposed() []error {
+	mu.RLock()
+	defer mu.RUnlock()
+	modelNames := make([]string, 0, len(exposed))
+	for modelName := range exposed {
+		modelNames = append(modelNames, modelName)
+	}
+	sort.Strings(modelNames)
+	var res []error
+	for _, modelName := range modelNames {
+		model, ok := models.Registry.Get(modelName)
+		if !ok {
+			res = append(res, fmt.Errorf("methods exposed on unknown model %s", modelName))
+			continue
+		}
+		methods := make([]string, 0, len(exposed[modelName]))
+		for method := range exposed[modelName] {
+			methods = append(methods, method)
+		}
+		sort.Strings(methods)
+		for _, method := range methods {
+			if _, ok := model.Methods().Get(method); !ok {
+				res = append(res, fmt.Errorf("exposed method %s does not exist on model %s", method, modelName))
+			}
+		}
+	}
+	return res
+}
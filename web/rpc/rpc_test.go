@@ -0,0 +1,45 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package rpc
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestExposure(t *testing.T) {
+	Convey("Testing methods exposure", t, func() {
+		savedExposed, savedMixins, savedRestricted := exposed, globalMixins, restricted
+		exposed = make(map[string]map[string][]string)
+		globalMixins = make(map[string]bool)
+		restricted = make(map[string]bool)
+		Reset(func() {
+			exposed, globalMixins, restricted = savedExposed, savedMixins, savedRestricted
+		})
+		Expose("TestModel", "DoSomething", "value")
+		ExposeMixin("TestMixin", "Read", "fields")
+		Convey("Exposed methods should be callable with their parameter names", func() {
+			So(IsExposed("TestModel", "DoSomething"), ShouldBeTrue)
+			So(IsExposed("TestModel", "Read"), ShouldBeTrue)
+			So(IsExposed("OtherModel", "Read"), ShouldBeTrue)
+			So(IsExposed("OtherModel", "DoSomething"), ShouldBeFalse)
+			So(ParamNames("OtherModel", "Read"), ShouldResemble, []string{"fields"})
+			So(ExposedMethods("TestModel"), ShouldResemble, []string{"DoSomething", "Read"})
+		})
+		Convey("Restricted models should only expose their own methods", func() {
+			Restrict("TestModel")
+			So(IsExposed("TestModel", "DoSomething"), ShouldBeTrue)
+			So(IsExposed("TestModel", "Read"), ShouldBeFalse)
+			So(IsExposed("OtherModel", "Read"), ShouldBeTrue)
+			So(ExposedMethods("TestModel"), ShouldResemble, []string{"DoSomething"})
+		})
+		Convey("Methods exposed on unknown models should be reported", func() {
+			errs := CheckExposed()
+			So(errs, ShouldHaveLength, 2)
+			So(errs[0].Error(), ShouldContainSubstring, "TestMixin")
+			So(errs[1].Error(), ShouldContainSubstring, "TestModel")
+		})
+	})
+}
@@ -0,0 +1,101 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package tests
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/npiganeau/yep-base/web/controllers"
+	"github.com/npiganeau/yep/pool"
+	"github.com/npiganeau/yep/yep/models"
+	"github.com/npiganeau/yep/yep/models/security"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestBatchExecute(t *testing.T) {
+	Convey("Testing batch execution of calls", t, func() {
+		calls := []controllers.CallParams{
+			{
+				Model:  "Partner",
+				Method: "create",
+				Args:   []json.RawMessage{json.RawMessage(`{"name": "Batch Partner"}`)},
+			},
+			{
+				Model:  "Partner",
+				Method: "write",
+				Args:   []json.RawMessage{json.RawMessage(`{"$ref": 0}`), json.RawMessage(`{"email": "batch@example.com"}`)},
+			},
+			{
+				Model:  "Partner",
+				Method: "unknown_method",
+			},
+			{
+				Model:  "Partner",
+				Method: "name_get",
+				Args:   []json.RawMessage{json.RawMessage(`{"$ref": 0}`)},
+			},
+		}
+		res, err := controllers.ExecuteBatch(security.SuperUserID, controllers.BatchParams{Calls: calls})
+		Convey("The batch should fail and report each call status", func() {
+			So(err, ShouldNotBeNil)
+			So(res.Success, ShouldBeFalse)
+			So(res.Results, ShouldHaveLength, 4)
+			So(res.Results[0].Status, ShouldEqual, controllers.BatchStatusOK)
+			So(res.Results[1].Status, ShouldEqual, controllers.BatchStatusOK)
+			So(res.Results[2].Status, ShouldEqual, controllers.BatchStatusError)
+			So(res.Results[2].Error, ShouldNotBeBlank)
+			So(res.Results[3].Status, ShouldEqual, controllers.BatchStatusSkipped)
+		})
+		Convey("The calls executed before the failure should have been rolled back", func() {
+			models.SimulateInNewEnvironment(security.SuperUserID, func(env models.Environment) {
+				So(pool.Partner().Search(env, pool.Partner().Name().Equals("Batch Partner")).IsEmpty(), ShouldBeTrue)
+			})
+		})
+	})
+	Convey("Testing a successful batch", t, func() {
+		calls := []controllers.CallParams{
+			{
+				Model:  "Partner",
+				Method: "create",
+				Args:   []json.RawMessage{json.RawMessage(`{"name": "Successful Batch Partner"}`)},
+			},
+			{
+				Model:  "Partner",
+				Method: "write",
+				Args:   []json.RawMessage{json.RawMessage(`{"$ref": 0}`), json.RawMessage(`{"email": "batch@example.com"}`)},
+			},
+			{
+				Model:  "Partner",
+				Method: "create",
+				Args:   []json.RawMessage{json.RawMessage(`{"name": "Successful Batch Contact", "parent_id": {"$ref": 0}}`)},
+			},
+		}
+		res, err := controllers.ExecuteBatch(security.SuperUserID, controllers.BatchParams{Calls: calls})
+		Reset(func() {
+			models.ExecuteInNewEnvironment(security.SuperUserID, func(env models.Environment) {
+				pool.Partner().Search(env, pool.Partner().Name().In([]string{"Successful Batch Contact", "Successful Batch Partner"})).Unlink()
+			})
+		})
+		Convey("All the calls should succeed", func() {
+			So(err, ShouldBeNil)
+			So(res.Success, ShouldBeTrue)
+			So(res.Results, ShouldHaveLength, 3)
+			for _, result := range res.Results {
+				So(result.Status, ShouldEqual, controllers.BatchStatusOK)
+			}
+		})
+		Convey("References should resolve to the created IDs and the records should be committed", func() {
+			models.SimulateInNewEnvironment(security.SuperUserID, func(env models.Environment) {
+				partner := pool.Partner().Search(env, pool.Partner().Name().Equals("Successful Batch Partner"))
+				So(partner.IsEmpty(), ShouldBeFalse)
+				So(res.Results[0].Result, ShouldEqual, partner.ID())
+				So(partner.Email(), ShouldEqual, "batch@example.com")
+				contact := pool.Partner().Search(env, pool.Partner().Name().Equals("Successful Batch Contact"))
+				So(contact.ID(), ShouldEqual, res.Results[2].Result)
+				So(contact.Parent().ID(), ShouldEqual, partner.ID())
+			})
+		})
+	})
+}
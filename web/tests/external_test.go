@@ -0,0 +1,164 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"github.com/npiganeau/yep-base/web/controllers"
+	"github.com/npiganeau/yep/pool"
+	"github.com/npiganeau/yep/yep/models"
+	"github.com/npiganeau/yep/yep/models/security"
+	"github.com/npiganeau/yep/yep/server"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// serve serves the given request with the given controllers chained on the
+// given route of a new gin engine and returns the recorded response.
+func serve(req *http.Request, route string, handlers ...func(*server.Context)) *httptest.ResponseRecorder {
+	engine := gin.New()
+	engine.Use(sessions.Sessions("yep-session", sessions.NewCookieStore([]byte("test-secret"))))
+	ginHandlers := make([]gin.HandlerFunc, len(handlers))
+	for i, handler := range handlers {
+		h := handler
+		ginHandlers[i] = func(c *gin.Context) {
+			h(&server.Context{Context: c})
+		}
+	}
+	engine.Handle(req.Method, route, ginHandlers...)
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, req)
+	return w
+}
+
+// loginAs returns a controller that logs the user with the given id in the session
+func loginAs(uid int64) func(*server.Context) {
+	return func(c *server.Context) {
+		c.Session().Set("uid", uid)
+	}
+}
+
+// newAPIUser creates and commits an administrator with the given
+// login and password to authenticate calls of the external APIs.
+func newAPIUser(login, password string) int64 {
+	var uid int64
+	models.ExecuteInNewEnvironment(security.SuperUserID, func(env models.Environment) {
+		uid = pool.User().Create(env, &pool.UserData{Name: "API User", Login: login, Password: password}).ID()
+	})
+	security.Registry.AddMembership(uid, security.Registry.GetGroup(security.GroupAdminID))
+	return uid
+}
+
+// deleteAPIUser deletes the user created by newAPIUser with the given id
+func deleteAPIUser(uid int64) {
+	security.Registry.RemoveAllMembershipsForUser(uid)
+	models.ExecuteInNewEnvironment(security.SuperUserID, func(env models.Environment) {
+		pool.User().Search(env, pool.User().ID().Equals(uid)).Unlink()
+	})
+}
+
+// xmlRPCCall returns the XML-RPC method call with the given
+// method name and parameters given as XML-RPC <value> elements.
+func xmlRPCCall(method string, values ...string) string {
+	params := make([]string, len(values))
+	for i, value := range values {
+		params[i] = fmt.Sprintf("<param>%s</param>", value)
+	}
+	return fmt.Sprintf(`<?xml version="1.0"?><methodCall><methodName>%s</methodName><params>%s</params></methodCall>`,
+		method, strings.Join(params, ""))
+}
+
+func TestExternalAPI(t *testing.T) {
+	Convey("Testing the XML-RPC and JSON-RPC external API", t, func() {
+		uid := newAPIUser("external_api", "secret")
+		var partnerID int64
+		models.ExecuteInNewEnvironment(security.SuperUserID, func(env models.Environment) {
+			partnerID = pool.Partner().Create(env, &pool.PartnerData{Name: "External Partner"}).ID()
+		})
+		Reset(func() {
+			models.ExecuteInNewEnvironment(security.SuperUserID, func(env models.Environment) {
+				pool.Partner().Search(env, pool.Partner().ID().Equals(partnerID)).Unlink()
+			})
+			deleteAPIUser(uid)
+		})
+		xmlRPC := func(route string, handler func(*server.Context), method string, values ...string) string {
+			req := httptest.NewRequest(http.MethodPost, route, strings.NewReader(xmlRPCCall(method, values...)))
+			req.Header.Set("Content-Type", "text/xml")
+			w := serve(req, route, handler)
+			So(w.Code, ShouldEqual, http.StatusOK)
+			return w.Body.String()
+		}
+		Convey("XML-RPC authenticate should return the uid of the user", func() {
+			res := xmlRPC("/xmlrpc/2/common", controllers.XMLRPCCommon, "authenticate",
+				"<value>db</value>", "<value>external_api</value>", "<value>secret</value>", "<value><struct></struct></value>")
+			So(res, ShouldContainSubstring, fmt.Sprintf("<params><param><value><int>%d</int></value></param></params>", uid))
+		})
+		Convey("XML-RPC authenticate should return false for bad credentials", func() {
+			res := xmlRPC("/xmlrpc/2/common", controllers.XMLRPCCommon, "authenticate",
+				"<value>db</value>", "<value>external_api</value>", "<value>wrong</value>", "<value><struct></struct></value>")
+			So(res, ShouldContainSubstring, "<params><param><value><boolean>0</boolean></value></param></params>")
+		})
+		Convey("XML-RPC execute_kw should call the model method with args and kwargs", func() {
+			res := xmlRPC("/xmlrpc/2/object", controllers.XMLRPCObject, "execute_kw",
+				"<value>db</value>", fmt.Sprintf("<value><int>%d</int></value>", uid), "<value>secret</value>",
+				"<value>res.partner</value>", "<value>read</value>",
+				fmt.Sprintf("<value><array><data><value><array><data><value><int>%d</int></value></data></array></value></data></array></value>", partnerID),
+				"<value><struct><member><name>fields</name><value><array><data><value>name</value></data></array></value></member></struct></value>")
+			So(res, ShouldNotContainSubstring, "<fault>")
+			So(res, ShouldContainSubstring, "<member><name>name</name><value><string>External Partner</string></value></member>")
+		})
+		Convey("XML-RPC execute_kw should return a fault for bad credentials", func() {
+			res := xmlRPC("/xmlrpc/2/object", controllers.XMLRPCObject, "execute_kw",
+				"<value>db</value>", fmt.Sprintf("<value><int>%d</int></value>", uid), "<value>wrong</value>",
+				"<value>res.partner</value>", "<value>read</value>",
+				fmt.Sprintf("<value><array><data><value><int>%d</int></value></data></array></value>", partnerID))
+			So(res, ShouldContainSubstring, "<methodResponse><fault>")
+			So(res, ShouldContainSubstring, "<member><name>faultCode</name><value><int>1</int></value></member>")
+			So(res, ShouldContainSubstring, "<member><name>faultString</name><value><string>access denied</string></value></member>")
+			So(res, ShouldNotContainSubstring, "External Partner")
+		})
+		Convey("XML-RPC calls to unknown methods should return a fault", func() {
+			res := xmlRPC("/xmlrpc/2/common", controllers.XMLRPCCommon, "unknown")
+			So(res, ShouldContainSubstring, "<fault>")
+			So(res, ShouldContainSubstring, "unknown method")
+		})
+		jsonRPC := func(service, method string, args ...interface{}) map[string]interface{} {
+			body, _ := json.Marshal(map[string]interface{}{
+				"jsonrpc": "2.0",
+				"method":  "call",
+				"id":      1,
+				"params":  map[string]interface{}{"service": service, "method": method, "args": args},
+			})
+			req := httptest.NewRequest(http.MethodPost, "/jsonrpc", strings.NewReader(string(body)))
+			req.Header.Set("Content-Type", "application/json")
+			w := serve(req, "/jsonrpc", controllers.JSONRPC)
+			So(w.Code, ShouldEqual, http.StatusOK)
+			var res map[string]interface{}
+			So(json.Unmarshal(w.Body.Bytes(), &res), ShouldBeNil)
+			return res
+		}
+		Convey("JSON-RPC should dispatch calls to the common and object services", func() {
+			res := jsonRPC("common", "login", "db", "external_api", "secret")
+			So(res["result"], ShouldEqual, float64(uid))
+			res = jsonRPC("object", "execute", "db", uid, "secret", "res.partner", "read", []int64{partnerID}, []string{"name"})
+			So(res["error"], ShouldBeNil)
+			records, ok := res["result"].([]interface{})
+			So(ok, ShouldBeTrue)
+			So(records, ShouldHaveLength, 1)
+			So(records[0].(map[string]interface{})["name"], ShouldEqual, "External Partner")
+		})
+		Convey("JSON-RPC should return an error for bad credentials", func() {
+			res := jsonRPC("object", "execute_kw", "db", uid, "wrong", "res.partner", "read", []interface{}{[]int64{partnerID}})
+			So(res["result"], ShouldBeNil)
+			So(res["error"], ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,67 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package tests
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/npiganeau/yep-base/web/domains"
+	"github.com/npiganeau/yep/pool"
+	"github.com/npiganeau/yep/yep/models"
+	"github.com/npiganeau/yep/yep/models/security"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestHierarchyOperators(t *testing.T) {
+	Convey("Testing child_of and parent_of domain operators", t, func() {
+		models.SimulateInNewEnvironment(security.SuperUserID, func(env models.Environment) {
+			company := pool.Partner().Create(env, &pool.PartnerData{Name: "NDP Systèmes", IsCompany: true})
+			contact := pool.Partner().Create(env, &pool.PartnerData{Name: "John Smith", Parent: company})
+			assistant := pool.Partner().Create(env, &pool.PartnerData{Name: "Jane Smith", Parent: contact})
+			other := pool.Partner().Create(env, &pool.PartnerData{Name: "Other Company", IsCompany: true})
+			search := func(dom domains.Domain) models.RecordCollection {
+				rc := env.Pool("Partner")
+				return rc.Search(domains.ParseDomain(domains.ResolveOperators(dom, rc)))
+			}
+			Convey("Parent paths should be computed on create", func() {
+				So(company.ParentPath(), ShouldEqual, fmt.Sprintf("/%d/", company.ID()))
+				So(assistant.ParentPath(), ShouldEqual, fmt.Sprintf("/%d/%d/%d/", company.ID(), contact.ID(), assistant.ID()))
+			})
+			Convey("child_of should return the record and all its descendants", func() {
+				res := search(domains.Domain{[]interface{}{"ID", "child_of", company.ID()}})
+				So(res.Ids(), ShouldHaveLength, 3)
+				So(res.Ids(), ShouldContain, company.ID())
+				So(res.Ids(), ShouldContain, contact.ID())
+				So(res.Ids(), ShouldContain, assistant.ID())
+			})
+			Convey("parent_of should return the record and all its ancestors", func() {
+				res := search(domains.Domain{[]interface{}{"ID", "parent_of", []interface{}{float64(assistant.ID())}}})
+				So(res.Ids(), ShouldHaveLength, 3)
+				So(res.Ids(), ShouldNotContain, other.ID())
+			})
+			Convey("child_of on a many2one field should use the related model", func() {
+				res := search(domains.Domain{[]interface{}{"Parent", "child_of", contact.ID()}})
+				So(res.Ids(), ShouldHaveLength, 1)
+				So(res.Ids(), ShouldContain, assistant.ID())
+			})
+			Convey("Changing parent should update descendants paths", func() {
+				contact.SetParent(other)
+				So(assistant.ParentPath(), ShouldEqual, fmt.Sprintf("/%d/%d/%d/", other.ID(), contact.ID(), assistant.ID()))
+				res := search(domains.Domain{[]interface{}{"ID", "child_of", company.ID()}})
+				So(res.Ids(), ShouldHaveLength, 1)
+			})
+			Convey("Missing parent paths should be computed at startup", func() {
+				pool.Partner().Search(env, pool.Partner().ID().In([]int64{contact.ID(), assistant.ID()})).SetParentPath("")
+				So(search(domains.Domain{[]interface{}{"ID", "child_of", company.ID()}}).Ids(), ShouldHaveLength, 1)
+				pool.Partner().NewSet(env).InitParentPaths()
+				So(assistant.ParentPath(), ShouldEqual, fmt.Sprintf("/%d/%d/%d/", company.ID(), contact.ID(), assistant.ID()))
+				So(search(domains.Domain{[]interface{}{"ID", "child_of", company.ID()}}).Ids(), ShouldHaveLength, 3)
+			})
+			Convey("Creating a loop in the hierarchy should panic", func() {
+				So(func() { company.SetParent(assistant) }, ShouldPanic)
+			})
+		})
+	})
+}
@@ -0,0 +1,97 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package tests
+
+import (
+	"testing"
+
+	"github.com/npiganeau/yep-base/web/webdata"
+	"github.com/npiganeau/yep/pool"
+	"github.com/npiganeau/yep/yep/models"
+	"github.com/npiganeau/yep/yep/models/security"
+	"github.com/npiganeau/yep/yep/models/types"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestOnchange(t *testing.T) {
+	Convey("Testing onchange and default values", t, func() {
+		models.SimulateInNewEnvironment(security.SuperUserID, func(env models.Environment) {
+			Convey("Onchange should run the onchange method of the modified field", func() {
+				res := pool.User().NewSet(env).Onchange(webdata.OnchangeParams{
+					Values:    models.FieldMap{"login": "john@example.com", "name": "John"},
+					FieldName: "login",
+					Fields:    map[string]string{"login": "1", "name": ""},
+				})
+				So(res.Value, ShouldContainKey, "email")
+				So(res.Value["email"], ShouldEqual, "john@example.com")
+				So(res.Warning, ShouldBeNil)
+			})
+			Convey("Onchange should not run if the field has no onchange spec", func() {
+				res := pool.User().NewSet(env).Onchange(webdata.OnchangeParams{
+					Values:    models.FieldMap{"login": "john@example.com"},
+					FieldName: []interface{}{"login", "name"},
+					Fields:    map[string]string{"login": "", "name": ""},
+				})
+				So(res.Value, ShouldBeEmpty)
+			})
+			Convey("Onchange should not change values that are not emails", func() {
+				res := pool.User().NewSet(env).Onchange(webdata.OnchangeParams{
+					Values:    models.FieldMap{"login": "john"},
+					FieldName: "login",
+					Fields:    map[string]string{"login": "1"},
+				})
+				So(res.Value, ShouldBeEmpty)
+			})
+			Convey("DefaultGet should use registered defaults and the context", func() {
+				ctx := types.NewContext().WithKey("default_name", "Default Name")
+				res := pool.Partner().NewSet(env).WithNewContext(ctx).DefaultGet([]string{"name", "active", "email"})
+				So(res, ShouldHaveLength, 2)
+				So(res["name"], ShouldEqual, "Default Name")
+				So(res["active"], ShouldEqual, true)
+			})
+			Convey("DefaultGet should use the defaults saved by users", func() {
+				pool.DefaultValue().NewSet(env).SetDefault("res.partner", "city", "Lyon", true, false, false)
+				res := pool.Partner().NewSet(env).DefaultGet([]string{"city"})
+				So(res["city"], ShouldEqual, "Lyon")
+				pool.DefaultValue().NewSet(env).SetDefault("res.partner", "city", "Paris", false, false, false)
+				res = pool.Partner().NewSet(env).DefaultGet([]string{"city"})
+				So(res["city"], ShouldEqual, "Paris")
+				ctx := types.NewContext().WithKey("default_city", "London")
+				res = pool.Partner().NewSet(env).WithNewContext(ctx).DefaultGet([]string{"city"})
+				So(res["city"], ShouldEqual, "London")
+			})
+			Convey("Saved defaults should be converted for the client", func() {
+				parent := pool.Partner().Create(env, &pool.PartnerData{Name: "Default Parent"})
+				pool.DefaultValue().NewSet(env).SetDefault("res.partner", "parent_id", float64(parent.ID()), true, false, false)
+				pool.DefaultValue().NewSet(env).SetDefault("res.partner", "date", "2017-01-02", true, false, false)
+				res := pool.Partner().NewSet(env).DefaultGet([]string{"parent_id", "date"})
+				So(res["parent_id"], ShouldEqual, parent.ID())
+				So(res["date"], ShouldEqual, "2017-01-02")
+				So(func() {
+					pool.DefaultValue().NewSet(env).SetDefault("res.partner", "date", "not a date", true, false, false)
+				}, ShouldPanic)
+			})
+		})
+		Convey("Only administrators should set defaults for all users or for a company", func() {
+			var uid int64
+			models.ExecuteInNewEnvironment(security.SuperUserID, func(env models.Environment) {
+				uid = pool.User().Create(env, &pool.UserData{Name: "Defaults User", Login: "defaults_user"}).ID()
+			})
+			Reset(func() {
+				deleteAPIUser(uid)
+			})
+			models.SimulateInNewEnvironment(uid, func(env models.Environment) {
+				So(func() {
+					pool.DefaultValue().NewSet(env).SetDefault("res.partner", "city", "Lyon", true, false, false)
+				}, ShouldPanic)
+				So(func() {
+					pool.DefaultValue().NewSet(env).SetDefault("res.partner", "city", "Lyon", false, true, false)
+				}, ShouldPanic)
+				So(func() {
+					pool.DefaultValue().NewSet(env).SetDefault("res.partner", "city", "Lyon", false, false, false)
+				}, ShouldNotPanic)
+			})
+		})
+	})
+}
@@ -32,6 +32,92 @@ func Test2ManyRelations(t *testing.T) {
 				So(user.Groups().Len(), ShouldEqual, 1)
 				So(user.Groups().ID(), ShouldEqual, adminGroup.ID())
 			})
+			Convey("Testing many2many commands applied in order", func() {
+				mainCompany := pool.Company().Create(env, &pool.CompanyData{Name: "Main Company"})
+				user := pool.User().Create(env, &pool.UserData{Name: "Test User 2", Login: "test_user_2"})
+				newCompaniesData := func(jsonData string) interface{} {
+					var companiesData interface{}
+					json.Unmarshal([]byte(jsonData), &companiesData)
+					return companiesData
+				}
+				env.Pool("User").Search(user.Model().Field("ID").Equals(user.ID())).Call("Write", models.FieldMap{
+					"Companies": newCompaniesData(fmt.Sprintf(`[[0, 0, {"name": "Test Company"}], [4, %d]]`, mainCompany.ID())),
+				})
+				So(user.Companies().Len(), ShouldEqual, 2)
+				testCompany := pool.Company().Search(env, pool.Company().Name().Equals("Test Company"))
+				So(testCompany.Len(), ShouldEqual, 1)
+				env.Pool("User").Search(user.Model().Field("ID").Equals(user.ID())).Call("Write", models.FieldMap{
+					"Companies": newCompaniesData(fmt.Sprintf(`[[3, %d], [1, %d, {"name": "Renamed Company"}]]`, mainCompany.ID(), testCompany.ID())),
+				})
+				So(user.Companies().Len(), ShouldEqual, 1)
+				So(user.Companies().ID(), ShouldEqual, testCompany.ID())
+				So(testCompany.Name(), ShouldEqual, "Renamed Company")
+				env.Pool("User").Search(user.Model().Field("ID").Equals(user.ID())).Call("Write", models.FieldMap{
+					"Companies": newCompaniesData(fmt.Sprintf(`[[2, %d], [4, %d]]`, testCompany.ID(), mainCompany.ID())),
+				})
+				So(user.Companies().Len(), ShouldEqual, 1)
+				So(user.Companies().ID(), ShouldEqual, mainCompany.ID())
+				So(pool.Company().Search(env, pool.Company().Name().Equals("Renamed Company")).IsEmpty(), ShouldBeTrue)
+				env.Pool("User").Search(user.Model().Field("ID").Equals(user.ID())).Call("Write", models.FieldMap{
+					"Companies": newCompaniesData("[[5]]"),
+				})
+				So(user.Companies().IsEmpty(), ShouldBeTrue)
+			})
+			Convey("Testing many2many commands on several records", func() {
+				mainCompany := pool.Company().Create(env, &pool.CompanyData{Name: "Main Company"})
+				otherCompany := pool.Company().Create(env, &pool.CompanyData{Name: "Other Company"})
+				user1 := pool.User().Create(env, &pool.UserData{Name: "Test User 3", Login: "test_user_3", Companies: mainCompany})
+				user2 := pool.User().Create(env, &pool.UserData{Name: "Test User 4", Login: "test_user_4"})
+				users := env.Pool("User").Search(user1.Model().Field("ID").In([]int64{user1.ID(), user2.ID()}))
+				var companiesData interface{}
+				json.Unmarshal([]byte(fmt.Sprintf(`[[4, %d], [0, 0, {"name": "Created Company"}]]`, otherCompany.ID())), &companiesData)
+				users.Call("Write", models.FieldMap{"Companies": companiesData})
+				created := pool.Company().Search(env, pool.Company().Name().Equals("Created Company"))
+				So(created.Len(), ShouldEqual, 1)
+				So(user1.Companies().Ids(), ShouldHaveLength, 3)
+				So(user1.Companies().Ids(), ShouldContain, mainCompany.ID())
+				So(user2.Companies().Ids(), ShouldHaveLength, 2)
+				So(user2.Companies().Ids(), ShouldContain, otherCompany.ID())
+				So(user2.Companies().Ids(), ShouldContain, created.ID())
+
+				json.Unmarshal([]byte(fmt.Sprintf(`[[6, 0, [%d]]]`, otherCompany.ID())), &companiesData)
+				users.Call("Write", models.FieldMap{"Companies": companiesData})
+				So(user1.Companies().Ids(), ShouldResemble, []int64{otherCompany.ID()})
+				So(user2.Companies().Ids(), ShouldResemble, []int64{otherCompany.ID()})
+			})
+			Convey("Testing one2many commands", func() {
+				company := pool.Partner().Create(env, &pool.PartnerData{Name: "Test Company", IsCompany: true})
+				existing := pool.Partner().Create(env, &pool.PartnerData{Name: "Existing Contact"})
+				var childrenData interface{}
+				json.Unmarshal([]byte(fmt.Sprintf(`[[0, 0, {"name": "New Contact"}], [4, %d]]`, existing.ID())), &childrenData)
+				companyRC := env.Pool("Partner").Search(company.Model().Field("ID").Equals(company.ID()))
+				companyRC.Call("Write", models.FieldMap{"Children": childrenData})
+				So(company.Children().Len(), ShouldEqual, 2)
+				newContact := pool.Partner().Search(env, pool.Partner().Name().Equals("New Contact"))
+				So(newContact.Parent().ID(), ShouldEqual, company.ID())
+				So(existing.Parent().ID(), ShouldEqual, company.ID())
+
+				json.Unmarshal([]byte(fmt.Sprintf(`[[3, %d], [2, %d]]`, existing.ID(), newContact.ID())), &childrenData)
+				companyRC.Call("Write", models.FieldMap{"Children": childrenData})
+				So(company.Children().IsEmpty(), ShouldBeTrue)
+				So(existing.Parent().IsEmpty(), ShouldBeTrue)
+				So(pool.Partner().Search(env, pool.Partner().Name().Equals("New Contact")).IsEmpty(), ShouldBeTrue)
+
+				json.Unmarshal([]byte(fmt.Sprintf(`[[4, %d]]`, existing.ID())), &childrenData)
+				companyRC.Call("Write", models.FieldMap{"Children": childrenData})
+				So(company.Children().Len(), ShouldEqual, 1)
+				json.Unmarshal([]byte(`[[6, 0, []]]`), &childrenData)
+				companyRC.Call("Write", models.FieldMap{"Children": childrenData})
+				So(company.Children().IsEmpty(), ShouldBeTrue)
+				So(existing.Parent().IsEmpty(), ShouldBeTrue)
+
+				json.Unmarshal([]byte(`[[0, 0, {"name": "Created Contact"}]]`), &childrenData)
+				created := env.Pool("Partner").Call("Create", models.FieldMap{
+					"Name":     "Created Company",
+					"Children": childrenData,
+				}).(models.RecordCollection)
+				So(created.Get("Children").(models.RecordCollection).Len(), ShouldEqual, 1)
+			})
 		})
 	})
 }
@@ -0,0 +1,94 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/npiganeau/yep-base/web/controllers"
+	"github.com/npiganeau/yep/yep/server"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRESTAPI(t *testing.T) {
+	Convey("Testing the REST API", t, func() {
+		uid := newAPIUser("rest_api", "secret")
+		Reset(func() {
+			deleteAPIUser(uid)
+		})
+		call := func(method, target, body, route string, handler func(*server.Context)) (int, map[string]interface{}) {
+			req := httptest.NewRequest(method, target, strings.NewReader(body))
+			req.SetBasicAuth("rest_api", "secret")
+			if body != "" {
+				req.Header.Set("Content-Type", "application/json")
+			}
+			w := serve(req, route, controllers.APIAuthRequired, handler)
+			var res map[string]interface{}
+			if w.Body.Len() > 0 {
+				So(json.Unmarshal(w.Body.Bytes(), &res), ShouldBeNil)
+			}
+			return w.Code, res
+		}
+		Convey("Calls without valid credentials should be rejected", func() {
+			req := httptest.NewRequest(http.MethodPost, "/api/Partner", strings.NewReader(`{"name": "REST Partner"}`))
+			req.Header.Set("Content-Type", "application/json")
+			So(serve(req, "/api/:model", controllers.APIAuthRequired, controllers.APICreate).Code, ShouldEqual, http.StatusUnauthorized)
+			req = httptest.NewRequest(http.MethodGet, "/api/Partner", nil)
+			req.SetBasicAuth("rest_api", "wrong")
+			So(serve(req, "/api/:model", controllers.APIAuthRequired, controllers.APISearch).Code, ShouldEqual, http.StatusUnauthorized)
+		})
+		Convey("Request bodies that are not JSON should be rejected", func() {
+			req := httptest.NewRequest(http.MethodPost, "/api/Partner", strings.NewReader("name=REST+Partner"))
+			req.SetBasicAuth("rest_api", "secret")
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			So(serve(req, "/api/:model", controllers.APIAuthRequired, controllers.APICreate).Code, ShouldEqual, http.StatusUnsupportedMediaType)
+		})
+		Convey("Records should be created, searched, read, updated and deleted", func() {
+			status, rec := call(http.MethodPost, "/api/Partner", `{"name": "REST Partner"}`, "/api/:model", controllers.APICreate)
+			So(status, ShouldEqual, http.StatusCreated)
+			So(rec["name"], ShouldEqual, "REST Partner")
+			id := int64(rec["id"].(float64))
+			recordURL := fmt.Sprintf("/api/Partner/%d", id)
+
+			dom := url.QueryEscape(`[["name", "=", "REST Partner"]]`)
+			status, res := call(http.MethodGet, "/api/Partner?fields=name&domain="+dom, "", "/api/:model", controllers.APISearch)
+			So(status, ShouldEqual, http.StatusOK)
+			So(res["length"], ShouldEqual, 1)
+			So(res["records"], ShouldHaveLength, 1)
+
+			status, rec = call(http.MethodGet, recordURL+"?fields=name", "", "/api/:model/:id", controllers.APIRead)
+			So(status, ShouldEqual, http.StatusOK)
+			So(rec["name"], ShouldEqual, "REST Partner")
+
+			status, rec = call(http.MethodPatch, recordURL, `{"email": "rest@example.com"}`, "/api/:model/:id", controllers.APIUpdate)
+			So(status, ShouldEqual, http.StatusOK)
+			So(rec["email"], ShouldEqual, "rest@example.com")
+
+			status, _ = call(http.MethodDelete, recordURL, "", "/api/:model/:id", controllers.APIDelete)
+			So(status, ShouldEqual, http.StatusNoContent)
+			status, _ = call(http.MethodGet, recordURL, "", "/api/:model/:id", controllers.APIRead)
+			So(status, ShouldEqual, http.StatusNotFound)
+		})
+		Convey("The OpenAPI document should describe the models but not the mixins", func() {
+			status, spec := call(http.MethodGet, "/apidoc/openapi.json", "", "/apidoc/openapi.json", controllers.OpenAPI)
+			So(status, ShouldEqual, http.StatusOK)
+			So(spec["openapi"], ShouldEqual, "3.0.0")
+			paths := spec["paths"].(map[string]interface{})
+			So(paths, ShouldContainKey, "/api/Partner")
+			So(paths, ShouldContainKey, "/api/Partner/{id}")
+			So(paths, ShouldNotContainKey, "/api/CommonMixin")
+			So(paths, ShouldNotContainKey, "/api/HierarchyMixin")
+			schemas := spec["components"].(map[string]interface{})["schemas"].(map[string]interface{})
+			attachmentType := schemas["Attachment"].(map[string]interface{})["properties"].(map[string]interface{})["type"].(map[string]interface{})
+			So(attachmentType["type"], ShouldEqual, "string")
+			So(attachmentType["enum"], ShouldResemble, []interface{}{"binary", "url"})
+		})
+	})
+}
@@ -0,0 +1,112 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package tests
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/npiganeau/yep-base/web/controllers"
+	"github.com/npiganeau/yep-base/web/rpc"
+	"github.com/npiganeau/yep/yep/models"
+	"github.com/npiganeau/yep/yep/models/security"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRPCExposure(t *testing.T) {
+	Convey("Testing the methods exposed to RPC", t, func() {
+		common := []string{"Copy", "Create", "DefaultGet", "FieldsGet", "FieldsViewGet", "GetFormviewAction", "GetFormviewId",
+			"NameGet", "NameSearch", "Onchange", "Read", "ReadGroup", "SearchCount", "SearchLength", "SearchRead",
+			"SearchReadChunk", "ToggleActive", "Unlink", "Write"}
+		withCommon := func(methods ...string) []string {
+			res := append([]string{}, common...)
+			res = append(res, methods...)
+			return res
+		}
+		Convey("Each model should expose only its public methods", func() {
+			exposedSurface := map[string][]string{
+				"Attachment":        common,
+				"Company":           common,
+				"Currency":          common,
+				"CurrencyRate":      common,
+				"DefaultValue":      {"SetDefault"},
+				"Filter":            withCommon("GetFilters"),
+				"Group":             common,
+				"Partner":           common,
+				"Translation":       {},
+				"User":              withCommon("ContextGet"),
+				"ViewCacheVersion":  {},
+				"ViewCustomization": {"SaveColumn"},
+			}
+			for model, methods := range exposedSurface {
+				So(rpc.ExposedMethods(model), ShouldHaveLength, len(methods))
+				for _, method := range methods {
+					So(rpc.ExposedMethods(model), ShouldContain, method)
+				}
+			}
+		})
+		Convey("All exposed methods should exist on their model", func() {
+			So(rpc.CheckExposed(), ShouldBeEmpty)
+		})
+		Convey("Internal methods should not be exposed", func() {
+			So(rpc.IsExposed("Partner", "ProcessDataValues"), ShouldBeFalse)
+			So(rpc.IsExposed("Partner", "NormalizeM2MData"), ShouldBeFalse)
+			So(rpc.IsExposed("Partner", "PrepareM2MCommands"), ShouldBeFalse)
+			So(rpc.IsExposed("Partner", "UpdateParentPath"), ShouldBeFalse)
+			So(rpc.IsExposed("Partner", "InitParentPaths"), ShouldBeFalse)
+			So(rpc.IsExposed("Group", "ReloadGroups"), ShouldBeFalse)
+			So(rpc.IsExposed("User", "Authenticate"), ShouldBeFalse)
+		})
+		Convey("Execute should refuse to call methods that are not exposed", func() {
+			_, err := controllers.Execute(security.SuperUserID, controllers.CallParams{
+				Model:  "res.groups",
+				Method: "reload_groups",
+			})
+			So(err, ShouldNotBeNil)
+			res, err := controllers.Execute(security.SuperUserID, controllers.CallParams{
+				Model:  "res.groups",
+				Method: "search_count",
+				Args:   []json.RawMessage{},
+			})
+			So(err, ShouldBeNil)
+			So(res, ShouldBeGreaterThan, 0)
+		})
+	})
+	Convey("Testing keyword arguments binding", t, func() {
+		userID, _ := json.Marshal(security.SuperUserID)
+		Convey("Keyword arguments should be bound by name", func() {
+			res, err := controllers.Execute(security.SuperUserID, controllers.CallParams{
+				Model:  "res.users",
+				Method: "read",
+				Args:   []json.RawMessage{userID},
+				KWArgs: map[string]json.RawMessage{
+					"fields":  json.RawMessage(`["login"]`),
+					"context": json.RawMessage(`{}`),
+				},
+			})
+			So(err, ShouldBeNil)
+			So(res.(models.FieldMap), ShouldContainKey, "login")
+		})
+		Convey("Type mismatches should return an error naming the parameter", func() {
+			_, err := controllers.Execute(security.SuperUserID, controllers.CallParams{
+				Model:  "res.users",
+				Method: "read",
+				Args:   []json.RawMessage{userID},
+				KWArgs: map[string]json.RawMessage{"fields": json.RawMessage(`"login"`)},
+			})
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "'fields'")
+		})
+		Convey("Unknown keyword arguments should return an error", func() {
+			_, err := controllers.Execute(security.SuperUserID, controllers.CallParams{
+				Model:  "res.users",
+				Method: "read",
+				Args:   []json.RawMessage{userID},
+				KWArgs: map[string]json.RawMessage{"unknown": json.RawMessage(`1`)},
+			})
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "'unknown'")
+		})
+	})
+}
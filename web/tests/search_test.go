@@ -0,0 +1,147 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package tests
+
+import (
+	"testing"
+
+	"github.com/npiganeau/yep-base/web/domains"
+	"github.com/npiganeau/yep-base/web/webdata"
+	"github.com/npiganeau/yep/pool"
+	"github.com/npiganeau/yep/yep/models"
+	"github.com/npiganeau/yep/yep/models/security"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestFullTextSearch(t *testing.T) {
+	Convey("Testing full-text search on partners", t, func() {
+		models.SimulateInNewEnvironment(security.SuperUserID, func(env models.Environment) {
+			john := pool.Partner().Create(env, &pool.PartnerData{Name: "John Smith", Email: "john@example.com"})
+			jane := pool.Partner().Create(env, &pool.PartnerData{Name: "Jane Doe", Email: "jane@example.com", Ref: "Smith", City: "Paris"})
+			pool.Partner().Create(env, &pool.PartnerData{Name: "Will Jones", City: "London"})
+			Convey("The 'search' operator should match all the fields of the search vector", func() {
+				rc := env.Pool("Partner")
+				dom := domains.Domain{[]interface{}{"Name", "search", "paris"}}
+				res := rc.Search(domains.ParseDomain(domains.ResolveOperators(dom, rc)))
+				So(res.Ids(), ShouldHaveLength, 1)
+				So(res.Ids(), ShouldContain, jane.ID())
+			})
+			Convey("The search vector should be stored in a column with a GIN index", func() {
+				var indexes []string
+				env.Cr().Select(&indexes, "SELECT indexdef FROM pg_indexes WHERE tablename = ? AND indexdef LIKE ?",
+					env.Pool("Partner").Model().TableName(), "%search_vector%")
+				So(indexes, ShouldHaveLength, 1)
+				So(indexes[0], ShouldContainSubstring, "USING gin")
+			})
+			Convey("NameSearch with the 'search' operator should order results by relevance", func() {
+				res := pool.Partner().NewSet(env).NameSearch(webdata.NameSearchParams{
+					Name:     "smith",
+					Operator: "search",
+				})
+				So(res, ShouldHaveLength, 2)
+				So(res[0].ID, ShouldEqual, john.ID())
+				So(res[1].ID, ShouldEqual, jane.ID())
+				res = pool.Partner().NewSet(env).NameSearch(webdata.NameSearchParams{
+					Name:     "smith",
+					Operator: "search",
+					Limit:    1,
+				})
+				So(res, ShouldHaveLength, 1)
+				So(res[0].ID, ShouldEqual, john.ID())
+			})
+			Convey("NameSearch with 'ilike' should match name prefixes", func() {
+				res := pool.Partner().NewSet(env).NameSearch(webdata.NameSearchParams{
+					Name:     "Jo",
+					Operator: "ilike",
+				})
+				var ids []int64
+				for _, r := range res {
+					ids = append(ids, r.ID)
+				}
+				So(ids, ShouldContain, john.ID())
+				So(ids, ShouldNotContain, jane.ID())
+			})
+		})
+	})
+}
+
+func TestSearchReadChunk(t *testing.T) {
+	Convey("Testing chunked search on partners", t, func() {
+		models.SimulateInNewEnvironment(security.SuperUserID, func(env models.Environment) {
+			for _, name := range []string{"Stream C", "Stream A", "Stream E", "Stream B", "Stream D"} {
+				pool.Partner().Create(env, &pool.PartnerData{Name: name})
+			}
+			dom := domains.Domain{[]interface{}{"Name", "ilike", "Stream"}}
+			readAll := func(order string) ([]string, int) {
+				var (
+					names  []string
+					chunks int
+					after  int64
+				)
+				for {
+					chunk := pool.Partner().NewSet(env).SearchReadChunk(webdata.SearchChunkParams{
+						Domain: dom,
+						Fields: []string{"name"},
+						Order:  order,
+						After:  after,
+						Size:   2,
+					})
+					chunks++
+					for _, rec := range chunk.Records {
+						names = append(names, rec["name"].(string))
+					}
+					if chunk.Done {
+						return names, chunks
+					}
+					after = chunk.Last
+				}
+			}
+			Convey("Chunks should follow the ID order by default", func() {
+				names, chunks := readAll("")
+				So(names, ShouldResemble, []string{"Stream C", "Stream A", "Stream E", "Stream B", "Stream D"})
+				So(chunks, ShouldEqual, 3)
+			})
+			Convey("Chunks should follow the given order", func() {
+				names, _ := readAll("name desc")
+				So(names, ShouldResemble, []string{"Stream E", "Stream D", "Stream C", "Stream B", "Stream A"})
+			})
+			Convey("Chunks should not skip or repeat records with the same order value", func() {
+				for _, name := range []string{"Stream B", "Stream B", "Stream B"} {
+					pool.Partner().Create(env, &pool.PartnerData{Name: name})
+				}
+				names, _ := readAll("name")
+				So(names, ShouldResemble, []string{"Stream A", "Stream B", "Stream B", "Stream B", "Stream B", "Stream C", "Stream D", "Stream E"})
+				names, _ = readAll("name desc")
+				So(names, ShouldResemble, []string{"Stream E", "Stream D", "Stream C", "Stream B", "Stream B", "Stream B", "Stream B", "Stream A"})
+			})
+			Convey("Chunks should include the records with a null order value", func() {
+				pool.Partner().Search(env, pool.Partner().Name().Equals("Stream A")).SetFunction("Manager")
+				pool.Partner().Search(env, pool.Partner().Name().Equals("Stream D")).SetFunction("Director")
+				names, _ := readAll("function,name")
+				So(names, ShouldResemble, []string{"Stream D", "Stream A", "Stream B", "Stream C", "Stream E"})
+				names, _ = readAll("function desc,name")
+				So(names, ShouldResemble, []string{"Stream B", "Stream C", "Stream E", "Stream A", "Stream D"})
+			})
+			Convey("SearchLength should count all matching records", func() {
+				So(pool.Partner().NewSet(env).SearchLength(dom, false), ShouldEqual, 5)
+				So(pool.Partner().NewSet(env).SearchLength(dom, true), ShouldEqual, 5)
+			})
+		})
+		Convey("SearchLength should only estimate the number of records for administrators", func() {
+			var uid int64
+			models.ExecuteInNewEnvironment(security.SuperUserID, func(env models.Environment) {
+				uid = pool.User().Create(env, &pool.UserData{Name: "Search User", Login: "search_user"}).ID()
+			})
+			Reset(func() {
+				deleteAPIUser(uid)
+			})
+			models.SimulateInNewEnvironment(uid, func(env models.Environment) {
+				// The planner estimate does not include uncommitted records
+				pool.Partner().Create(env, &pool.PartnerData{Name: "Uncommitted Partner"})
+				count := pool.Partner().NewSet(env).SearchLength(domains.Domain{}, false)
+				So(pool.Partner().NewSet(env).SearchLength(domains.Domain{}, true), ShouldEqual, count)
+			})
+		})
+	})
+}
@@ -0,0 +1,66 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package tests
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/npiganeau/yep-base/web/controllers"
+	"github.com/npiganeau/yep/pool"
+	"github.com/npiganeau/yep/yep/models"
+	"github.com/npiganeau/yep/yep/models/security"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSearchReadStream(t *testing.T) {
+	Convey("Testing the search_read_stream controller", t, func() {
+		names := []string{"NDJSON C", "NDJSON A", "NDJSON B", "NDJSON A", "NDJSON D"}
+		models.ExecuteInNewEnvironment(security.SuperUserID, func(env models.Environment) {
+			for _, name := range names {
+				pool.Partner().Create(env, &pool.PartnerData{Name: name})
+			}
+		})
+		Reset(func() {
+			models.ExecuteInNewEnvironment(security.SuperUserID, func(env models.Environment) {
+				pool.Partner().Search(env, pool.Partner().Name().In(names)).Unlink()
+			})
+		})
+		stream := func(body string) (*httptest.ResponseRecorder, []map[string]interface{}) {
+			req := httptest.NewRequest(http.MethodPost, "/web/dataset/search_read_stream", strings.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			w := serve(req, "/web/dataset/search_read_stream", loginAs(security.SuperUserID), controllers.SearchReadStream)
+			var lines []map[string]interface{}
+			scanner := bufio.NewScanner(w.Body)
+			for scanner.Scan() {
+				var line map[string]interface{}
+				So(json.Unmarshal(scanner.Bytes(), &line), ShouldBeNil)
+				lines = append(lines, line)
+			}
+			return w, lines
+		}
+		Convey("Records should be streamed as newline delimited JSON after their number", func() {
+			w, lines := stream(`{"model": "res.partner", "domain": [["name", "ilike", "NDJSON"]], "fields": ["name"], "sort": "name", "chunk_size": 2}`)
+			So(w.Code, ShouldEqual, http.StatusOK)
+			So(w.Header().Get("Content-Type"), ShouldEqual, "application/x-ndjson")
+			So(lines, ShouldHaveLength, len(names)+1)
+			So(lines[0], ShouldResemble, map[string]interface{}{"length": float64(len(names))})
+			var streamed []string
+			for _, rec := range lines[1:] {
+				streamed = append(streamed, rec["name"].(string))
+			}
+			So(streamed, ShouldResemble, []string{"NDJSON A", "NDJSON A", "NDJSON B", "NDJSON C", "NDJSON D"})
+		})
+		Convey("Errors should be returned before streaming", func() {
+			w, _ := stream(`{"model": "res.partner", "domain": [["unknown_field", "=", 1]]}`)
+			So(w.Code, ShouldEqual, http.StatusBadRequest)
+			w, _ = stream(`not json`)
+			So(w.Code, ShouldEqual, http.StatusBadRequest)
+		})
+	})
+}
@@ -0,0 +1,86 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package tests
+
+import (
+	"testing"
+
+	"github.com/npiganeau/yep-base/web/webdata"
+	"github.com/npiganeau/yep/pool"
+	"github.com/npiganeau/yep/yep/models"
+	"github.com/npiganeau/yep/yep/models/security"
+	"github.com/npiganeau/yep/yep/models/types"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestTranslations(t *testing.T) {
+	Convey("Testing translations", t, func() {
+		models.SimulateInNewEnvironment(security.SuperUserID, func(env models.Environment) {
+			translation := pool.Translation().NewSet(env)
+			Convey("Module po files should be loaded", func() {
+				So(translation.Translate("fr_FR", "model", "Partner,Name", "Name"), ShouldEqual, "Nom")
+				So(translation.Translate("fr_FR", "view", "base_view_partner_tree", "Partners"), ShouldEqual, "Partenaires")
+				So(translation.Translate("fr_FR", "view", "base_view_partner_tree", "Unknown"), ShouldEqual, "Unknown")
+				So(translation.Translate("de_DE", "model", "Partner,Name", "Name"), ShouldEqual, "Name")
+			})
+			Convey("Loading a po file again should update the existing translations", func() {
+				cond := pool.Translation().Lang().Equals("fr_FR")
+				count := pool.Translation().Search(env, cond).SearchCount()
+				pool.Translation().Search(env, cond.And().Name().Equals("Partner,Name")).SetValue("Nom complet")
+				translation.LoadPOFile("../../base/i18n/fr.po")
+				So(pool.Translation().Search(env, cond).SearchCount(), ShouldEqual, count)
+				So(translation.Translate("fr_FR", "model", "Partner,Name", "Name"), ShouldEqual, "Nom")
+			})
+			Convey("Views should not be translated for users in English", func() {
+				res := pool.Partner().NewSet(env).FieldsViewGet(webdata.FieldsViewGetParams{ViewID: "base_view_partner_tree"})
+				So(res.Arch, ShouldContainSubstring, `string="Partners"`)
+				So(res.Fields["name"].String, ShouldEqual, "Name")
+			})
+			Convey("Views and fields should be translated in the language of the user", func() {
+				pool.User().Search(env, pool.User().ID().Equals(security.SuperUserID)).SetLang("fr_FR")
+				res := pool.Partner().NewSet(env).FieldsViewGet(webdata.FieldsViewGetParams{ViewID: "base_view_partner_tree"})
+				So(res.Arch, ShouldContainSubstring, `string="Partenaires"`)
+				So(res.Fields["name"].String, ShouldEqual, "Nom")
+				So(res.Fields["function"].String, ShouldEqual, "Fonction")
+				Convey("Selection values should be translated", func() {
+					res := pool.Currency().NewSet(env).FieldsViewGet(webdata.FieldsViewGetParams{ViewType: "form"})
+					So(res.Fields["position"].String, ShouldEqual, "Position du symbole")
+					So(res.Fields["position"].Selection, ShouldResemble, types.Selection{
+						"after":  "Après le montant",
+						"before": "Avant le montant",
+					})
+				})
+				Convey("Translating should not modify the fields of the model", func() {
+					fInfos := pool.Partner().NewSet(env).FieldsGet(models.FieldsGetArgs{})
+					So(fInfos["name"].String, ShouldEqual, "Name")
+				})
+			})
+			Convey("Model translations should only be those of the given model", func() {
+				res := translation.GetModelTranslations("fr_FR", "model", "Partner")
+				So(res, ShouldContainKey, "Name")
+				So(res["Name"]["Name"], ShouldEqual, "Nom")
+				So(res, ShouldNotContainKey, "Position")
+			})
+		})
+		Convey("Only administrators should modify translations", func() {
+			var uid int64
+			models.ExecuteInNewEnvironment(security.SuperUserID, func(env models.Environment) {
+				uid = pool.User().Create(env, &pool.UserData{Name: "Translations User", Login: "translations_user"}).ID()
+			})
+			Reset(func() {
+				deleteAPIUser(uid)
+			})
+			models.SimulateInNewEnvironment(uid, func(env models.Environment) {
+				translation := pool.Translation().NewSet(env)
+				So(func() {
+					translation.Create(&pool.TranslationData{Lang: "fr_FR", Type: "model", Name: "Partner,Name", Source: "Name", Value: "Nom complet"})
+				}, ShouldPanic)
+				cond := pool.Translation().Lang().Equals("fr_FR").And().Name().Equals("Partner,Name")
+				So(func() { pool.Translation().Search(env, cond).SetValue("Nom complet") }, ShouldPanic)
+				So(func() { pool.Translation().Search(env, cond).Unlink() }, ShouldPanic)
+				So(translation.Translate("fr_FR", "model", "Partner,Name", "Name"), ShouldEqual, "Nom")
+			})
+		})
+	})
+}
@@ -0,0 +1,109 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package tests
+
+import (
+	"testing"
+
+	"github.com/npiganeau/yep-base/web/viewcache"
+	"github.com/npiganeau/yep-base/web/webdata"
+	"github.com/npiganeau/yep/pool"
+	"github.com/npiganeau/yep/yep/models"
+	"github.com/npiganeau/yep/yep/models/security"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestViewCache(t *testing.T) {
+	Convey("Testing the cache of processed views", t, func() {
+		models.SimulateInNewEnvironment(security.SuperUserID, func(env models.Environment) {
+			viewcache.Invalidate()
+			partnerForm := func() *webdata.FieldsViewData {
+				return pool.Partner().NewSet(env).FieldsViewGet(webdata.FieldsViewGetParams{ViewID: "base_view_partner_form"})
+			}
+			Convey("Processed views should be served from the cache", func() {
+				start := viewcache.GetStats()
+				first := partnerForm()
+				second := partnerForm()
+				stats := viewcache.GetStats()
+				So(stats.Misses-start.Misses, ShouldEqual, 1)
+				So(stats.Hits-start.Hits, ShouldEqual, 1)
+				So(second.Arch, ShouldEqual, first.Arch)
+				So(second.ViewID, ShouldEqual, "base_view_partner_form")
+				So(second.Fields, ShouldHaveLength, len(first.Fields))
+			})
+			Convey("The view ID given by the client should be returned", func() {
+				pool.Partner().NewSet(env).FieldsViewGet(webdata.FieldsViewGetParams{ViewType: "form"})
+				res := partnerForm()
+				So(res.ViewID, ShouldEqual, "base_view_partner_form")
+				res = pool.Partner().NewSet(env).FieldsViewGet(webdata.FieldsViewGetParams{ViewType: "form"})
+				So(res.ViewID, ShouldBeEmpty)
+			})
+			Convey("Users with other groups or languages should not share views", func() {
+				partnerForm()
+				start := viewcache.GetStats()
+				pool.User().Search(env, pool.User().ID().Equals(security.SuperUserID)).SetLang("fr_FR")
+				partnerForm()
+				So(viewcache.GetStats().Misses-start.Misses, ShouldEqual, 1)
+			})
+			Convey("Modifying translations should change the data version", func() {
+				partnerForm()
+				start := viewcache.GetStats()
+				pool.Translation().NewSet(env).Create(&pool.TranslationData{
+					Lang:   "fr_FR",
+					Type:   "view",
+					Name:   "base_view_partner_form",
+					Source: "Name",
+					Value:  "Nom",
+				})
+				partnerForm()
+				So(viewcache.GetStats().Misses-start.Misses, ShouldEqual, 1)
+			})
+			Convey("Adding or removing customizations should change the data version", func() {
+				partnerForm()
+				custo := pool.ViewCustomization().NewSet(env).Create(&pool.ViewCustomizationData{
+					View: "base_view_partner_form",
+					User: pool.User().Search(env, pool.User().ID().Equals(security.SuperUserID)),
+					Arch: `<field name="Ref" position="attributes"><attribute name="string">My Reference</attribute></field>`,
+				})
+				So(partnerForm().Arch, ShouldContainSubstring, `string="My Reference"`)
+				custo.Unlink()
+				So(partnerForm().Arch, ShouldNotContainSubstring, `string="My Reference"`)
+			})
+			Convey("The language and customizations of the user should be cached", func() {
+				partnerForm()
+				start := viewcache.GetStats()
+				partnerForm()
+				So(viewcache.GetStats().Hits-start.Hits, ShouldEqual, 1)
+				pool.User().Search(env, pool.User().ID().Equals(security.SuperUserID)).SetLang("fr_FR")
+				So(partnerForm().Fields["name"].String, ShouldEqual, "Nom")
+			})
+			Convey("Loading a po file should change the data version", func() {
+				partnerForm()
+				start := viewcache.GetStats()
+				pool.Translation().NewSet(env).LoadPOFile("../../base/i18n/fr.po")
+				partnerForm()
+				So(viewcache.GetStats().Misses-start.Misses, ShouldEqual, 1)
+			})
+		})
+	})
+}
+
+func TestViewCacheRollback(t *testing.T) {
+	Convey("Views processed from rolled back data should not be served", t, func() {
+		partnerForm := func(env models.Environment) *webdata.FieldsViewData {
+			return pool.Partner().NewSet(env).FieldsViewGet(webdata.FieldsViewGetParams{ViewID: "base_view_partner_form"})
+		}
+		models.SimulateInNewEnvironment(security.SuperUserID, func(env models.Environment) {
+			pool.ViewCustomization().NewSet(env).Create(&pool.ViewCustomizationData{
+				View: "base_view_partner_form",
+				User: pool.User().Search(env, pool.User().ID().Equals(security.SuperUserID)),
+				Arch: `<field name="Ref" position="attributes"><attribute name="string">Rolled Back</attribute></field>`,
+			})
+			So(partnerForm(env).Arch, ShouldContainSubstring, `string="Rolled Back"`)
+		})
+		models.SimulateInNewEnvironment(security.SuperUserID, func(env models.Environment) {
+			So(partnerForm(env).Arch, ShouldNotContainSubstring, `string="Rolled Back"`)
+		})
+	})
+}
@@ -0,0 +1,114 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package tests
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/npiganeau/yep-base/web/webdata"
+	"github.com/npiganeau/yep/pool"
+	"github.com/npiganeau/yep/yep/models"
+	"github.com/npiganeau/yep/yep/models/security"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestViewCustomizations(t *testing.T) {
+	Convey("Testing view customizations", t, func() {
+		models.SimulateInNewEnvironment(security.SuperUserID, func(env models.Environment) {
+			partnerTree := func() string {
+				return pool.Partner().NewSet(env).FieldsViewGet(webdata.FieldsViewGetParams{ViewID: "base_view_partner_tree"}).Arch
+			}
+			user := pool.User().Search(env, pool.User().ID().Equals(security.SuperUserID))
+			custo := pool.ViewCustomization().NewSet(env)
+			Convey("Company customizations should apply before user customizations", func() {
+				custo.Create(&pool.ViewCustomizationData{
+					View:    "base_view_partner_tree",
+					Company: user.Company(),
+					Arch:    `<field name="Ref" position="attributes"><attribute name="string">Reference</attribute></field>`,
+				})
+				custo.Create(&pool.ViewCustomizationData{
+					View: "base_view_partner_tree",
+					User: user,
+					Arch: `<field name="Ref" position="attributes"><attribute name="string">My Reference</attribute></field>`,
+				})
+				So(partnerTree(), ShouldContainSubstring, `string="My Reference"`)
+			})
+			Convey("Customizations of other users should not apply", func() {
+				custo.Create(&pool.ViewCustomizationData{
+					View: "base_view_partner_tree",
+					User: pool.User().Create(env, &pool.UserData{Name: "Other User", Login: "other_user"}),
+					Arch: `<field name="Ref" position="replace"/>`,
+				})
+				So(partnerTree(), ShouldContainSubstring, `name="ref"`)
+			})
+			Convey("Customizations that cannot be applied should be ignored", func() {
+				custo.Create(&pool.ViewCustomizationData{
+					View: "base_view_partner_tree",
+					User: user,
+					Arch: `<field name="Unknown" position="replace"/>`,
+				})
+				So(partnerTree(), ShouldContainSubstring, `name="ref"`)
+			})
+			Convey("SaveColumn should save the column settings of the user", func() {
+				custo.SaveColumn(webdata.SaveColumnParams{ViewID: "base_view_partner_tree", Field: "ref", Width: "120px"})
+				sequence := 0
+				custo.SaveColumn(webdata.SaveColumnParams{ViewID: "base_view_partner_tree", Field: "ref", Sequence: &sequence})
+				visible := false
+				custo.SaveColumn(webdata.SaveColumnParams{ViewID: "base_view_partner_tree", Field: "lang", Visible: &visible})
+				arch := partnerTree()
+				So(arch, ShouldContainSubstring, `width="120px"`)
+				So(strings.Index(arch, `name="ref"`), ShouldBeLessThan, strings.Index(arch, `name="name"`))
+				So(arch, ShouldContainSubstring, `invisible="1"`)
+				So(custo.GetCustomizations("base_view_partner_tree"), ShouldHaveLength, 1)
+				Convey("Later settings should be merged with the saved ones", func() {
+					visible = true
+					custo.SaveColumn(webdata.SaveColumnParams{ViewID: "base_view_partner_tree", Field: "lang", Visible: &visible})
+					arch := partnerTree()
+					So(arch, ShouldNotContainSubstring, `invisible="1"`)
+					So(arch, ShouldContainSubstring, `width="120px"`)
+					So(strings.Index(arch, `name="ref"`), ShouldBeLessThan, strings.Index(arch, `name="name"`))
+				})
+			})
+			Convey("SaveColumn should panic for fields that are not columns of the view", func() {
+				So(func() {
+					custo.SaveColumn(webdata.SaveColumnParams{ViewID: "base_view_partner_tree", Field: "email", Width: "120px"})
+				}, ShouldPanic)
+			})
+			Convey("Customizations should not modify the groups of the view elements", func() {
+				So(func() {
+					custo.Create(&pool.ViewCustomizationData{
+						View: "base_view_partner_tree",
+						User: user,
+						Arch: `<field name="Ref" position="attributes"><attribute name="groups"></attribute></field>`,
+					})
+				}, ShouldPanic)
+			})
+		})
+		Convey("Only administrators should modify the customizations of other users or of companies", func() {
+			var uid int64
+			models.ExecuteInNewEnvironment(security.SuperUserID, func(env models.Environment) {
+				uid = pool.User().Create(env, &pool.UserData{Name: "Customizations User", Login: "customizations_user"}).ID()
+			})
+			Reset(func() {
+				deleteAPIUser(uid)
+			})
+			models.SimulateInNewEnvironment(uid, func(env models.Environment) {
+				user := pool.User().Search(env, pool.User().ID().Equals(uid))
+				admin := pool.User().Search(env, pool.User().ID().Equals(security.SuperUserID))
+				custo := pool.ViewCustomization().NewSet(env)
+				arch := `<field name="Ref" position="attributes"><attribute name="string">Reference</attribute></field>`
+				So(func() {
+					custo.Create(&pool.ViewCustomizationData{View: "base_view_partner_tree", User: admin, Arch: arch})
+				}, ShouldPanic)
+				So(func() {
+					custo.Create(&pool.ViewCustomizationData{View: "base_view_partner_tree", Company: user.Company(), Arch: arch})
+				}, ShouldPanic)
+				own := custo.Create(&pool.ViewCustomizationData{View: "base_view_partner_tree", User: user, Arch: arch})
+				So(func() { own.SetUser(admin) }, ShouldPanic)
+				So(func() { own.Unlink() }, ShouldNotPanic)
+			})
+		})
+	})
+}
@@ -0,0 +1,97 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package tests
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/npiganeau/yep-base/web/viewcheck"
+	"github.com/npiganeau/yep/yep/models"
+	"github.com/npiganeau/yep/yep/models/security"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func errorMessages(errs []error) string {
+	msgs := make([]string, len(errs))
+	for i, err := range errs {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+func TestViewValidation(t *testing.T) {
+	Convey("Testing view validation", t, func() {
+		models.SimulateInNewEnvironment(security.SuperUserID, func(env models.Environment) {
+			Convey("All module views should be valid", func() {
+				So(errorMessages(viewcheck.CheckViews()), ShouldBeEmpty)
+			})
+			Convey("A valid arch should not return errors", func() {
+				errs := viewcheck.CheckArch(env, "User", `
+<form>
+	<button name="ToggleActive" type="object"/>
+	<label for="Name"/>
+	<field name="Name" attrs='{"readonly": [["Login", "!=", false]]}'/>
+	<field name="Groups">
+		<tree>
+			<field name="Name"/>
+		</tree>
+	</field>
+	<notebook>
+		<page string="Preferences">
+			<field name="Lang"/>
+		</page>
+	</notebook>
+</form>`)
+				So(errs, ShouldBeEmpty)
+			})
+			Convey("Mistakes in the arch should be reported", func() {
+				errs := viewcheck.CheckArch(env, "User", `
+<form>
+	<button name="Unlink2" type="object"/>
+	<button name="%(unknown_action)d" type="action"/>
+	<label for="Email"/>
+	<field name="Name" attrs='{"invisble": [["Login", "!=", "john"]]}'/>
+	<field name="TZ" attrs='{"readonly": [["Unknown", "=", false]]}'/>
+	<field name="Nmae"/>
+	<field/>
+	<page string="Lost"/>
+</form>`)
+				msgs := errorMessages(errs)
+				So(errs, ShouldHaveLength, 8)
+				So(msgs, ShouldContainSubstring, "button 'Unlink2' does not call a method of model 'User' exposed to RPC")
+				So(msgs, ShouldContainSubstring, "button refers to unknown action 'unknown_action'")
+				So(msgs, ShouldContainSubstring, "label for 'Email' does not refer to a field of the view")
+				So(msgs, ShouldContainSubstring, "unknown modifier 'invisble' in attrs")
+				So(msgs, ShouldContainSubstring, "field 'Unknown' of 'readonly' modifier does not exist on model 'User'")
+				So(msgs, ShouldContainSubstring, "field 'Nmae' does not exist on model 'User'")
+				So(msgs, ShouldContainSubstring, "field element without name attribute")
+				So(msgs, ShouldContainSubstring, "page element outside of a notebook")
+			})
+			Convey("Structural errors should be reported", func() {
+				So(errorMessages(viewcheck.CheckArch(env, "User", `<calendar/>`)), ShouldContainSubstring,
+					"calendar view without date_start attribute")
+				So(errorMessages(viewcheck.CheckArch(env, "User", `<kanban><field name="Name"/></kanban>`)), ShouldContainSubstring,
+					"kanban view without <templates><t t-name=\"kanban-box\"> element")
+				So(errorMessages(viewcheck.CheckArch(env, "User", `<list/>`)), ShouldContainSubstring,
+					"unknown view type 'list'")
+				So(errorMessages(viewcheck.CheckArch(env, "Partner", `<calendar date_start="Date" color="Colour"/>`)),
+					ShouldContainSubstring, "color field 'Colour' does not exist on model 'Partner'")
+				So(errorMessages(viewcheck.CheckArch(env, "Partner", `<graph type="donut"/>`)), ShouldContainSubstring,
+					"invalid graph type 'donut'")
+			})
+			Convey("Pivot and graph fields should be aggregatable or groupable", func() {
+				msgs := errorMessages(viewcheck.CheckArch(env, "Partner", `
+<pivot>
+	<field name="Image" type="row"/>
+	<field name="Name" type="measure"/>
+	<field name="CreditLimit" type="total"/>
+</pivot>`))
+				So(msgs, ShouldContainSubstring, "field 'Image' of type binary cannot be used to group records")
+				So(msgs, ShouldContainSubstring, "measure field 'Name' of type char is not aggregatable")
+				So(msgs, ShouldContainSubstring, "invalid field type 'total', expected measure, row or col")
+			})
+		})
+	})
+}
@@ -6,9 +6,11 @@ package tests
 import (
 	"testing"
 
+	"github.com/npiganeau/yep-base/web/webdata"
 	"github.com/npiganeau/yep/pool"
 	"github.com/npiganeau/yep/yep/models"
 	"github.com/npiganeau/yep/yep/models/security"
+	"github.com/npiganeau/yep/yep/views"
 	. "github.com/smartystreets/goconvey/convey"
 )
 
@@ -23,9 +25,11 @@ var viewDef1 string = `
 </view>
 `
 
-var viewFieldInfos1 map[string]*models.FieldInfo = map[string]*models.FieldInfo{
-	"name": {},
-	"tz":   {},
+func viewFieldInfos1() map[string]*models.FieldInfo {
+	return map[string]*models.FieldInfo{
+		"name": {},
+		"tz":   {},
+	}
 }
 
 var viewDef2 string = `
@@ -33,22 +37,35 @@ var viewDef2 string = `
 	<form>
 		<group>
 			<field name="Name" attrs='{"readonly": [["Function", "ilike", "manager"]], "required": [["ID", "!=", false]]}'/>
-			<field name="TZ" invisible="1" attrs='{"invisble": [["Login", "!=", "john"]]}'/>
+			<field name="TZ" invisible="1" attrs='{"invisible": [["Login", "!=", "john"]]}'/>
 		</group>
 	</form>
 </view>
 `
 
-var viewFieldInfos2 map[string]*models.FieldInfo = map[string]*models.FieldInfo{
-	"name": {Required: true},
-	"tz":   {ReadOnly: true},
+func viewFieldInfos2() map[string]*models.FieldInfo {
+	return map[string]*models.FieldInfo{
+		"name": {Required: true},
+		"tz":   {ReadOnly: true},
+	}
 }
 
+var viewDef3 string = `
+<view id="my_id" name="My View" model="ResUSers">
+	<form>
+		<group attrs='{"invisible": ["|", [1, "=", 1], ["Login", "=", "john"]]}'>
+			<field name="Name" required="1" attrs='{"readonly": [[0, "=", 1]], "invisible": [["Active", "=", true], [1, "=", 1]]}'/>
+			<field name="TZ" required="1" attrs='{"readonly": ["|", [1, "=", 1], ["Login", "=", "john"]]}'/>
+		</group>
+	</form>
+</view>
+`
+
 func TestViewModifiers(t *testing.T) {
 	Convey("Testing correct modifiers injection in views", t, func() {
 		models.SimulateInNewEnvironment(security.SuperUserID, func(env models.Environment) {
 			Convey("'invisible', 'required' and 'readonly' field attributes should be set in modifiers", func() {
-				view := pool.User().NewSet(env).ProcessView(viewDef1, viewFieldInfos1)
+				view := pool.User().NewSet(env).ProcessView(viewDef1, viewFieldInfos1())
 				So(view, ShouldEqual, `
 <view id="my_id" name="My View" model="ResUSers">
 	<form>
@@ -60,32 +77,267 @@ func TestViewModifiers(t *testing.T) {
 </view>
 `)
 			})
-			Convey("attrs should be set in modifiers", func() {
-				view := pool.User().NewSet(env).ProcessView(viewDef2, viewFieldInfos1)
+			Convey("Dynamic attrs should be set in modifiers with JSON field names", func() {
+				fInfos := viewFieldInfos1()
+				view := pool.User().NewSet(env).ProcessView(viewDef2, fInfos)
 				So(view, ShouldEqual, `
 <view id="my_id" name="My View" model="ResUSers">
 	<form>
 		<group>
-			<field attrs="{&quot;readonly&quot;: [[&quot;Function&quot;, &quot;ilike&quot;, &quot;manager&quot;]], &quot;required&quot;: [[&quot;ID&quot;, &quot;!=&quot;, false]]}" name="name" modifiers="{&quot;readonly&quot;:[[&quot;Function&quot;,&quot;ilike&quot;,&quot;manager&quot;]],&quot;required&quot;:[[&quot;ID&quot;,&quot;!=&quot;,false]]}"/>
-			<field invisible="1" attrs="{&quot;invisble&quot;: [[&quot;Login&quot;, &quot;!=&quot;, &quot;john&quot;]]}" name="tz" modifiers="{&quot;invisible&quot;:true}"/>
+			<field attrs="{&quot;readonly&quot;: [[&quot;Function&quot;, &quot;ilike&quot;, &quot;manager&quot;]], &quot;required&quot;: [[&quot;ID&quot;, &quot;!=&quot;, false]]}" name="name" modifiers="{&quot;readonly&quot;:[[&quot;function&quot;,&quot;ilike&quot;,&quot;manager&quot;]],&quot;required&quot;:[[&quot;id&quot;,&quot;!=&quot;,false]]}"/>
+			<field invisible="1" attrs="{&quot;invisible&quot;: [[&quot;Login&quot;, &quot;!=&quot;, &quot;john&quot;]]}" name="tz" modifiers="{&quot;invisible&quot;:true}"/>
 		</group>
 	</form>
 </view>
 `)
+				Convey("Fields the modifiers depend on should be added to the view fields", func() {
+					So(fInfos, ShouldContainKey, "function")
+					So(fInfos, ShouldContainKey, "id")
+					So(fInfos, ShouldNotContainKey, "login")
+				})
 			})
 			Convey("'Readonly' and 'Required' field data should be taken into account", func() {
-				view := pool.User().NewSet(env).ProcessView(viewDef2, viewFieldInfos2)
+				view := pool.User().NewSet(env).ProcessView(viewDef2, viewFieldInfos2())
 				So(view, ShouldEqual, `
 <view id="my_id" name="My View" model="ResUSers">
 	<form>
 		<group>
-			<field attrs="{&quot;readonly&quot;: [[&quot;Function&quot;, &quot;ilike&quot;, &quot;manager&quot;]], &quot;required&quot;: [[&quot;ID&quot;, &quot;!=&quot;, false]]}" name="name" modifiers="{&quot;readonly&quot;:[[&quot;Function&quot;,&quot;ilike&quot;,&quot;manager&quot;]],&quot;required&quot;:true}"/>
-			<field invisible="1" attrs="{&quot;invisble&quot;: [[&quot;Login&quot;, &quot;!=&quot;, &quot;john&quot;]]}" name="tz" modifiers="{&quot;invisible&quot;:true,&quot;readonly&quot;:true}"/>
+			<field attrs="{&quot;readonly&quot;: [[&quot;Function&quot;, &quot;ilike&quot;, &quot;manager&quot;]], &quot;required&quot;: [[&quot;ID&quot;, &quot;!=&quot;, false]]}" name="name" modifiers="{&quot;readonly&quot;:[[&quot;function&quot;,&quot;ilike&quot;,&quot;manager&quot;]],&quot;required&quot;:true}"/>
+			<field invisible="1" attrs="{&quot;invisible&quot;: [[&quot;Login&quot;, &quot;!=&quot;, &quot;john&quot;]]}" name="tz" modifiers="{&quot;invisible&quot;:true,&quot;readonly&quot;:true}"/>
 		</group>
 	</form>
 </view>
 `)
 			})
+			Convey("Static attrs should be resolved to booleans", func() {
+				fInfos := viewFieldInfos1()
+				view := pool.User().NewSet(env).ProcessView(viewDef3, fInfos)
+				So(view, ShouldContainSubstring, `<group attrs="{&quot;invisible&quot;: [&quot;|&quot;, [1, &quot;=&quot;, 1], [&quot;Login&quot;, &quot;=&quot;, &quot;john&quot;]]}" modifiers="{&quot;invisible&quot;:true}">`)
+				Convey("Always false modifiers should be removed", func() {
+					So(view, ShouldContainSubstring, `name="name" modifiers="{&quot;invisible&quot;:[[&quot;active&quot;,&quot;=&quot;,true]],&quot;required&quot;:true}"`)
+				})
+				Convey("Required should be removed from always readonly fields", func() {
+					So(view, ShouldContainSubstring, `name="tz" modifiers="{&quot;readonly&quot;:true}"`)
+				})
+				Convey("Static modifiers should not add dependencies", func() {
+					So(fInfos, ShouldContainKey, "active")
+					So(fInfos, ShouldNotContainKey, "login")
+				})
+			})
+			Convey("Fields of sub-views should take the modifiers of the related model", func() {
+				fInfos := map[string]*models.FieldInfo{
+					"rate":  {ReadOnly: true},
+					"rates": {Relation: "CurrencyRate"},
+				}
+				view := pool.Currency().NewSet(env).ProcessView(`<form>
+	<field name="Rate"/>
+	<field name="Rates">
+		<tree>
+			<field name="Name"/>
+			<field name="Rate"/>
+		</tree>
+	</field>
+</form>`, fInfos)
+				So(view, ShouldContainSubstring, `<field name="rate" modifiers="{&quot;readonly&quot;:true}"/>`)
+				So(view, ShouldContainSubstring, `<field name="name" modifiers="{&quot;required&quot;:true}"/>`)
+				So(view, ShouldContainSubstring, `<field name="rate" modifiers="{}"/>`)
+			})
+		})
+	})
+}
+
+func TestDefaultViews(t *testing.T) {
+	Convey("Testing default views of models without views", t, func() {
+		models.SimulateInNewEnvironment(security.SuperUserID, func(env models.Environment) {
+			Convey("Default form view should show the name as title and 2many fields in pages", func() {
+				view := pool.Currency().NewSet(env).DefaultView(views.VIEW_TYPE_FORM)
+				So(view.Model, ShouldEqual, "Currency")
+				So(view.Arch, ShouldStartWith, `<form><sheet><div class="oe_title"><h1><field name="name"/></h1></div><group><group>`)
+				So(view.Arch, ShouldContainSubstring, `<field name="symbol"/>`)
+				So(view.Arch, ShouldContainSubstring, `<notebook><page string="Rates"><field name="rates" nolabel="1"/></page></notebook>`)
+				So(view.Arch, ShouldNotContainSubstring, `<field name="id"/>`)
+				So(view.Fields, ShouldContain, models.FieldName("rates"))
+			})
+			Convey("Default tree view should show the name and the required fields", func() {
+				view := pool.CurrencyRate().NewSet(env).DefaultView(views.VIEW_TYPE_TREE)
+				So(view.Arch, ShouldEqual, `<tree><field name="name"/></tree>`)
+			})
+			Convey("Default search view should search on the name", func() {
+				view := pool.Currency().NewSet(env).DefaultView(views.VIEW_TYPE_SEARCH)
+				So(view.Arch, ShouldEqual, `<search><field name="name"/></search>`)
+			})
+			Convey("FieldsViewGet should use the default view if none is defined", func() {
+				res := pool.Currency().NewSet(env).FieldsViewGet(webdata.FieldsViewGetParams{ViewType: "tree"})
+				So(res.Arch, ShouldContainSubstring, `<field name="name"`)
+				So(res.Fields, ShouldContainKey, "name")
+			})
+		})
+	})
+}
+
+func TestViewGroups(t *testing.T) {
+	group := security.Registry.NewGroup("test_view_group", "Test View Group")
+	Convey("Testing the groups attribute of view nodes", t, func() {
+		uid := newAPIUser("view_groups", "secret")
+		security.Registry.AddMembership(uid, group)
+		Reset(func() {
+			deleteAPIUser(uid)
+		})
+		models.SimulateInNewEnvironment(uid, func(env models.Environment) {
+			Convey("Nodes should be removed if the user does not satisfy their groups", func() {
+				fInfos := map[string]*models.FieldInfo{"name": {}, "login": {}, "email": {}, "tz": {}}
+				arch := pool.User().NewSet(env).ProcessView(`<form>
+	<field name="Name" groups="test_view_group"/>
+	<field name="Login" groups="!test_view_group"/>
+	<group groups="unknown_group,base.group_no_one">
+		<field name="Email"/>
+	</group>
+	<field name="TZ" groups="unknown_group, test_view_group"/>
+</form>`, fInfos)
+				So(arch, ShouldContainSubstring, `name="name"`)
+				So(arch, ShouldContainSubstring, `name="tz"`)
+				So(arch, ShouldNotContainSubstring, `name="login"`)
+				So(arch, ShouldNotContainSubstring, `name="email"`)
+				So(arch, ShouldNotContainSubstring, `groups=`)
+				So(fInfos, ShouldContainKey, "name")
+				So(fInfos, ShouldContainKey, "tz")
+				So(fInfos, ShouldNotContainKey, "login")
+				So(fInfos, ShouldNotContainKey, "email")
+			})
+			Convey("Fields still present in another node should be kept", func() {
+				fInfos := map[string]*models.FieldInfo{"name": {}}
+				arch := pool.User().NewSet(env).ProcessView(`<form>
+	<field name="Name" groups="unknown_group"/>
+	<field name="Name"/>
+</form>`, fInfos)
+				So(arch, ShouldContainSubstring, `name="name"`)
+				So(fInfos, ShouldContainKey, "name")
+			})
+			Convey("Fields of sub-views should not remove the fields of the view", func() {
+				childrenJSON := pool.Partner().NewSet(env).Model().JSONizeFieldName("Children")
+				fInfos := map[string]*models.FieldInfo{"name": {}, childrenJSON: {}}
+				arch := pool.Partner().NewSet(env).ProcessView(`<form>
+	<field name="Name"/>
+	<field name="Children">
+		<tree>
+			<field name="Name" groups="unknown_group"/>
+		</tree>
+	</field>
+</form>`, fInfos)
+				So(arch, ShouldContainSubstring, `name="name"`)
+				So(fInfos, ShouldContainKey, "name")
+				So(fInfos, ShouldContainKey, childrenJSON)
+			})
+			Convey("Restricted fields should not be returned by FieldsViewGet", func() {
+				res := pool.User().NewSet(env).FieldsViewGet(webdata.FieldsViewGetParams{ViewID: "base_view_users_form"})
+				So(res.Fields, ShouldContainKey, "login")
+				So(res.Fields, ShouldNotContainKey, "partner_id")
+				So(res.Fields, ShouldNotContainKey, "company_ids")
+				So(res.Arch, ShouldNotContainSubstring, "Multi Companies")
+			})
+		})
+	})
+}
+
+func TestViewTypes(t *testing.T) {
+	Convey("Testing kanban, calendar, gantt, pivot and graph views", t, func() {
+		models.SimulateInNewEnvironment(security.SuperUserID, func(env models.Environment) {
+			Convey("Field names in kanban templates should be JSONized and fetched", func() {
+				fInfos := map[string]*models.FieldInfo{"name": {}}
+				arch := pool.Partner().NewSet(env).ProcessView(`<kanban>
+	<field name="Name"/>
+	<templates>
+		<t t-name="kanban-box">
+			<div t-if="record.City.raw_value and record.id"><field name="Name"/></div>
+		</t>
+	</templates>
+</kanban>`, fInfos)
+				So(arch, ShouldContainSubstring, `t-if="record.city.raw_value and record.id"`)
+				So(fInfos, ShouldContainKey, "city")
+			})
+			Convey("Field names in calendar attributes should be JSONized and fetched", func() {
+				fInfos := map[string]*models.FieldInfo{"name": {}}
+				arch := pool.Partner().NewSet(env).ProcessView(`<calendar date_start="Date" color="Type"><field name="Name"/></calendar>`, fInfos)
+				So(arch, ShouldContainSubstring, `date_start="date"`)
+				So(arch, ShouldContainSubstring, `color="type"`)
+				So(fInfos, ShouldContainKey, "date")
+				So(fInfos, ShouldContainKey, "type")
+			})
+			Convey("Field names in gantt attributes should be JSONized and fetched", func() {
+				fInfos := map[string]*models.FieldInfo{"name": {}}
+				arch := pool.Partner().NewSet(env).ProcessView(`<gantt date_start="Date" default_group_by="Company"><field name="Name"/></gantt>`, fInfos)
+				So(arch, ShouldContainSubstring, `date_start="date"`)
+				So(arch, ShouldContainSubstring, `default_group_by="company_id"`)
+				So(fInfos, ShouldContainKey, "date")
+				So(fInfos, ShouldContainKey, "company_id")
+			})
+			Convey("FieldsViewGet should return the kanban and calendar views of partners", func() {
+				kanban := pool.Partner().NewSet(env).FieldsViewGet(webdata.FieldsViewGetParams{ViewType: "kanban"})
+				So(kanban.Arch, ShouldStartWith, `<kanban`)
+				So(kanban.Arch, ShouldContainSubstring, `t-if="record.function.raw_value"`)
+				So(kanban.Fields, ShouldContainKey, "function")
+				So(kanban.Fields, ShouldContainKey, "email")
+				calendar := pool.Partner().NewSet(env).FieldsViewGet(webdata.FieldsViewGetParams{ViewType: "calendar"})
+				So(calendar.Arch, ShouldContainSubstring, `date_start="date"`)
+				So(calendar.Fields, ShouldContainKey, "date")
+				So(calendar.Fields, ShouldContainKey, "type")
+			})
+			Convey("FieldsViewGet should return the pivot and graph views of partners", func() {
+				pivot := pool.Partner().NewSet(env).FieldsViewGet(webdata.FieldsViewGetParams{ViewType: "pivot"})
+				So(pivot.Arch, ShouldContainSubstring, `<field name="credit_limit" type="measure"`)
+				So(pivot.Fields, ShouldContainKey, "city")
+				So(pivot.Fields, ShouldContainKey, "credit_limit")
+				graph := pool.Partner().NewSet(env).FieldsViewGet(webdata.FieldsViewGetParams{ViewType: "graph"})
+				So(graph.Arch, ShouldStartWith, `<graph`)
+				So(graph.Fields, ShouldContainKey, "credit_limit")
+			})
+		})
+	})
+}
+
+func TestToolbar(t *testing.T) {
+	Convey("Testing the toolbar of views", t, func() {
+		models.SimulateInNewEnvironment(security.SuperUserID, func(env models.Environment) {
+			Convey("Actions on other models with active_id in the domain should be in Relate", func() {
+				toolbar := pool.Partner().NewSet(env).GetToolbar()
+				var relate, action []string
+				for _, a := range toolbar.Relate {
+					relate = append(relate, a.Name)
+				}
+				for _, a := range toolbar.Action {
+					action = append(action, a.Name)
+				}
+				So(relate, ShouldContain, "Related Users")
+				So(action, ShouldNotContain, "Related Users")
+			})
+			Convey("Server actions should be in Action", func() {
+				toolbar := pool.Group().NewSet(env).GetToolbar()
+				So(toolbar.Action, ShouldHaveLength, 1)
+				So(toolbar.Action[0].Name, ShouldEqual, "Reload Groups")
+				So(toolbar.Print, ShouldBeEmpty)
+				So(toolbar.Relate, ShouldBeEmpty)
+			})
+			Convey("The toolbar should only be computed when requested", func() {
+				res := pool.Partner().NewSet(env).FieldsViewGet(webdata.FieldsViewGetParams{ViewType: "form"})
+				So(res.Toolbar, ShouldBeNil)
+				res = pool.Partner().NewSet(env).FieldsViewGet(webdata.FieldsViewGetParams{ViewType: "form", Toolbar: true})
+				So(res.Toolbar, ShouldNotBeNil)
+				So(res.Toolbar.Relate, ShouldNotBeEmpty)
+			})
+		})
+	})
+}
+
+func TestActionButtons(t *testing.T) {
+	Convey("Testing action buttons", t, func() {
+		models.SimulateInNewEnvironment(security.SuperUserID, func(env models.Environment) {
+			Convey("Action references in button names should be replaced by the action id", func() {
+				arch := pool.User().NewSet(env).ProcessView(`<form><header>
+	<button string="Users" type="action" name="%(base_action_res_users)d"/>
+</header></form>`, make(map[string]*models.FieldInfo))
+				So(arch, ShouldContainSubstring, `name="base_action_res_users"`)
+				So(arch, ShouldNotContainSubstring, `%(`)
+			})
 		})
 	})
 }
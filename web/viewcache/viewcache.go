@@ -0,0 +1,206 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+/*
+Package viewcache caches the views processed by FieldsViewGet.
+
+Processing a view (parsing its arch, applying extensions, customizations
+and translations, removing the nodes restricted to other groups, adding
+modifiers and fetching the fields) is costly for large views, whereas its
+result only depends on the view, the groups, the language and the view
+customizations of the user. Processed views are therefore cached with a
+Key made of these elements.
+
+The cache holds at most MaxEntries views: the least recently used view is
+evicted when a new one is added to a full cache.
+
+The key also holds the version of the data the view is processed from, such
+as the translations and the customizations. This version is stored in the
+database and changed by the transactions modifying this data, so that views
+processed from data that has been modified since, or from uncommitted data
+that has been rolled back, never match the key of a request.
+
+The values from which the key is computed for a user, such as its language or
+the customizations applying to a view, can be cached with SetUserValue so that
+they are not fetched from the database for each request. They are cached for
+a data version too.
+
+The cache must be invalidated with Invalidate when one of the elements of
+the key that are not stored in the database changes without changing the
+key, for instance when modules are reloaded.
+*/
+package viewcache
+
+import (
+	"container/list"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/npiganeau/yep-base/web/webdata"
+)
+
+// A Key identifies a processed view in the cache
+type Key struct {
+	ViewID   string
+	Model    string
+	ViewType string
+	// Groups are the IDs of the groups of the user, as returned by GroupsKey
+	Groups string
+	Lang   string
+	// Customizations are the IDs of the customizations applied to the view,
+	// as returned by IDsKey
+	Customizations string
+	Toolbar        bool
+	// Version is the version of the data the view is processed from
+	Version int64
+}
+
+// Stats are the statistics of the cache since the server started
+type Stats struct {
+	Hits    uint64 `json:"hits"`
+	Misses  uint64 `json:"misses"`
+	Entries int    `json:"entries"`
+}
+
+// HitRate returns the ratio of cache lookups that found a processed view,
+// or 0 if there has been no lookup.
+func (s Stats) HitRate() float64 {
+	if s.Hits+s.Misses == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.Hits+s.Misses)
+}
+
+// MaxEntries is the maximum number of processed views held by the cache.
+// It must be set before the server starts.
+var MaxEntries = 2000
+
+// An entry is a processed view in the cache
+type entry struct {
+	key  Key
+	data *webdata.FieldsViewData
+}
+
+var (
+	mu sync.Mutex
+	// entries holds the elements of lru by key
+	entries = make(map[Key]*list.Element)
+	// lru holds the entries of the cache, most recently used first
+	lru = list.New()
+	// userValues holds the values cached for each user
+	userValues = make(map[int64]userEntry)
+	hits       uint64
+	misses     uint64
+)
+
+// Get returns a copy of the processed view cached for the given key, and
+// true if it has been found. The Fields map of the returned view is shared
+// with the cache and must not be modified.
+func Get(key Key) (*webdata.FieldsViewData, bool) {
+	mu.Lock()
+	elt, ok := entries[key]
+	if ok {
+		lru.MoveToFront(elt)
+	}
+	mu.Unlock()
+	if !ok {
+		atomic.AddUint64(&misses, 1)
+		return nil, false
+	}
+	atomic.AddUint64(&hits, 1)
+	res := *elt.Value.(*entry).data
+	return &res, true
+}
+
+// Set caches the given processed view for the given key, evicting the least
+// recently used views if the cache is full. The given view must not be
+// modified afterwards.
+func Set(key Key, data *webdata.FieldsViewData) {
+	mu.Lock()
+	defer mu.Unlock()
+	if elt, ok := entries[key]; ok {
+		elt.Value.(*entry).data = data
+		lru.MoveToFront(elt)
+		return
+	}
+	entries[key] = lru.PushFront(&entry{key: key, data: data})
+	for lru.Len() > MaxEntries {
+		oldest := lru.Back()
+		lru.Remove(oldest)
+		delete(entries, oldest.Value.(*entry).key)
+	}
+}
+
+// A userEntry holds the values cached for a user by name
+// for a data version
+type userEntry struct {
+	version int64
+	values  map[string]string
+}
+
+// GetUserValue returns the value with the given name cached for the user
+// with the given ID and the given data version, and true if it has been found.
+func GetUserValue(uid, version int64, name string) (string, bool) {
+	mu.Lock()
+	defer mu.Unlock()
+	ue, ok := userValues[uid]
+	if !ok || ue.version != version {
+		return "", false
+	}
+	value, ok := ue.values[name]
+	return value, ok
+}
+
+// SetUserValue caches the given value with the given name for the user with
+// the given ID and the given data version. The values cached for the user
+// with another version are removed.
+func SetUserValue(uid, version int64, name, value string) {
+	mu.Lock()
+	defer mu.Unlock()
+	ue, ok := userValues[uid]
+	if !ok || ue.version != version {
+		ue = userEntry{version: version, values: make(map[string]string)}
+		userValues[uid] = ue
+	}
+	ue.values[name] = value
+}
+
+// Invalidate removes all the processed views and user values from the cache
+func Invalidate() {
+	mu.Lock()
+	defer mu.Unlock()
+	entries = make(map[Key]*list.Element)
+	lru.Init()
+	userValues = make(map[int64]userEntry)
+}
+
+// GetStats returns the current statistics of the cache
+func GetStats() Stats {
+	mu.Lock()
+	defer mu.Unlock()
+	return Stats{
+		Hits:    atomic.LoadUint64(&hits),
+		Misses:  atomic.LoadUint64(&misses),
+		Entries: len(entries),
+	}
+}
+
+// GroupsKey returns the Groups value of a Key for the given group IDs
+func GroupsKey(groupIDs []string) string {
+	sorted := make([]string, len(groupIDs))
+	copy(sorted, groupIDs)
+	sort.Strings(sorted)
+	return strings.Join(sorted, ",")
+}
+
+// IDsKey returns the Customizations value of a Key for the given record IDs
+func IDsKey(ids []int64) string {
+	strIDs := make([]string, len(ids))
+	for i, id := range ids {
+		strIDs[i] = strconv.FormatInt(id, 10)
+	}
+	return strings.Join(strIDs, ",")
+}
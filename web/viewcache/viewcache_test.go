@@ -0,0 +1,91 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package viewcache
+
+import (
+	"testing"
+
+	"github.com/npiganeau/yep-base/web/webdata"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestViewCache(t *testing.T) {
+	Convey("Testing the view cache", t, func() {
+		Invalidate()
+		start := GetStats()
+		key := Key{ViewID: "base_view_partner_form", Model: "Partner", Groups: GroupsKey([]string{"b", "a"}), Lang: "fr_FR"}
+		Convey("Cached views should be returned for the same key only", func() {
+			_, ok := Get(key)
+			So(ok, ShouldBeFalse)
+			Set(key, &webdata.FieldsViewData{Name: "Partner Form", Arch: "<form/>"})
+			res, ok := Get(Key{ViewID: "base_view_partner_form", Model: "Partner", Groups: "a,b", Lang: "fr_FR"})
+			So(ok, ShouldBeTrue)
+			So(res.Arch, ShouldEqual, "<form/>")
+			_, ok = Get(Key{ViewID: "base_view_partner_form", Model: "Partner", Groups: "a,b", Lang: "en_US"})
+			So(ok, ShouldBeFalse)
+			_, ok = Get(Key{ViewID: "base_view_partner_form", Model: "Partner", Groups: "a,b", Lang: "fr_FR", Version: 1})
+			So(ok, ShouldBeFalse)
+			stats := GetStats()
+			So(stats.Hits-start.Hits, ShouldEqual, 1)
+			So(stats.Misses-start.Misses, ShouldEqual, 3)
+			So(stats.Entries, ShouldEqual, 1)
+		})
+		Convey("Returned views should be copies", func() {
+			Set(key, &webdata.FieldsViewData{ViewID: ""})
+			res, _ := Get(key)
+			res.ViewID = "base_view_partner_form"
+			res, _ = Get(key)
+			So(res.ViewID, ShouldBeEmpty)
+		})
+		Convey("Invalidate should empty the cache", func() {
+			Set(key, &webdata.FieldsViewData{})
+			Invalidate()
+			_, ok := Get(key)
+			So(ok, ShouldBeFalse)
+			So(GetStats().Entries, ShouldEqual, 0)
+		})
+		Convey("Least recently used views should be evicted from a full cache", func() {
+			savedMax := MaxEntries
+			MaxEntries = 2
+			Reset(func() {
+				MaxEntries = savedMax
+			})
+			other := Key{ViewID: "base_view_partner_tree", Model: "Partner"}
+			last := Key{ViewID: "base_view_partner_search", Model: "Partner"}
+			Set(key, &webdata.FieldsViewData{})
+			Set(other, &webdata.FieldsViewData{})
+			Get(key)
+			Set(last, &webdata.FieldsViewData{})
+			So(GetStats().Entries, ShouldEqual, 2)
+			_, ok := Get(other)
+			So(ok, ShouldBeFalse)
+			_, ok = Get(key)
+			So(ok, ShouldBeTrue)
+			_, ok = Get(last)
+			So(ok, ShouldBeTrue)
+		})
+		Convey("User values should be cached for a data version until the cache is invalidated", func() {
+			SetUserValue(1, 3, "lang", "fr_FR")
+			SetUserValue(2, 3, "lang", "de_DE")
+			value, ok := GetUserValue(1, 3, "lang")
+			So(ok, ShouldBeTrue)
+			So(value, ShouldEqual, "fr_FR")
+			_, ok = GetUserValue(1, 4, "lang")
+			So(ok, ShouldBeFalse)
+			SetUserValue(1, 4, "customizations:base_view_partner_form", "")
+			_, ok = GetUserValue(1, 3, "lang")
+			So(ok, ShouldBeFalse)
+			_, ok = GetUserValue(2, 3, "lang")
+			So(ok, ShouldBeTrue)
+			Invalidate()
+			_, ok = GetUserValue(2, 3, "lang")
+			So(ok, ShouldBeFalse)
+		})
+		Convey("Hit rate should be the ratio of successful lookups", func() {
+			So(Stats{}.HitRate(), ShouldEqual, 0)
+			So(Stats{Hits: 3, Misses: 1}.HitRate(), ShouldEqual, 0.75)
+			So(IDsKey([]int64{3, 12}), ShouldEqual, "3,12")
+		})
+	})
+}
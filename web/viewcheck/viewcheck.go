@@ -0,0 +1,391 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+/*
+Package viewcheck validates the architecture of the views, so that
+mistakes such as unknown fields or misspelled modifiers are reported
+when the server starts instead of when a user opens the view.
+
+The following checks are made on each view:
+
+  - the root element is a known view type with its required structure
+  - field elements have a name which is a field of the model
+  - attrs are valid JSON, with known modifiers and parseable domains
+    on fields of the model
+  - label elements refer to a field of the view
+  - object buttons call a method exposed to RPC and action buttons
+    refer to an existing action
+  - page elements are inside a notebook and vice versa
+  - fields of pivot and graph views can be aggregated or grouped
+*/
+package viewcheck
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/npiganeau/yep-base/web/domains"
+	"github.com/npiganeau/yep-base/web/inherit"
+	"github.com/npiganeau/yep-base/web/rpc"
+	"github.com/npiganeau/yep-base/web/viewsrc"
+	"github.com/npiganeau/yep-base/web/webdata"
+	"github.com/npiganeau/yep/yep/actions"
+	"github.com/npiganeau/yep/yep/models"
+	"github.com/npiganeau/yep/yep/models/fieldtype"
+	"github.com/npiganeau/yep/yep/models/security"
+	"github.com/npiganeau/yep/yep/tools/etree"
+	"github.com/npiganeau/yep/yep/views"
+)
+
+var (
+	// modifiers are the valid keys of attrs
+	modifiers = map[string]bool{"invisible": true, "readonly": true, "required": true}
+	// graphTypes are the valid types of graph views
+	graphTypes = map[string]bool{"bar": true, "line": true, "pie": true}
+)
+
+// An Error is a problem found in the arch of a view
+type Error struct {
+	ViewID string
+	// Location is the file and line of the faulty element, or of
+	// the view if the element cannot be located. It is empty if
+	// the view has not been loaded from the modules XML files.
+	Location string
+	Message  string
+}
+
+// Error returns the error message with its location
+func (e *Error) Error() string {
+	msg := e.Message
+	if e.ViewID != "" {
+		msg = fmt.Sprintf("view '%s': %s", e.ViewID, msg)
+	}
+	if e.Location != "" {
+		msg = fmt.Sprintf("%s: %s", e.Location, msg)
+	}
+	return msg
+}
+
+// CheckViews checks all the views of the registry, after applying their
+// extensions, and returns the errors found. The views XML files must have
+// been loaded with viewsrc.Load to report the location of the errors.
+func CheckViews() []error {
+	var errs []error
+	err := models.ExecuteInNewEnvironment(security.SuperUserID, func(env models.Environment) {
+		for _, view := range views.Registry.GetAll() {
+			if viewsrc.IsExtension(view.ID) {
+				// Extensions are checked with the view they extend
+				continue
+			}
+			src := viewsrc.Get(view.ID)
+			arch, err := inherit.Apply(view.ID, view.Arch)
+			if err != nil {
+				c := &checker{viewID: view.ID, src: src}
+				c.addError(nil, "%s", err)
+				errs = append(errs, c.errs...)
+				continue
+			}
+			if arch != view.Arch && src != nil {
+				// Elements lines do not match the extended arch anymore
+				src = &viewsrc.Source{File: src.File, Line: src.Line}
+			}
+			errs = append(errs, checkView(env, view.ID, view.Model, arch, src)...)
+		}
+	})
+	if err != nil {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+// CheckArch returns the errors found in the given arch of a view of the given model
+func CheckArch(env models.Environment, modelName, arch string) []error {
+	return checkView(env, "", modelName, arch, nil)
+}
+
+// checkView returns the errors found in the given arch of the view with the
+// given id. src is the location of the view in the XML files and can be nil.
+func checkView(env models.Environment, viewID, modelName, arch string, src *viewsrc.Source) []error {
+	c := &checker{
+		env:    env,
+		viewID: viewID,
+		src:    src,
+		fields: make(map[string]map[string]*models.FieldInfo),
+	}
+	doc := etree.NewDocument()
+	if err := doc.ReadFromString(arch); err != nil {
+		c.addError(nil, "unable to parse arch: %s", err)
+		return c.errs
+	}
+	if src != nil {
+		c.lines = src.Lines(doc)
+	}
+	root := doc.Root()
+	if root == nil {
+		c.addError(nil, "empty arch")
+		return c.errs
+	}
+	if _, ok := c.fieldInfos(root, modelName); !ok {
+		return c.errs
+	}
+	for _, fieldTag := range doc.FindElements("//field") {
+		c.viewFields = append(c.viewFields, c.jsonName(modelName, fieldTag.SelectAttrValue("name", "")))
+	}
+	c.viewType = root.Tag
+	c.checkStructure(root, modelName)
+	c.checkElement(root, modelName)
+	return c.errs
+}
+
+// A checker holds the state of the validation of a view
+type checker struct {
+	env      models.Environment
+	viewID   string
+	viewType string
+	src      *viewsrc.Source
+	// lines maps the elements of the view to their line in src
+	lines map[*etree.Element]int
+	// fields caches the field infos of each model
+	fields map[string]map[string]*models.FieldInfo
+	// viewFields holds the names of all the fields of the view
+	viewFields []string
+	errs       []error
+}
+
+// addError adds an error on the given element, which can be nil
+func (c *checker) addError(elt *etree.Element, format string, args ...interface{}) {
+	c.errs = append(c.errs, &Error{
+		ViewID:   c.viewID,
+		Location: c.location(elt),
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// location returns the file and line of the given element, or of the view
+// if elt is nil or cannot be located. It returns an empty string if the
+// view has not been loaded from an XML file.
+func (c *checker) location(elt *etree.Element) string {
+	if c.src == nil {
+		return ""
+	}
+	if line, ok := c.lines[elt]; ok {
+		return fmt.Sprintf("%s:%d", c.src.File, line)
+	}
+	return c.src.Location()
+}
+
+// fieldInfos returns the field infos of the given model, keyed by JSON
+// field name, and false if the model does not exist.
+func (c *checker) fieldInfos(elt *etree.Element, modelName string) (res map[string]*models.FieldInfo, ok bool) {
+	if fInfos, exists := c.fields[modelName]; exists {
+		return fInfos, fInfos != nil
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			c.fields[modelName] = nil
+			c.addError(elt, "unknown model '%s'", modelName)
+			res, ok = nil, false
+		}
+	}()
+	res = c.env.Pool(modelName).Call("FieldsGet", models.FieldsGetArgs{}).(map[string]*models.FieldInfo)
+	c.fields[modelName] = res
+	return res, true
+}
+
+// jsonName returns the JSON name of the given field of the given model
+func (c *checker) jsonName(modelName, fieldName string) string {
+	return c.env.Pool(modelName).Model().JSONizeFieldName(fieldName)
+}
+
+// fieldInfo returns the field info of the given field of the given model,
+// or nil if the field does not exist.
+func (c *checker) fieldInfo(elt *etree.Element, modelName, fieldName string) *models.FieldInfo {
+	fInfos, ok := c.fieldInfos(elt, modelName)
+	if !ok {
+		return nil
+	}
+	return fInfos[c.jsonName(modelName, fieldName)]
+}
+
+// checkStructure checks that the given root element is a known
+// view type with its required elements and attributes.
+func (c *checker) checkStructure(root *etree.Element, modelName string) {
+	switch root.Tag {
+	case "form", "tree", "search", "pivot", "diagram":
+	case "graph":
+		if graphType := root.SelectAttrValue("type", "bar"); !graphTypes[graphType] {
+			c.addError(root, "invalid graph type '%s', expected bar, line or pie", graphType)
+		}
+	case "kanban":
+		found := false
+		for _, tmpl := range root.FindElements("templates/t") {
+			if tmpl.SelectAttrValue("t-name", "") == "kanban-box" {
+				found = true
+			}
+		}
+		if !found {
+			c.addError(root, "kanban view without <templates><t t-name=\"kanban-box\"> element")
+		}
+	case "calendar", "gantt":
+		if root.SelectAttrValue("date_start", "") == "" {
+			c.addError(root, "%s view without date_start attribute", root.Tag)
+		}
+	default:
+		c.addError(root, "unknown view type '%s'", root.Tag)
+	}
+	for _, attr := range webdata.RootFieldAttrs[root.Tag] {
+		fieldName := root.SelectAttrValue(attr, "")
+		if fieldName != "" && c.fieldInfo(root, modelName, fieldName) == nil {
+			c.addError(root, "%s field '%s' does not exist on model '%s'", attr, fieldName, modelName)
+		}
+	}
+}
+
+// checkAggregation checks that the given field of a pivot or graph view
+// can be used as a measure or to group records according to its type.
+func (c *checker) checkAggregation(elt *etree.Element, fInfo *models.FieldInfo) {
+	fieldName := elt.SelectAttrValue("name", "")
+	switch usage := elt.SelectAttrValue("type", ""); usage {
+	case "measure":
+		if fInfo.Type != fieldtype.Integer && fInfo.Type != fieldtype.Float {
+			c.addError(elt, "measure field '%s' of type %s is not aggregatable", fieldName, fInfo.Type)
+		}
+	case "row", "col", "":
+		switch {
+		case fInfo.Type.Is2ManyRelationType(), fInfo.Type == fieldtype.Binary,
+			fInfo.Type == fieldtype.Text, fInfo.Type == fieldtype.HTML:
+			c.addError(elt, "field '%s' of type %s cannot be used to group records", fieldName, fInfo.Type)
+		}
+	default:
+		c.addError(elt, "invalid field type '%s', expected measure, row or col", usage)
+	}
+}
+
+// checkElement checks the given element and its children recursively
+func (c *checker) checkElement(elt *etree.Element, modelName string) {
+	c.checkAttrs(elt, modelName)
+	switch elt.Tag {
+	case "field":
+		fInfo := c.checkField(elt, modelName)
+		if fInfo != nil && (c.viewType == "pivot" || c.viewType == "graph") {
+			c.checkAggregation(elt, fInfo)
+		}
+		if fInfo != nil && fInfo.Relation != "" {
+			// Children of relation fields are embedded views of the related model
+			modelName = fInfo.Relation
+		}
+	case "label":
+		c.checkLabel(elt, modelName)
+	case "button":
+		c.checkButton(elt, modelName)
+	case "page":
+		if parent := elt.Parent(); parent == nil || parent.Tag != "notebook" {
+			c.addError(elt, "page element outside of a notebook")
+		}
+	case "notebook":
+		for _, child := range elt.ChildElements() {
+			if child.Tag != "page" {
+				c.addError(child, "notebook element can only contain pages, found '%s'", child.Tag)
+			}
+		}
+	}
+	for _, child := range elt.ChildElements() {
+		c.checkElement(child, modelName)
+	}
+}
+
+// checkField checks that the given field element refers to a field of
+// the given model and returns its field info or nil.
+func (c *checker) checkField(elt *etree.Element, modelName string) *models.FieldInfo {
+	fieldName := elt.SelectAttrValue("name", "")
+	if fieldName == "" {
+		c.addError(elt, "field element without name attribute")
+		return nil
+	}
+	fInfo := c.fieldInfo(elt, modelName, fieldName)
+	if fInfo == nil {
+		c.addError(elt, "field '%s' does not exist on model '%s'", fieldName, modelName)
+	}
+	return fInfo
+}
+
+// checkLabel checks that the given label refers to a field of the view
+func (c *checker) checkLabel(elt *etree.Element, modelName string) {
+	target := elt.SelectAttrValue("for", "")
+	if target == "" {
+		return
+	}
+	for _, f := range c.viewFields {
+		if f == c.jsonName(modelName, target) {
+			return
+		}
+	}
+	c.addError(elt, "label for '%s' does not refer to a field of the view", target)
+}
+
+// checkButton checks that the given button calls an exposed
+// method of the given model or an existing action.
+func (c *checker) checkButton(elt *etree.Element, modelName string) {
+	name := elt.SelectAttrValue("name", "")
+	switch elt.SelectAttrValue("type", "") {
+	case "object":
+		if name == "" {
+			c.addError(elt, "object button without name attribute")
+			return
+		}
+		if !rpc.IsExposed(modelName, name) {
+			c.addError(elt, "button '%s' does not call a method of model '%s' exposed to RPC", name, modelName)
+		}
+	case "action":
+		if name == "" {
+			c.addError(elt, "action button without name attribute")
+			return
+		}
+		actionID := webdata.ActionRef(name)
+		if actions.Registry.GetById(actionID) == nil {
+			c.addError(elt, "button refers to unknown action '%s'", actionID)
+		}
+	}
+}
+
+// checkAttrs checks the attrs attribute of the given element
+func (c *checker) checkAttrs(elt *etree.Element, modelName string) {
+	attrStr := elt.SelectAttrValue("attrs", "")
+	if attrStr == "" {
+		return
+	}
+	var attrs map[string]domains.Domain
+	if err := json.Unmarshal([]byte(attrStr), &attrs); err != nil {
+		c.addError(elt, "invalid attrs '%s': %s", attrStr, err)
+		return
+	}
+	for modifier, dom := range attrs {
+		if !modifiers[modifier] {
+			c.addError(elt, "unknown modifier '%s' in attrs, expected invisible, readonly or required", modifier)
+			continue
+		}
+		if err := parseDomain(dom); err != nil {
+			c.addError(elt, "invalid domain for modifier '%s': %s", modifier, err)
+			continue
+		}
+		for _, path := range domains.Fields(dom) {
+			// Only the first field of paths such as Partner.Name is checked
+			fieldName := strings.Split(path, ".")[0]
+			if c.fieldInfo(elt, modelName, fieldName) == nil {
+				c.addError(elt, "field '%s' of '%s' modifier does not exist on model '%s'", fieldName, modifier, modelName)
+			}
+		}
+	}
+}
+
+// parseDomain returns an error if the given domain cannot be parsed
+func parseDomain(dom domains.Domain) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	domains.ParseDomain(dom)
+	return nil
+}
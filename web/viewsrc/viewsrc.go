@@ -0,0 +1,180 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+/*
+Package viewsrc loads the views XML files of the modules once all modules
+are registered.
+
+The file and line of each view and of the elements of its arch are recorded,
+so that errors found in views can be reported with their location.
+
+Views with an inherit_id attribute are extensions of the view with this id:
+their content is registered with the inherit package, in module load order.
+*/
+package viewsrc
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"sync"
+
+	"github.com/npiganeau/yep-base/base/resources"
+	"github.com/npiganeau/yep-base/web/inherit"
+	"github.com/npiganeau/yep/yep/tools/etree"
+)
+
+var (
+	mu sync.RWMutex
+	// sources holds the location of each loaded view
+	sources = make(map[string]*Source)
+	// extensionViews holds the ids of the views that are extensions
+	extensionViews = make(map[string]bool)
+)
+
+// A Source is the location of a view in an XML file
+type Source struct {
+	File string
+	Line int
+	// elementLines are the lines of the elements of
+	// the view arch in document order.
+	elementLines []int
+}
+
+// Location returns the file and line of the view
+func (s *Source) Location() string {
+	return fmt.Sprintf("%s:%d", s.File, s.Line)
+}
+
+// Lines maps the elements of the given parsed arch of the view to their line.
+// It returns nil if the elements do not match the view source, for instance
+// if the arch has been modified by extensions.
+func (s *Source) Lines(doc *etree.Document) map[*etree.Element]int {
+	var elements []*etree.Element
+	var walk func(elt *etree.Element)
+	walk = func(elt *etree.Element) {
+		elements = append(elements, elt)
+		for _, child := range elt.ChildElements() {
+			walk(child)
+		}
+	}
+	for _, elt := range doc.ChildElements() {
+		walk(elt)
+	}
+	if len(elements) != len(s.elementLines) {
+		return nil
+	}
+	res := make(map[*etree.Element]int, len(elements))
+	for i, elt := range elements {
+		res[elt] = s.elementLines[i]
+	}
+	return res
+}
+
+// Get returns the location of the view with the given id,
+// or nil if it has not been loaded from an XML file.
+func Get(viewID string) *Source {
+	mu.RLock()
+	defer mu.RUnlock()
+	return sources[viewID]
+}
+
+// Load loads the XML files of the views directory of all modules in module
+// load order, and returns the errors found in the declared extensions.
+func Load() []error {
+	var errs []error
+	for _, fileName := range resources.Files("views", "*.xml") {
+		errs = append(errs, LoadFile(fileName)...)
+	}
+	return errs
+}
+
+// LoadFile loads the views declared in the given XML file, and returns
+// the errors found in the declared extensions.
+func LoadFile(fileName string) []error {
+	data, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return []error{err}
+	}
+	var (
+		errs []error
+		dec  = xml.NewDecoder(bytes.NewReader(data))
+		// view is the view element being read and depth the depth
+		// of the current element inside it
+		view  *xml.StartElement
+		depth int
+		// src is the location of the view and start the offset of its content
+		src   *Source
+		start int
+	)
+	for {
+		offset := int(dec.InputOffset())
+		token, err := dec.Token()
+		if err != nil {
+			break
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			line := 1 + bytes.Count(data[:offset], []byte("\n"))
+			if view != nil {
+				src.elementLines = append(src.elementLines, line)
+				depth++
+				continue
+			}
+			if t.Name.Local != "view" {
+				continue
+			}
+			view = &t
+			src = &Source{File: fileName, Line: line}
+			start = int(dec.InputOffset())
+		case xml.EndElement:
+			if view == nil {
+				continue
+			}
+			if depth > 0 {
+				depth--
+				continue
+			}
+			if err := loadView(view, fmt.Sprintf("<data>%s</data>", data[start:offset]), src); err != nil {
+				errs = append(errs, err)
+			}
+			view = nil
+		}
+	}
+	return errs
+}
+
+// loadView records the location of the view of the given element, and
+// registers it as an extension if it has an inherit_id attribute.
+// arch is the content of the view element.
+func loadView(view *xml.StartElement, arch string, src *Source) error {
+	var id, inheritID string
+	for _, attr := range view.Attr {
+		switch attr.Name.Local {
+		case "id":
+			id = attr.Value
+		case "inherit_id":
+			inheritID = attr.Value
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	sources[id] = src
+	if inheritID == "" {
+		return nil
+	}
+	if err := inherit.RegisterAt(inheritID, arch, src.Location()); err != nil {
+		return fmt.Errorf("%s: invalid extension '%s' of view '%s': %s", src.Location(), id, inheritID, err)
+	}
+	extensionViews[id] = true
+	return nil
+}
+
+// IsExtension returns true if the view with the given id has been
+// loaded as an extension of another view.
+func IsExtension(viewID string) bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	return extensionViews[viewID]
+}
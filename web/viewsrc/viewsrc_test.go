@@ -0,0 +1,85 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package viewsrc
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/npiganeau/yep-base/web/inherit"
+	"github.com/npiganeau/yep/yep/tools/etree"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const viewsXML = `<?xml version="1.0" encoding="utf-8"?>
+<yep>
+    <data>
+        <view id="test_viewsrc_form" model="User">
+            <form string="Users">
+                <field name="Name"/>
+                <field name="Login"/>
+            </form>
+        </view>
+
+        <view id="test_viewsrc_form_ext" inherit_id="test_viewsrc_form">
+            <field name="Login" position="after">
+                <field name="Lang"/>
+            </field>
+        </view>
+
+        <view id="test_viewsrc_form_ext2" inherit_id="test_viewsrc_form">
+            <xpath expr="//field[@name='Lang']" position="before"><field name="Email"/></xpath>
+        </view>
+
+        <view id="test_viewsrc_form_invalid" inherit_id="test_viewsrc_form"/>
+    </data>
+</yep>`
+
+func TestLoadFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "viewsrc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fileName := filepath.Join(dir, "views.xml")
+	if err := ioutil.WriteFile(fileName, []byte(viewsXML), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// Extensions can only be registered once
+	errs := LoadFile(fileName)
+	Convey("Testing the loading of views XML files", t, func() {
+		Convey("Invalid extensions should be reported with their location", func() {
+			So(errs, ShouldHaveLength, 1)
+			So(errs[0].Error(), ShouldContainSubstring, fileName+":21")
+			So(errs[0].Error(), ShouldContainSubstring, "test_viewsrc_form_invalid")
+		})
+		Convey("Views with an inherit_id should be registered as extensions in file order", func() {
+			So(IsExtension("test_viewsrc_form"), ShouldBeFalse)
+			So(IsExtension("test_viewsrc_form_ext"), ShouldBeTrue)
+			So(IsExtension("test_viewsrc_form_ext2"), ShouldBeTrue)
+			arch, err := inherit.Apply("test_viewsrc_form", `<form><field name="Name"/><field name="Login"/></form>`)
+			So(err, ShouldBeNil)
+			So(arch, ShouldEqual, `<form><field name="Name"/><field name="Login"/><field name="Email"/><field name="Lang"/></form>`)
+		})
+		Convey("The location of views and of their elements should be recorded", func() {
+			src := Get("test_viewsrc_form")
+			So(src, ShouldNotBeNil)
+			So(src.Location(), ShouldEqual, fileName+":4")
+			doc := etree.NewDocument()
+			So(doc.ReadFromString(`<form string="Users"><field name="Name"/><field name="Login"/></form>`), ShouldBeNil)
+			lines := src.Lines(doc)
+			So(lines[doc.Root()], ShouldEqual, 5)
+			So(lines[doc.FindElement("//field[@name='Login']")], ShouldEqual, 7)
+			doc = etree.NewDocument()
+			So(doc.ReadFromString(`<form><field name="Name"/></form>`), ShouldBeNil)
+			So(src.Lines(doc), ShouldBeNil)
+			So(Get("unknown_view"), ShouldBeNil)
+		})
+		Convey("Unreadable files should return an error", func() {
+			So(LoadFile(filepath.Join(dir, "unknown.xml")), ShouldHaveLength, 1)
+		})
+	})
+}
@@ -0,0 +1,27 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package webdata
+
+import "regexp"
+
+var (
+	// RootFieldAttrs are the attributes of the root element
+	// of each view type whose value is a field name.
+	RootFieldAttrs = map[string][]string{
+		"kanban":   {"default_group_by"},
+		"calendar": {"date_start", "date_stop", "date_delay", "all_day", "color"},
+		"gantt":    {"date_start", "date_stop", "date_delay", "progress", "default_group_by"},
+	}
+	// actionRefRegexp matches action references of buttons such as %(action_id)d
+	actionRefRegexp = regexp.MustCompile(`^%\((.+)\)d$`)
+)
+
+// ActionRef returns the action id of the given name of an action button,
+// which is either the action id or a reference such as %(action_id)d.
+func ActionRef(name string) string {
+	if match := actionRefRegexp.FindStringSubmatch(name); match != nil {
+		return match[1]
+	}
+	return name
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/npiganeau/yep/yep/actions"
 	"github.com/npiganeau/yep/yep/models"
 	"github.com/npiganeau/yep/yep/models/operator"
+	"github.com/npiganeau/yep/yep/models/types"
 	"github.com/npiganeau/yep/yep/views"
 )
 
@@ -28,7 +29,7 @@ type FieldsViewData struct {
 	Model       string                       `json:"model"`
 	Type        views.ViewType               `json:"type"`
 	Fields      map[string]*models.FieldInfo `json:"fields"`
-	Toolbar     Toolbar                      `json:"toolbar"`
+	Toolbar     *Toolbar                     `json:"toolbar,omitempty"`
 	FieldParent string                       `json:"field_parent"`
 }
 
@@ -41,6 +42,39 @@ type SearchParams struct {
 	Order  string         `json:"order"`
 }
 
+// SearchChunkParams is the args struct for the SearchReadChunk method
+type SearchChunkParams struct {
+	Domain domains.Domain `json:"domain"`
+	Fields []string       `json:"fields"`
+	Order  string         `json:"order"`
+	// After is the ID of the last record of the previous chunk,
+	// or 0 to get the first chunk.
+	After int64 `json:"after"`
+	Size  int   `json:"size"`
+}
+
+// SearchChunkResult is the result struct of the SearchReadChunk method
+type SearchChunkResult struct {
+	Records []models.FieldMap `json:"records"`
+	// Last is the ID of the last record of this chunk,
+	// to be passed as After to get the next chunk.
+	Last int64 `json:"last"`
+	// Done is true if there are no more records after this chunk
+	Done bool `json:"done"`
+}
+
+// SaveColumnParams is the args struct for the SaveColumn method.
+// Nil or empty values leave the corresponding setting unchanged.
+type SaveColumnParams struct {
+	ViewID  string `json:"view_id"`
+	Field   string `json:"field"`
+	Visible *bool  `json:"visible"`
+	// Sequence is the position of the column in the list, starting at 0
+	Sequence *int `json:"sequence"`
+	// Width is the CSS width of the column, such as "120px"
+	Width string `json:"width"`
+}
+
 // A Toolbar holds the actions in the toolbar of the action manager
 type Toolbar struct {
 	Print  []*actions.BaseAction `json:"print"`
@@ -104,3 +138,27 @@ type SearchReadResult struct {
 	Records []models.FieldMap `json:"records"`
 	Length  int               `json:"length"`
 }
+
+// OnchangeParams is the args struct for the Onchange method
+type OnchangeParams struct {
+	Values models.FieldMap `json:"values"`
+	// FieldName is the name of the changed field, or a list
+	// of field names when the form is initialized.
+	FieldName interface{}       `json:"field_name"`
+	Fields    map[string]string `json:"field_onchange"`
+	Context   *types.Context    `json:"context"`
+}
+
+// OnchangeResult is the result struct of the Onchange method and of
+// the onchange methods of the fields.
+type OnchangeResult struct {
+	Value   models.FieldMap           `json:"value"`
+	Domain  map[string]domains.Domain `json:"domain"`
+	Warning *OnchangeWarning          `json:"warning,omitempty"`
+}
+
+// An OnchangeWarning is a warning displayed to the user after an onchange
+type OnchangeWarning struct {
+	Title   string `json:"title"`
+	Message string `json:"message"`
+}
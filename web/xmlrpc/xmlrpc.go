@@ -0,0 +1,306 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+/*
+Package xmlrpc implements the encoding and decoding of XML-RPC messages
+as used by Odoo's external API.
+
+Values are decoded into int64, float64, bool, string, time.Time,
+[]interface{} and map[string]interface{}, and nil for the <nil/> extension.
+Values are encoded after a JSON round trip, so that Go values are sent
+to XML-RPC clients exactly as they are sent to the web client.
+*/
+package xmlrpc
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// dateTimeFormat is the format of the dateTime.iso8601 values
+const dateTimeFormat = "20060102T15:04:05"
+
+// A Fault is an XML-RPC error response.
+type Fault struct {
+	Code   int
+	String string
+}
+
+// Error returns the message of the fault
+func (f Fault) Error() string {
+	return f.String
+}
+
+// DecodeMethodCall decodes the XML-RPC method call read from r and returns
+// the called method name and the decoded parameters.
+func DecodeMethodCall(r io.Reader) (string, []interface{}, error) {
+	dec := xml.NewDecoder(r)
+	var (
+		method string
+		params []interface{}
+	)
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", nil, err
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		switch start.Name.Local {
+		case "methodName":
+			if method, err = readText(dec); err != nil {
+				return "", nil, err
+			}
+		case "value":
+			val, err := decodeValue(dec)
+			if err != nil {
+				return "", nil, err
+			}
+			params = append(params, val)
+		}
+	}
+	if method == "" {
+		return "", nil, fmt.Errorf("missing methodName in XML-RPC call")
+	}
+	return method, params, nil
+}
+
+// readText returns the character data of the current element and consumes its end tag.
+func readText(dec *xml.Decoder) (string, error) {
+	var buf bytes.Buffer
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return "", err
+		}
+		switch t := tok.(type) {
+		case xml.CharData:
+			buf.Write(t)
+		case xml.EndElement:
+			return buf.String(), nil
+		case xml.StartElement:
+			return "", fmt.Errorf("unexpected element <%s>", t.Name.Local)
+		}
+	}
+}
+
+// decodeValue decodes the content of a <value> element whose start tag
+// has just been read and consumes its end tag.
+func decodeValue(dec *xml.Decoder) (interface{}, error) {
+	var (
+		res   interface{}
+		text  bytes.Buffer
+		typed bool
+	)
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.CharData:
+			text.Write(t)
+		case xml.EndElement:
+			if !typed {
+				// A value without type is a string
+				return text.String(), nil
+			}
+			return res, nil
+		case xml.StartElement:
+			typed = true
+			if res, err = decodeTypedValue(dec, t.Name.Local); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+// decodeTypedValue decodes the content of the element of the given type
+// whose start tag has just been read and consumes its end tag.
+func decodeTypedValue(dec *xml.Decoder, typ string) (interface{}, error) {
+	switch typ {
+	case "array":
+		return decodeArray(dec)
+	case "struct":
+		return decodeStruct(dec)
+	case "nil":
+		return nil, dec.Skip()
+	}
+	text, err := readText(dec)
+	if err != nil {
+		return nil, err
+	}
+	switch typ {
+	case "int", "i4", "i8":
+		return strconv.ParseInt(strings.TrimSpace(text), 10, 64)
+	case "boolean":
+		return strings.TrimSpace(text) == "1", nil
+	case "double":
+		return strconv.ParseFloat(strings.TrimSpace(text), 64)
+	case "string":
+		return text, nil
+	case "base64":
+		// Binary data is kept base64 encoded as expected by binary fields
+		data := strings.Join(strings.Fields(text), "")
+		if _, err := base64.StdEncoding.DecodeString(data); err != nil {
+			return nil, err
+		}
+		return data, nil
+	case "dateTime.iso8601":
+		return time.Parse(dateTimeFormat, strings.TrimSpace(text))
+	}
+	return nil, fmt.Errorf("unknown XML-RPC type '%s'", typ)
+}
+
+// decodeArray decodes the content of an <array> element
+func decodeArray(dec *xml.Decoder) ([]interface{}, error) {
+	res := []interface{}{}
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if t.Name.Local != "value" {
+				// <data> element
+				continue
+			}
+			val, err := decodeValue(dec)
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, val)
+		case xml.EndElement:
+			if t.Name.Local == "array" {
+				return res, nil
+			}
+		}
+	}
+}
+
+// decodeStruct decodes the content of a <struct> element
+func decodeStruct(dec *xml.Decoder) (map[string]interface{}, error) {
+	res := make(map[string]interface{})
+	var name string
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "name":
+				if name, err = readText(dec); err != nil {
+					return nil, err
+				}
+			case "value":
+				val, err := decodeValue(dec)
+				if err != nil {
+					return nil, err
+				}
+				res[name] = val
+			}
+		case xml.EndElement:
+			if t.Name.Local == "struct" {
+				return res, nil
+			}
+		}
+	}
+}
+
+// EncodeResponse writes the XML-RPC method response with the given value to w.
+func EncodeResponse(w io.Writer, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var jsonValue interface{}
+	if err := dec.Decode(&jsonValue); err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	buf.WriteString("<methodResponse><params><param>")
+	encodeValue(&buf, jsonValue)
+	buf.WriteString("</param></params></methodResponse>")
+	_, err = buf.WriteTo(w)
+	return err
+}
+
+// EncodeFault writes the XML-RPC fault response of the given Fault to w.
+func EncodeFault(w io.Writer, fault Fault) error {
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	buf.WriteString("<methodResponse><fault>")
+	encodeValue(&buf, map[string]interface{}{
+		"faultCode":   json.Number(strconv.Itoa(fault.Code)),
+		"faultString": fault.String,
+	})
+	buf.WriteString("</fault></methodResponse>")
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+// encodeValue writes the given JSON decoded value as an XML-RPC <value> to buf.
+func encodeValue(buf *bytes.Buffer, value interface{}) {
+	buf.WriteString("<value>")
+	switch v := value.(type) {
+	case nil:
+		buf.WriteString("<nil/>")
+	case bool:
+		if v {
+			buf.WriteString("<boolean>1</boolean>")
+		} else {
+			buf.WriteString("<boolean>0</boolean>")
+		}
+	case json.Number:
+		if _, err := v.Int64(); err == nil {
+			fmt.Fprintf(buf, "<int>%s</int>", v)
+		} else {
+			fmt.Fprintf(buf, "<double>%s</double>", v)
+		}
+	case string:
+		buf.WriteString("<string>")
+		xml.EscapeText(buf, []byte(v))
+		buf.WriteString("</string>")
+	case []interface{}:
+		buf.WriteString("<array><data>")
+		for _, item := range v {
+			encodeValue(buf, item)
+		}
+		buf.WriteString("</data></array>")
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		buf.WriteString("<struct>")
+		for _, key := range keys {
+			buf.WriteString("<member><name>")
+			xml.EscapeText(buf, []byte(key))
+			buf.WriteString("</name>")
+			encodeValue(buf, v[key])
+			buf.WriteString("</member>")
+		}
+		buf.WriteString("</struct>")
+	}
+	buf.WriteString("</value>")
+}
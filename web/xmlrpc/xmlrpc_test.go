@@ -0,0 +1,74 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package xmlrpc
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestXMLRPC(t *testing.T) {
+	Convey("Testing XML-RPC decoding", t, func() {
+		call := `<?xml version="1.0"?>
+<methodCall>
+  <methodName>execute_kw</methodName>
+  <params>
+    <param><value><string>db</string></value></param>
+    <param><value><int>2</int></value></param>
+    <param><value>admin</value></param>
+    <param><value><array><data>
+      <value><array><data><value><array><data>
+        <value><string>is_company</string></value>
+        <value><string>=</string></value>
+        <value><boolean>1</boolean></value>
+      </data></array></value></data></array></value>
+    </data></array></value></param>
+    <param><value><struct>
+      <member><name>limit</name><value><i4>5</i4></value></member>
+      <member><name>ratio</name><value><double>1.5</double></value></member>
+      <member><name>date</name><value><dateTime.iso8601>20170102T10:20:30</dateTime.iso8601></value></member>
+      <member><name>none</name><value><nil/></value></member>
+    </struct></value></param>
+  </params>
+</methodCall>`
+		method, params, err := DecodeMethodCall(strings.NewReader(call))
+		So(err, ShouldBeNil)
+		So(method, ShouldEqual, "execute_kw")
+		So(params, ShouldHaveLength, 5)
+		So(params[0], ShouldEqual, "db")
+		So(params[1], ShouldEqual, int64(2))
+		So(params[2], ShouldEqual, "admin")
+		So(params[3], ShouldResemble, []interface{}{[]interface{}{[]interface{}{"is_company", "=", true}}})
+		So(params[4], ShouldResemble, map[string]interface{}{
+			"limit": int64(5),
+			"ratio": 1.5,
+			"date":  time.Date(2017, 1, 2, 10, 20, 30, 0, time.UTC),
+			"none":  nil,
+		})
+		Convey("Calls without methodName should fail", func() {
+			_, _, err := DecodeMethodCall(strings.NewReader("<methodCall><params></params></methodCall>"))
+			So(err, ShouldNotBeNil)
+		})
+	})
+	Convey("Testing XML-RPC encoding", t, func() {
+		var buf bytes.Buffer
+		err := EncodeResponse(&buf, []map[string]interface{}{{"id": int64(3), "name": "A & B", "active": false, "parent_id": nil}})
+		So(err, ShouldBeNil)
+		So(buf.String(), ShouldEndWith, "<methodResponse><params><param><value><array><data><value><struct>"+
+			"<member><name>active</name><value><boolean>0</boolean></value></member>"+
+			"<member><name>id</name><value><int>3</int></value></member>"+
+			"<member><name>name</name><value><string>A &amp; B</string></value></member>"+
+			"<member><name>parent_id</name><value><nil/></value></member>"+
+			"</struct></value></data></array></value></param></params></methodResponse>")
+		buf.Reset()
+		err = EncodeFault(&buf, Fault{Code: 1, String: "Access denied"})
+		So(err, ShouldBeNil)
+		So(buf.String(), ShouldContainSubstring, "<fault><value><struct><member><name>faultCode</name><value><int>1</int></value></member>")
+		So(buf.String(), ShouldContainSubstring, "<string>Access denied</string>")
+	})
+}
@@ -16,18 +16,56 @@ package web
 
 import (
 	_ "github.com/npiganeau/yep-base/base"
+	"github.com/npiganeau/yep-base/base/resources"
 	_ "github.com/npiganeau/yep-base/web/controllers"
 	_ "github.com/npiganeau/yep-base/web/defs"
+	"github.com/npiganeau/yep-base/web/domains"
+	"github.com/npiganeau/yep-base/web/rpc"
+	"github.com/npiganeau/yep-base/web/viewcache"
+	"github.com/npiganeau/yep-base/web/viewcheck"
+	"github.com/npiganeau/yep-base/web/viewsrc"
+	"github.com/npiganeau/yep/yep/models"
+	"github.com/npiganeau/yep/yep/models/security"
 	"github.com/npiganeau/yep/yep/server"
+	"github.com/npiganeau/yep/yep/tools/logging"
 )
 
 const (
 	MODULE_NAME = "web"
 )
 
+var log *logging.Logger
+
 func init() {
+	log = logging.GetLogger("web")
+	resources.Register(MODULE_NAME, "github.com/npiganeau/yep-base/web")
 	server.RegisterModule(&server.Module{
-		Name:     MODULE_NAME,
-		PostInit: func() {},
+		Name: MODULE_NAME,
+		PostInit: func() {
+			// Views are loaded and checked here because all modules are loaded
+			errs := viewsrc.Load()
+			errs = append(errs, viewcheck.CheckViews()...)
+			for _, err := range errs {
+				log.Error("Invalid view", "error", err)
+			}
+			if len(errs) > 0 {
+				log.Panic("Invalid views found, see errors above", "count", len(errs))
+			}
+			// Exposed methods are checked here because all methods are declared
+			errs = rpc.CheckExposed()
+			for _, err := range errs {
+				log.Error("Invalid RPC exposure", "error", err)
+			}
+			if len(errs) > 0 {
+				log.Panic("Exposed methods not found, see errors above", "count", len(errs))
+			}
+			// Search vector columns are created here because all tables exist
+			err := models.ExecuteInNewEnvironment(security.SuperUserID, domains.SyncSearchVectors)
+			if err != nil {
+				log.Panic("Unable to create search vector columns", "error", err)
+			}
+			// Views processed before all modules were loaded are outdated
+			viewcache.Invalidate()
+		},
 	})
 }